@@ -56,10 +56,11 @@ type RegisterOption struct {
 	CheckUrl string
 
 	// 选项配置
-	CheckInterval                string   // 检测间隔，默认 5s
-	CheckTimeout                 string   // 检测超时，默认 3s
-	CheckDeregisterCriticalAfter string   // 仅支持consul 0.7+
-	Tags                         []string // 服务标签
+	CheckInterval                string            // 检测间隔，默认 5s
+	CheckTimeout                 string            // 检测超时，默认 3s
+	CheckDeregisterCriticalAfter string            // 仅支持consul 0.7+
+	Tags                         []string          // 服务标签
+	Meta                         map[string]string // 服务元数据，需要consul 1.0.7+
 }
 
 // ServerType 服务类型
@@ -116,6 +117,7 @@ func (client *Client) registerHttp(option *RegisterOption) error {
 		Name:    option.Name, // 模块定义 fw_service
 		Port:    option.Port, // 端口
 		Tags:    option.Tags, // 服务标签
+		Meta:    option.Meta, // 服务元数据
 		Address: option.Ip,   // 服务地址
 		Check: &api.AgentServiceCheck{
 			HTTP:                           option.CheckUrl,
@@ -156,6 +158,7 @@ func (client *Client) registerTcp(option *RegisterOption) error {
 		Name:    option.Name, // 模块定义 fw_service
 		Port:    option.Port, // 端口
 		Tags:    option.Tags, // 服务标签
+		Meta:    option.Meta, // 服务元数据
 		Address: option.Ip,   // 服务地址
 		Check: &api.AgentServiceCheck{
 			TCP:                            tcpStr,
@@ -222,6 +225,7 @@ func (client *Client) registerGrpc(option *RegisterOption) error {
 		Name:    option.Name,
 		Port:    option.Port,
 		Tags:    option.Tags,
+		Meta:    option.Meta,
 		Address: option.Ip,
 		Check: &api.AgentServiceCheck{
 			GRPC:                           option.CheckUrl,
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+
+	"github.com/lworkltd/kits/service/context"
+)
+
+// APIKeyHeader API Key的默认请求头
+const APIKeyHeader = "X-Api-Key"
+
+// APIKeyOption API Key认证的配置
+type APIKeyOption struct {
+	// Header API Key的请求头，默认X-Api-Key
+	Header string
+	// Keys API Key到调用方的映射，Principal.Subject通常为调用方的名称
+	Keys map[string]*context.Principal
+}
+
+// APIKeyAuthenticator 校验请求头中的API Key
+type APIKeyAuthenticator struct {
+	header string
+	// 使用摘要作为键，避免保存明文并减少比较的时间差异
+	keys map[[sha256.Size]byte]*context.Principal
+}
+
+// NewAPIKeyAuthenticator 创建API Key认证
+func NewAPIKeyAuthenticator(option *APIKeyOption) *APIKeyAuthenticator {
+	authenticator := &APIKeyAuthenticator{
+		header: option.Header,
+		keys:   make(map[[sha256.Size]byte]*context.Principal, len(option.Keys)),
+	}
+	if authenticator.header == "" {
+		authenticator.header = APIKeyHeader
+	}
+	for key, principal := range option.Keys {
+		p := *principal
+		p.Method = MethodAPIKey
+		authenticator.keys[sha256.Sum256([]byte(key))] = &p
+	}
+
+	return authenticator
+}
+
+// Authenticate 没有API Key时返回nil,nil
+func (authenticator *APIKeyAuthenticator) Authenticate(request *http.Request) (*context.Principal, error) {
+	key := request.Header.Get(authenticator.header)
+	if key == "" {
+		return nil, nil
+	}
+
+	principal, exist := authenticator.keys[sha256.Sum256([]byte(key))]
+	if !exist {
+		return nil, errors.New("invalid api key")
+	}
+	p := *principal
+	return &p, nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/lworkltd/kits/service/context"
+)
+
+// 认证方式
+const (
+	MethodJWT    = "jwt"
+	MethodHMAC   = "hmac"
+	MethodAPIKey = "apikey"
+)
+
+// ErrNoCredentials 请求没有携带任何支持的凭证
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator 认证请求的调用方
+type Authenticator interface {
+	// Authenticate 返回通过认证的调用方
+	// 请求没有携带该方式的凭证时返回nil,nil，携带了但是不合法时返回错误
+	Authenticate(request *http.Request) (*context.Principal, error)
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(request *http.Request) (*context.Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(request *http.Request) (*context.Principal, error) {
+	return f(request)
+}
+
+// Chain 依次尝试多种认证方式，使用第一个携带了凭证的方式的结果，都没有携带时返回ErrNoCredentials
+//
+//	authenticator := auth.Chain(jwtAuthenticator, hmacAuthenticator, apiKeyAuthenticator)
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(request *http.Request) (*context.Principal, error) {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(request)
+			if err != nil || principal != nil {
+				return principal, err
+			}
+		}
+		return nil, ErrNoCredentials
+	})
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lworkltd/kits/service/context"
+)
+
+func segment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(secret []byte, claims map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	input := segment(map[string]string{"alg": "RS256", "kid": kid}) + "." + segment(claims)
+	sum := sha256.Sum256([]byte(input))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func bearer(token string) *http.Request {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+func TestJWTAuthenticatorHS(t *testing.T) {
+	secret := []byte("secret")
+	authenticator, err := NewJWTAuthenticator(&JWTOption{Secret: secret, Issuer: "idp", Audience: "order"})
+	if err != nil {
+		t.Fatalf("NewJWTAuthenticator() error = %v", err)
+	}
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{
+		"sub": "user-1", "iss": "idp", "aud": []string{"order", "user"},
+		"exp": now + 60, "scope": "order:read order:write", "roles": []string{"admin"},
+	}
+	with := func(k string, v interface{}) map[string]interface{} {
+		claims := map[string]interface{}{}
+		for key, value := range valid {
+			claims[key] = value
+		}
+		claims[k] = v
+		return claims
+	}
+	none := segment(map[string]string{"alg": "none"}) + "." + segment(valid) + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "valid", token: signHS256(secret, valid)},
+		{name: "expired", token: signHS256(secret, with("exp", now-3600)), wantErr: "expired"},
+		{name: "not before", token: signHS256(secret, with("nbf", now+3600)), wantErr: "not valid yet"},
+		{name: "issuer", token: signHS256(secret, with("iss", "other")), wantErr: "issuer"},
+		{name: "audience", token: signHS256(secret, with("aud", "user")), wantErr: "audience"},
+		{name: "audience string", token: signHS256(secret, with("aud", "order"))},
+		{name: "audience with space", token: signHS256(secret, with("aud", "user order")), wantErr: "audience"},
+		{name: "exp not number", token: signHS256(secret, with("exp", "never")), wantErr: "invalid token exp"},
+		{name: "nbf not number", token: signHS256(secret, with("nbf", true)), wantErr: "invalid token nbf"},
+		{name: "signature", token: signHS256([]byte("other"), valid), wantErr: "signature"},
+		{name: "alg none", token: none, wantErr: "unsupported alg"},
+		{name: "malformed", token: "abc", wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(bearer(tt.token))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Authenticate() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			want := []string{"order:read", "order:write"}
+			if principal.Subject != "user-1" || principal.Method != MethodJWT || !reflect.DeepEqual(principal.Scopes, want) || !principal.HasRole("admin") {
+				t.Errorf("Authenticate() = %+v", principal)
+			}
+		})
+	}
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if principal, err := authenticator.Authenticate(request); principal != nil || err != nil {
+		t.Errorf("Authenticate() without token = %v, %v, want nil, nil", principal, err)
+	}
+}
+
+func TestJWTAuthenticatorJWKS(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Unix() + 60}
+
+	t.Run("file", func(t *testing.T) {
+		b, _ := json.Marshal(JWKS{Keys: []JWK{NewJWK("k1", &key1.PublicKey)}})
+		file := filepath.Join(t.TempDir(), "jwks.json")
+		ioutil.WriteFile(file, b, 0644)
+
+		authenticator, err := NewJWTAuthenticator(&JWTOption{JWKSFile: file})
+		if err != nil {
+			t.Fatalf("NewJWTAuthenticator() error = %v", err)
+		}
+		if _, err := authenticator.Authenticate(bearer(signRS256(key1, "k1", claims))); err != nil {
+			t.Errorf("Authenticate() error = %v", err)
+		}
+		if _, err := authenticator.Authenticate(bearer(signRS256(key1, "", claims))); err != nil {
+			t.Errorf("Authenticate() without kid error = %v", err)
+		}
+		if _, err := authenticator.Authenticate(bearer(signRS256(key2, "k1", claims))); err == nil {
+			t.Errorf("token signed by another key should fail")
+		}
+		if _, err := authenticator.Authenticate(bearer(signHS256([]byte("secret"), claims))); err == nil {
+			t.Errorf("HS256 should not be accepted without a secret")
+		}
+	})
+
+	t.Run("url rotation", func(t *testing.T) {
+		var rotated, fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			set := JWKS{Keys: []JWK{NewJWK("k1", &key1.PublicKey)}}
+			if atomic.LoadInt32(&rotated) == 1 {
+				set.Keys = append(set.Keys, NewJWK("k2", &key2.PublicKey))
+			}
+			json.NewEncoder(w).Encode(set)
+		}))
+		defer server.Close()
+
+		authenticator, err := NewJWTAuthenticator(&JWTOption{JWKSURL: server.URL})
+		if err != nil {
+			t.Fatalf("NewJWTAuthenticator() error = %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			authenticator.Authenticate(bearer(signRS256(key1, "k1", claims)))
+		}
+		if fetches != 1 {
+			t.Errorf("jwks fetched %d times, want cached", fetches)
+		}
+
+		atomic.StoreInt32(&rotated, 1)
+		if _, err := authenticator.Authenticate(bearer(signRS256(key2, "k2", claims))); err != nil {
+			t.Errorf("unknown kid should reload jwks, error = %v", err)
+		}
+		if _, err := authenticator.Authenticate(bearer(signRS256(key2, "k3", claims))); err == nil || fetches != 2 {
+			t.Errorf("unknown kid should not reload again within %v, fetches %d", jwksMissRefresh, fetches)
+		}
+	})
+
+	t.Run("refresh failed", func(t *testing.T) {
+		var failed, fetches int32
+		block := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			if atomic.LoadInt32(&failed) == 1 {
+				<-block
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			json.NewEncoder(w).Encode(JWKS{Keys: []JWK{NewJWK("k1", &key1.PublicKey)}})
+		}))
+		defer server.Close()
+
+		authenticator, err := NewJWTAuthenticator(&JWTOption{JWKSURL: server.URL})
+		if err != nil {
+			t.Fatalf("NewJWTAuthenticator() error = %v", err)
+		}
+		atomic.StoreInt32(&failed, 1)
+		set := authenticator.jwks
+		set.mutex.Lock()
+		set.loadedAt, set.attemptAt = time.Time{}, time.Time{}
+		set.mutex.Unlock()
+
+		// 刷新阻塞时不影响使用已经加载的公钥，也不会重复加载
+		for i := 0; i < 5; i++ {
+			if _, err := authenticator.Authenticate(bearer(signRS256(key1, "k1", claims))); err != nil {
+				t.Errorf("Authenticate() during refresh error = %v", err)
+			}
+		}
+		if _, err := authenticator.Authenticate(bearer(signRS256(key2, "k2", claims))); err == nil {
+			t.Errorf("unknown kid should fail")
+		}
+		close(block)
+		for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			set.mutex.Lock()
+			loading := set.loading
+			set.mutex.Unlock()
+			if !loading {
+				break
+			}
+		}
+
+		// 失败后继续使用已经加载的公钥，并且在jwksMissRefresh内不再重试
+		for i := 0; i < 5; i++ {
+			if _, err := authenticator.Authenticate(bearer(signRS256(key1, "k1", claims))); err != nil {
+				t.Errorf("Authenticate() after refresh failed error = %v", err)
+			}
+		}
+		if n := atomic.LoadInt32(&fetches); n != 2 {
+			t.Errorf("jwks fetched %d times, want 2", n)
+		}
+	})
+
+	if _, err := NewJWTAuthenticator(&JWTOption{JWKSFile: filepath.Join(os.TempDir(), "not-exist.json")}); err == nil {
+		t.Errorf("NewJWTAuthenticator() with missing jwks should fail")
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	authenticator := NewHMACAuthenticator(&HMACOption{
+		Keys: map[string]*HMACKey{"order-service": {Secret: []byte("secret"), Roles: []string{"internal"}}},
+	})
+	newRequest := func() *http.Request {
+		request, _ := http.NewRequest("POST", "http://user-service/v1/users?b=2&a=1", strings.NewReader(`{"name":"a"}`))
+		return request
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(request *http.Request)
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "body", modify: func(r *http.Request) { r.Body = ioutil.NopCloser(strings.NewReader(`{"name":"b"}`)) }, wantErr: "invalid signature"},
+		{name: "query", modify: func(r *http.Request) { r.URL.RawQuery = "a=2&b=2" }, wantErr: "invalid signature"},
+		{name: "query order", modify: func(r *http.Request) { r.URL.RawQuery = "a=1&b=2" }},
+		{name: "unknown key", modify: func(r *http.Request) { r.Header.Set(SignatureKeyHeader, "other") }, wantErr: "unknown signature key"},
+		{
+			name: "expired",
+			modify: func(r *http.Request) {
+				r.Header.Set(SignatureTimestampHeader, "1")
+			},
+			wantErr: "expired",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := newRequest()
+			if err := SignRequest(request, "order-service", []byte("secret")); err != nil {
+				t.Fatalf("SignRequest() error = %v", err)
+			}
+			if tt.modify != nil {
+				tt.modify(request)
+			}
+			principal, err := authenticator.Authenticate(request)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Authenticate() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || principal.Subject != "order-service" || !principal.HasRole("internal") {
+				t.Fatalf("Authenticate() = %+v, %v", principal, err)
+			}
+			if body, _ := ioutil.ReadAll(request.Body); string(body) != `{"name":"a"}` {
+				t.Errorf("body should be kept, got %s", body)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	apiKey := NewAPIKeyAuthenticator(&APIKeyOption{
+		Keys: map[string]*context.Principal{"key-1": {Subject: "partner", Scopes: []string{"report:read"}}},
+	})
+	jwt, _ := NewJWTAuthenticator(&JWTOption{Secret: []byte("secret")})
+	authenticator := Chain(jwt, apiKey)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	if _, err := authenticator.Authenticate(request); err != ErrNoCredentials {
+		t.Errorf("Authenticate() error = %v, want ErrNoCredentials", err)
+	}
+
+	request.Header.Set(APIKeyHeader, "key-1")
+	principal, err := authenticator.Authenticate(request)
+	if err != nil || principal.Subject != "partner" || principal.Method != MethodAPIKey || !principal.HasScope("report:read") {
+		t.Errorf("Authenticate() = %+v, %v", principal, err)
+	}
+
+	request.Header.Set(APIKeyHeader, "key-2")
+	if _, err := authenticator.Authenticate(request); err == nil {
+		t.Errorf("invalid api key should fail")
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMissRefresh 遇到未知的kid时重新加载的最小间隔，避免伪造的kid频繁触发加载
+const jwksMissRefresh = 30 * time.Second
+
+// JWK JSON Web Key，只支持RSA公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwks 缓存的公钥集合，定期从文件或者URL重新加载
+type jwks struct {
+	file    string
+	url     string
+	client  *http.Client
+	refresh time.Duration
+
+	mutex     sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	loadedAt  time.Time
+	attemptAt time.Time
+	missAt    time.Time
+	loading   bool
+}
+
+// key 按kid查找公钥，kid为空并且只有一个公钥时使用该公钥
+func (set *jwks) key(kid string) (*rsa.PublicKey, error) {
+	set.mutex.Lock()
+	now := time.Now()
+	// 过期时在后台重新加载，加载完成前以及失败时继续使用已经加载的公钥，
+	// 失败后至少间隔jwksMissRefresh再重试
+	if now.Sub(set.loadedAt) > set.refresh && now.Sub(set.attemptAt) > jwksMissRefresh && !set.loading {
+		set.loading, set.attemptAt = true, now
+		go set.reload()
+	}
+	key := set.lookup(kid)
+	// 签发方可能已经轮换了公钥，同一时间只有一个请求去加载
+	miss := key == nil && now.Sub(set.missAt) > jwksMissRefresh && !set.loading
+	if miss {
+		set.loading, set.attemptAt, set.missAt = true, now, now
+	}
+	set.mutex.Unlock()
+
+	if key != nil {
+		return key, nil
+	}
+	if miss {
+		if err := set.reload(); err != nil {
+			return nil, err
+		}
+		set.mutex.Lock()
+		key = set.lookup(kid)
+		set.mutex.Unlock()
+		if key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (set *jwks) lookup(kid string) *rsa.PublicKey {
+	if kid == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key
+		}
+	}
+	return set.keys[kid]
+}
+
+// load 首次加载公钥
+func (set *jwks) load() error {
+	set.mutex.Lock()
+	set.loading, set.attemptAt = true, time.Now()
+	set.mutex.Unlock()
+	return set.reload()
+}
+
+// reload 在锁外读取并解析公钥，成功后替换缓存，调用方需要先设置loading
+func (set *jwks) reload() error {
+	keys, err := set.fetch()
+
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+	set.loading = false
+	if err != nil {
+		return err
+	}
+	set.keys = keys
+	set.loadedAt = time.Now()
+	return nil
+}
+
+func (set *jwks) fetch() (map[string]*rsa.PublicKey, error) {
+	b, err := set.read()
+	if err != nil {
+		return nil, fmt.Errorf("load jwks failed,%v", err)
+	}
+	return ParseJWKS(b)
+}
+
+func (set *jwks) read() ([]byte, error) {
+	if set.file != "" {
+		return ioutil.ReadFile(set.file)
+	}
+
+	rsp, err := set.client.Get(set.url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+	return ioutil.ReadAll(io.LimitReader(rsp.Body, 1<<20))
+}
+
+// ParseJWKS 解析JWKS中的RSA公钥，返回kid到公钥的映射
+func ParseJWKS(b []byte) (map[string]*rsa.PublicKey, error) {
+	var set JWKS
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("bad jwks,%v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad jwk %s modulus,%v", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad jwk %s exponent,%v", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no rsa signing key in jwks")
+	}
+
+	return keys, nil
+}
+
+// NewJWK 将RSA公钥转换为JWK，用于生成JWKS
+func NewJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
@@ -0,0 +1,292 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lworkltd/kits/service/context"
+)
+
+// JWT的默认配置
+const (
+	DefaultJWKSRefresh = 10 * time.Minute
+	DefaultJWTLeeway   = time.Minute
+)
+
+// JWTOption JWT认证的配置，Secret和JWKS至少配置一个
+type JWTOption struct {
+	// Secret HS256/HS384/HS512的密钥
+	Secret []byte
+	// JWKSFile,JWKSURL RS256/RS384/RS512的公钥集合，按kid选择公钥
+	JWKSFile string
+	JWKSURL  string
+	// JWKSRefresh 重新加载JWKS的间隔，默认10m，在后台加载，失败时继续使用已经加载的公钥并间隔30s重试；
+	// 遇到未知的kid时也会重新加载，但间隔不少于30s
+	JWKSRefresh time.Duration
+	// HTTPClient 请求JWKSURL使用的客户端，默认超时5s
+	HTTPClient *http.Client
+
+	// Issuer,Audience 配置时校验iss和aud
+	Issuer   string
+	Audience string
+	// Leeway exp和nbf允许的时钟误差，默认1m
+	Leeway time.Duration
+
+	// ScopeClaim 权限的声明，值为空格分隔的字符串或者数组，默认scope
+	ScopeClaim string
+	// RolesClaim 角色的声明，值为数组或者逗号分隔的字符串，默认roles
+	RolesClaim string
+}
+
+// JWTAuthenticator 校验请求头Authorization: Bearer <token>中的JWT
+type JWTAuthenticator struct {
+	option JWTOption
+	jwks   *jwks
+}
+
+// NewJWTAuthenticator 创建JWT认证，配置了JWKS时立即加载，加载失败时返回错误
+func NewJWTAuthenticator(option *JWTOption) (*JWTAuthenticator, error) {
+	opt := *option
+	if len(opt.Secret) == 0 && opt.JWKSFile == "" && opt.JWKSURL == "" {
+		return nil, errors.New("jwt needs a secret or a jwks")
+	}
+	if opt.JWKSRefresh <= 0 {
+		opt.JWKSRefresh = DefaultJWKSRefresh
+	}
+	if opt.Leeway <= 0 {
+		opt.Leeway = DefaultJWTLeeway
+	}
+	if opt.ScopeClaim == "" {
+		opt.ScopeClaim = "scope"
+	}
+	if opt.RolesClaim == "" {
+		opt.RolesClaim = "roles"
+	}
+	if opt.HTTPClient == nil {
+		opt.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	authenticator := &JWTAuthenticator{option: opt}
+	if opt.JWKSFile != "" || opt.JWKSURL != "" {
+		authenticator.jwks = &jwks{
+			file:    opt.JWKSFile,
+			url:     opt.JWKSURL,
+			client:  opt.HTTPClient,
+			refresh: opt.JWKSRefresh,
+		}
+		if err := authenticator.jwks.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return authenticator, nil
+}
+
+// Authenticate 没有Bearer Token时返回nil,nil
+func (authenticator *JWTAuthenticator) Authenticate(request *http.Request) (*context.Principal, error) {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return nil, nil
+	}
+
+	claims, err := authenticator.Verify(strings.TrimSpace(authorization[7:]))
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	return &context.Principal{
+		Subject: subject,
+		Method:  MethodJWT,
+		Scopes:  claimStrings(claims[authenticator.option.ScopeClaim], " "),
+		Roles:   claimStrings(claims[authenticator.option.RolesClaim], ","),
+		Claims:  claims,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify 校验签名和声明，返回所有的声明
+func (authenticator *JWTAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header,%v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature,%v", err)
+	}
+	if err := authenticator.verifySignature(&header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims,%v", err)
+	}
+	if err := authenticator.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (authenticator *JWTAuthenticator) verifySignature(header *jwtHeader, signingInput string, signature []byte) error {
+	switch header.Alg {
+	case "HS256", "HS384", "HS512":
+		if len(authenticator.option.Secret) == 0 {
+			return fmt.Errorf("unsupported alg %s", header.Alg)
+		}
+		mac := hmac.New(hashFunc(header.Alg), authenticator.option.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	case "RS256", "RS384", "RS512":
+		if authenticator.jwks == nil {
+			return fmt.Errorf("unsupported alg %s", header.Alg)
+		}
+		key, err := authenticator.jwks.key(header.Kid)
+		if err != nil {
+			return err
+		}
+		h := hashFunc(header.Alg)()
+		h.Write([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, cryptoHash(header.Alg), h.Sum(nil), signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+		return nil
+	}
+
+	// 包括none
+	return fmt.Errorf("unsupported alg %s", header.Alg)
+}
+
+func (authenticator *JWTAuthenticator) verifyClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	leeway := authenticator.option.Leeway
+	if v, exist := claims["exp"]; exist {
+		exp, ok := claimTime(v)
+		if !ok {
+			return errors.New("invalid token exp")
+		}
+		if now.After(exp.Add(leeway)) {
+			return errors.New("token expired")
+		}
+	}
+	if v, exist := claims["nbf"]; exist {
+		nbf, ok := claimTime(v)
+		if !ok {
+			return errors.New("invalid token nbf")
+		}
+		if now.Add(leeway).Before(nbf) {
+			return errors.New("token not valid yet")
+		}
+	}
+	if issuer := authenticator.option.Issuer; issuer != "" && claims["iss"] != issuer {
+		return errors.New("invalid token issuer")
+	}
+	if audience := authenticator.option.Audience; audience != "" && !contains(claimStrings(claims["aud"], ""), audience) {
+		return errors.New("invalid token audience")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func hashFunc(alg string) func() hash.Hash {
+	switch alg[2:] {
+	case "384":
+		return sha512.New384
+	case "512":
+		return sha512.New
+	}
+	return sha256.New
+}
+
+func cryptoHash(alg string) crypto.Hash {
+	switch alg[2:] {
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// claimTime 读取NumericDate
+func claimTime(v interface{}) (time.Time, bool) {
+	number, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// claimStrings 读取字符串数组，值为字符串时按sep分隔，sep为空时作为一个值
+func claimStrings(v interface{}, sep string) []string {
+	switch value := v.(type) {
+	case string:
+		if sep == "" {
+			return []string{value}
+		}
+		var values []string
+		for _, s := range strings.Split(value, sep) {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package context
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+)
+
+// BaggageHeader W3C Baggage的头部，格式为 baggage: k1=v1,k2=v2
+const BaggageHeader = "Baggage"
+
+// baggage的默认限制，与W3C Baggage建议的最小支持一致
+const (
+	DefaultBaggageMaxEntries = 64
+	DefaultBaggageMaxBytes   = 8192
+)
+
+// BaggagePolicy 允许传递的baggage和限制，同时决定哪些baggage写入日志和监控
+//
+// 请求头中的baggage来自上游，可能是不可信的客户端，只接受AllowKeys中的key；
+// 面向客户端的服务不设置AllowKeys，在认证之后使用SetBaggage设置，内部的服务设置AllowKeys接受上游传递的值
+type BaggagePolicy struct {
+	// AllowKeys 接受上游请求头中的key，为空时不接受任何baggage，不影响SetBaggage
+	AllowKeys []string
+	// MaxEntries 最多的个数，<=0时为DefaultBaggageMaxEntries
+	MaxEntries int
+	// MaxBytes 序列化之后的最大字节数，<=0时为DefaultBaggageMaxBytes
+	MaxBytes int
+	// LogKeys 写入日志字段的key
+	LogKeys []string
+	// MonitorKeys 作为监控维度的key，会增加时间序列数，只应选择取值有限的key，比如A/B分组
+	MonitorKeys []string
+}
+
+// NewBaggagePolicyWithProfile 使用profile.Baggage创建
+func NewBaggagePolicyWithProfile(cfg *profile.Baggage) *BaggagePolicy {
+	return &BaggagePolicy{
+		AllowKeys:   cfg.AllowKeys,
+		MaxEntries:  cfg.MaxEntries,
+		MaxBytes:    cfg.MaxBytes,
+		LogKeys:     cfg.LogKeys,
+		MonitorKeys: cfg.MonitorKeys,
+	}
+}
+
+// allowed 是否接受上游传递的key
+func (policy *BaggagePolicy) allowed(key string) bool {
+	for _, k := range policy.AllowKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *BaggagePolicy) maxEntries() int {
+	if policy.MaxEntries <= 0 {
+		return DefaultBaggageMaxEntries
+	}
+	return policy.MaxEntries
+}
+
+func (policy *BaggagePolicy) maxBytes() int {
+	if policy.MaxBytes <= 0 {
+		return DefaultBaggageMaxBytes
+	}
+	return policy.MaxBytes
+}
+
+// fits baggage的key是否全部合法并且不超过限制
+func (policy *BaggagePolicy) fits(baggage map[string]string) bool {
+	if len(baggage) > policy.maxEntries() {
+		return false
+	}
+	size := 0
+	for k, v := range baggage {
+		if !validBaggageKey(k) {
+			return false
+		}
+		size += len(encodeBaggageEntry(k, v)) + 1
+	}
+	return size-1 <= policy.maxBytes()
+}
+
+// filter 去掉不合法的key，incoming时同时去掉不接受的key，超过限制时按key的顺序保留
+func (policy *BaggagePolicy) filter(baggage map[string]string, incoming bool) map[string]string {
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		if validBaggageKey(k) && (!incoming || policy.allowed(k)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var (
+		result = make(map[string]string, len(keys))
+		size   int
+	)
+	for _, k := range keys {
+		if len(result) >= policy.maxEntries() {
+			break
+		}
+		n := len(encodeBaggageEntry(k, baggage[k]))
+		if len(result) != 0 {
+			n++ // 分隔的逗号
+		}
+		if size+n > policy.maxBytes() {
+			continue
+		}
+		size += n
+		result[k] = baggage[k]
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+var (
+	baggagePolicy      = &BaggagePolicy{}
+	baggagePolicyMutex sync.RWMutex
+)
+
+// SetBaggagePolicy 设置baggage的策略，通常在服务启动时调用
+func SetBaggagePolicy(policy *BaggagePolicy) {
+	if policy == nil {
+		policy = &BaggagePolicy{}
+	}
+	baggagePolicyMutex.Lock()
+	defer baggagePolicyMutex.Unlock()
+	baggagePolicy = policy
+}
+
+func currentBaggagePolicy() *BaggagePolicy {
+	baggagePolicyMutex.RLock()
+	defer baggagePolicyMutex.RUnlock()
+	return baggagePolicy
+}
+
+type baggageKey struct{}
+
+// WithBaggage 将baggage放入ctx，按当前策略的限制过滤，与SetBaggage一样不检查AllowKeys
+func WithBaggage(ctx context.Context, baggage map[string]string) context.Context {
+	baggage = currentBaggagePolicy().filter(baggage, false)
+	if len(baggage) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, baggageKey{}, baggage)
+}
+
+// BaggageFromContext 读取ctx中的baggage，返回的map不能修改
+func BaggageFromContext(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	baggage, _ := ctx.Value(baggageKey{}).(map[string]string)
+	return baggage
+}
+
+// BaggageLogFields ctx中需要写入日志的baggage，由BaggagePolicy.LogKeys决定
+func BaggageLogFields(ctx context.Context) logrus.Fields {
+	baggage := BaggageFromContext(ctx)
+	if len(baggage) == 0 {
+		return nil
+	}
+	var fields logrus.Fields
+	for _, k := range currentBaggagePolicy().LogKeys {
+		if v, ok := baggage[k]; ok {
+			if fields == nil {
+				fields = logrus.Fields{}
+			}
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// BaggageMonitorTags ctx中作为监控维度的baggage，由BaggagePolicy.MonitorKeys决定
+func BaggageMonitorTags(ctx context.Context) map[string]string {
+	baggage := BaggageFromContext(ctx)
+	if len(baggage) == 0 {
+		return nil
+	}
+	var tags map[string]string
+	for _, k := range currentBaggagePolicy().MonitorKeys {
+		if v, ok := baggage[k]; ok {
+			if tags == nil {
+				tags = map[string]string{}
+			}
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+// ExtractBaggage 解析头部中的baggage，只保留AllowKeys中的key，忽略不合法的项，属性(;之后的部分)不保留
+func ExtractBaggage(header http.Header) map[string]string {
+	values := header[BaggageHeader]
+	if len(values) == 0 {
+		return nil
+	}
+	baggage := map[string]string{}
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			if i := strings.IndexByte(member, ';'); i >= 0 {
+				member = member[:i]
+			}
+			i := strings.IndexByte(member, '=')
+			if i < 0 {
+				continue
+			}
+			k := strings.TrimSpace(member[:i])
+			v, err := url.PathUnescape(strings.TrimSpace(member[i+1:]))
+			if err != nil || !validBaggageKey(k) {
+				continue
+			}
+			baggage[k] = v
+		}
+	}
+	return currentBaggagePolicy().filter(baggage, true)
+}
+
+// InjectBaggage 将baggage写入头部，已有的baggage头部会被替换
+func InjectBaggage(baggage map[string]string, header http.Header) {
+	if len(baggage) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(baggage))
+	for k := range baggage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	members := make([]string, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, encodeBaggageEntry(k, baggage[k]))
+	}
+	header.Set(BaggageHeader, strings.Join(members, ","))
+}
+
+func encodeBaggageEntry(k, v string) string {
+	return k + "=" + url.PathEscape(v)
+}
+
+// validBaggageKey key必须为HTTP的token
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c > '~' || strings.IndexByte("\"(),/:;<=>?@[\\]{}", c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package context
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	logutils "github.com/lworkltd/kits/utils/log"
+	"github.com/sirupsen/logrus"
+)
+
+func TestExtractBaggage(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *BaggagePolicy
+		header string
+		want   map[string]string
+	}{
+		{name: "none", policy: &BaggagePolicy{}},
+		{
+			name:   "empty allow keys",
+			policy: &BaggagePolicy{},
+			header: "tenant_id=t1,user_id=u1",
+		},
+		{
+			name:   "all",
+			policy: &BaggagePolicy{AllowKeys: []string{"tenant_id", "user_id", "ab_bucket"}},
+			header: "tenant_id=t1, user_id = u%201;ttl=10,ab_bucket=b",
+			want:   map[string]string{"tenant_id": "t1", "user_id": "u 1", "ab_bucket": "b"},
+		},
+		{
+			name:   "allow keys",
+			policy: &BaggagePolicy{AllowKeys: []string{"tenant_id"}},
+			header: "tenant_id=t1,user_id=u1",
+			want:   map[string]string{"tenant_id": "t1"},
+		},
+		{
+			name:   "invalid",
+			policy: &BaggagePolicy{AllowKeys: []string{"tenant id", "user_id", "ab_bucket", "key"}},
+			header: "tenant id=t1,user_id,ab_bucket=%zz,key=v",
+			want:   map[string]string{"key": "v"},
+		},
+		{
+			name:   "max entries",
+			policy: &BaggagePolicy{AllowKeys: []string{"a", "b", "c"}, MaxEntries: 2},
+			header: "c=3,a=1,b=2",
+			want:   map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:   "max bytes",
+			policy: &BaggagePolicy{AllowKeys: []string{"a", "b", "c"}, MaxBytes: 10},
+			header: "a=1,b=" + strings.Repeat("x", 10) + ",c=3",
+			want:   map[string]string{"a": "1", "c": "3"},
+		},
+	}
+	defer SetBaggagePolicy(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetBaggagePolicy(tt.policy)
+			header := http.Header{}
+			if tt.header != "" {
+				header.Set(BaggageHeader, tt.header)
+			}
+			if got := ExtractBaggage(header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractBaggage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextBaggage(t *testing.T) {
+	SetBaggagePolicy(&BaggagePolicy{
+		AllowKeys:   []string{"tenant_id", "user_id"},
+		MaxEntries:  3,
+		LogKeys:     []string{"tenant_id"},
+		MonitorKeys: []string{"ab_bucket"},
+	})
+	defer SetBaggagePolicy(nil)
+
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = buf
+	logger.Formatter = &logrus.JSONFormatter{}
+	logger.Hooks.Add(logutils.NewTracingLogHook())
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(BaggageHeader, "tenant_id=t1,secret=s")
+	ctx := FromHttpRequest(request, logger)
+	if ctx.Baggage("tenant_id") != "t1" || ctx.Baggage("secret") != "" {
+		t.Fatalf("Baggage() = %v, want tenant_id only", BaggageFromContext(ctx))
+	}
+
+	ctx.SetBaggage("ab_bucket", "b")
+	ctx.SetBaggage("not valid", "x")
+	if ctx.Baggage("ab_bucket") != "b" || ctx.Baggage("not valid") != "" {
+		t.Errorf("SetBaggage() = %v", BaggageFromContext(ctx))
+	}
+
+	sub := ctx.SubContext("sub")
+	sub.SetBaggage("user_id", "u1")
+	sub.SetBaggage("region", "cn")
+	if sub.Baggage("tenant_id") != "t1" || sub.Baggage("ab_bucket") != "b" || ctx.Baggage("user_id") != "" || sub.Baggage("region") != "" {
+		t.Errorf("SubContext baggage = %v, parent = %v", BaggageFromContext(sub), BaggageFromContext(ctx))
+	}
+	from := FromContext(sub, "from", nil)
+	if from.Baggage("user_id") != "u1" {
+		t.Errorf("FromContext baggage = %v", BaggageFromContext(from))
+	}
+
+	header := http.Header{}
+	sub.Inject(header)
+	if got := header.Get(BaggageHeader); got != "ab_bucket=b,tenant_id=t1,user_id=u1" {
+		t.Errorf("Inject() baggage = %q", got)
+	}
+
+	if tags := BaggageMonitorTags(ctx); !reflect.DeepEqual(tags, map[string]string{"ab_bucket": "b"}) {
+		t.Errorf("BaggageMonitorTags() = %v", tags)
+	}
+	buf.Reset()
+	ctx.Info("hello")
+	if !strings.Contains(buf.String(), `"tenant_id":"t1"`) || strings.Contains(buf.String(), "ab_bucket") {
+		t.Errorf("log = %s, want tenant_id field", buf.String())
+	}
+}
+
+func TestEdgeBaggage(t *testing.T) {
+	SetBaggagePolicy(nil)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(BaggageHeader, "tenant_id=forged")
+	ctx := FromHttpRequest(request, nil)
+	if baggage := BaggageFromContext(ctx); baggage != nil {
+		t.Fatalf("Baggage() = %v, want nothing from the client", baggage)
+	}
+
+	ctx.SetBaggage("tenant_id", "t1")
+	header := http.Header{}
+	ctx.Inject(header)
+	if got := header.Get(BaggageHeader); got != "tenant_id=t1" {
+		t.Errorf("Inject() baggage = %q, want tenant_id set by the edge", got)
+	}
+}
@@ -3,6 +3,7 @@ package context
 import (
 	"fmt"
 	"net/http"
+	"sync"
 
 	logutils "github.com/lworkltd/kits/utils/log"
 	"github.com/opentracing/opentracing-go/ext"
@@ -16,7 +17,7 @@ import (
 
 const (
 	TraceIdHeader = "X-B3-Traceid"
-	SpanIdHeader  = "X-B3-Traceid"
+	SpanIdHeader  = "X-B3-Spanid"
 )
 
 type Context interface {
@@ -26,10 +27,19 @@ type Context interface {
 
 	Inject(header http.Header)
 	SubContext(string) Context
+	// RequestId 请求ID，来自请求头X-Request-Id或由服务端生成
+	RequestId() string
+	// SetBaggage 设置随调用链传递的baggage，Inject时写入后继请求，key不合法或超过限制时忽略，不需要在AllowKeys中
+	SetBaggage(key, value string)
+	// Baggage 读取baggage，来自上游的请求或SetBaggage
+	Baggage(key string) string
 }
 
 // FromHttpRequest 从http.Request解析Opentracing的上下文
 // 如果没有解析成功,则创建一个新的上下文
+// 调用链依次从traceparent,b3和X-B3-*解析，都没有时生成一个新的Trace Id
+// 请求ID来自请求头X-Request-Id，未携带时生成一个新的
+// baggage来自请求头baggage，只接受SetBaggagePolicy允许的key
 func FromHttpRequest(request *http.Request, logger logrus.FieldLogger) Context {
 	var sp opentracing.Span
 	name := fmt.Sprintf("http:%s", request.URL.Path)
@@ -37,19 +47,26 @@ func FromHttpRequest(request *http.Request, logger logrus.FieldLogger) Context {
 		opentracing.HTTPHeaders,
 		opentracing.HTTPHeadersCarrier(request.Header))
 	if err != nil {
-		sp = opentracing.StartSpan(name)
+		sp = opentracing.StartSpan(name, ext.SpanKindRPCServer)
 	} else {
 		sp = opentracing.StartSpan(name, ext.RPCServerOption(wireContext))
 	}
+	tagServerSpan(sp, request)
 
 	if logger == nil {
 		logger = &NoopLogger{}
 	}
 
-	return &tracingCtx{
-		Context:     opentracing.ContextWithSpan(context.Background(), sp),
-		FieldLogger: logger,
+	sc, ok := ExtractSpanContext(request.Header)
+	if ok {
+		sc = sc.Child()
+	} else {
+		sc = NewSpanContext()
 	}
+
+	ctx := WithRequestId(context.Background(), RequestIdFromHeader(request.Header))
+	ctx = WithBaggage(ctx, ExtractBaggage(request.Header))
+	return newTracingCtx(ctx, sp, sc, logger)
 }
 
 // New 创建一个全新的context
@@ -60,10 +77,7 @@ func New(name string, logger logrus.FieldLogger) Context {
 		logger = &NoopLogger{}
 	}
 
-	return &tracingCtx{
-		Context:     opentracing.ContextWithSpan(context.Background(), sp),
-		FieldLogger: logger,
-	}
+	return newTracingCtx(context.Background(), sp, NewSpanContext(), logger)
 }
 
 // NewNoopContext 返回一个什么都不干的Context
@@ -75,7 +89,7 @@ func NewNoopContext() Context {
 	}
 }
 
-// FromContext 从一个Context读取Tracing信息,如果不存在则创建一个新的
+// FromContext 从一个Context读取Tracing信息,请求ID,baggage和调用方,如果不存在则创建一个新的
 func FromContext(ctx context.Context, name string, logger logrus.FieldLogger) Context {
 	sp := opentracing.SpanFromContext(ctx)
 	if sp == nil {
@@ -86,10 +100,13 @@ func FromContext(ctx context.Context, name string, logger logrus.FieldLogger) Co
 		logger = &NoopLogger{}
 	}
 
-	return &tracingCtx{
-		Context:     opentracing.ContextWithSpan(context.Background(), sp),
-		FieldLogger: logger,
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok {
+		sc = NewSpanContext()
 	}
+
+	base := WithBaggage(WithRequestId(context.Background(), RequestIdFromContext(ctx)), BaggageFromContext(ctx))
+	return WithPrincipal(newTracingCtx(base, sp, sc, logger), PrincipalFromContext(ctx))
 }
 
 var (
@@ -103,13 +120,72 @@ type Tracer interface {
 	Finish()
 	TracingId() string
 	SpanId() string
+	// SetTag 设置当前Span的标签，比如SpanTagHTTPRoute
+	SetTag(key string, value interface{})
+	// SetError 标记当前Span失败，记录失败的信息和mcode
+	SetError(err error)
 }
 
 type tracingCtx struct {
 	context.Context
 	logrus.FieldLogger
-	tracingId string
-	spanId    string
+	span SpanContext
+
+	// baggage 写时复制，读取到的map不会再被修改
+	baggageMutex sync.RWMutex
+	baggage      map[string]string
+}
+
+// newTracingCtx 创建携带OpenTracing Span和调用链标识的上下文
+func newTracingCtx(ctx context.Context, sp opentracing.Span, sc SpanContext, logger logrus.FieldLogger) *tracingCtx {
+	sc = adoptTracer(sp, sc)
+	return &tracingCtx{
+		Context:     opentracing.ContextWithSpan(WithSpanContext(ctx, sc), sp),
+		FieldLogger: logger,
+		span:        sc,
+		baggage:     BaggageFromContext(ctx),
+	}
+}
+
+// Value baggage可以被SetBaggage修改，由tracingCtx自己保存
+func (ctx *tracingCtx) Value(key interface{}) interface{} {
+	if _, ok := key.(baggageKey); ok {
+		if baggage := ctx.baggages(); len(baggage) != 0 {
+			return baggage
+		}
+		return nil
+	}
+	return ctx.Context.Value(key)
+}
+
+func (ctx *tracingCtx) baggages() map[string]string {
+	ctx.baggageMutex.RLock()
+	defer ctx.baggageMutex.RUnlock()
+	return ctx.baggage
+}
+
+// SetBaggage 设置baggage，只影响之后创建的子Context和后继请求
+func (ctx *tracingCtx) SetBaggage(key, value string) {
+	ctx.baggageMutex.Lock()
+	baggage := make(map[string]string, len(ctx.baggage)+1)
+	for k, v := range ctx.baggage {
+		baggage[k] = v
+	}
+	baggage[key] = value
+	ok := currentBaggagePolicy().fits(baggage)
+	if ok {
+		ctx.baggage = baggage
+	}
+	ctx.baggageMutex.Unlock()
+
+	if !ok {
+		ctx.FieldLogger.WithFields(contextLogFields(ctx)).WithField("baggage", key).Warn("Baggage key is invalid or exceeds the limits")
+	}
+}
+
+// Baggage 读取baggage
+func (ctx *tracingCtx) Baggage(key string) string {
+	return ctx.baggages()[key]
 }
 
 // Finish 结束当前Tracing Span
@@ -117,12 +193,22 @@ func (ctx *tracingCtx) Finish() {
 	opentracing.SpanFromContext(ctx.Context).Finish()
 }
 
-// Inject 将tracing信息注入Http的头部，用于网间传输
+// Inject 将tracing信息和请求ID注入Http的头部，用于网间传输
 func (ctx *tracingCtx) Inject(header http.Header) {
 	opentracing.GlobalTracer().Inject(
 		opentracing.SpanFromContext(ctx.Context).Context(),
 		opentracing.HTTPHeaders,
 		opentracing.HTTPHeadersCarrier(header))
+	InjectSpanContext(ctx.span, header)
+	InjectBaggage(ctx.baggages(), header)
+	if requestId := ctx.RequestId(); requestId != "" {
+		header.Set(RequestIdHeader, requestId)
+	}
+}
+
+// RequestId 获取请求ID
+func (ctx *tracingCtx) RequestId() string {
+	return RequestIdFromContext(ctx.Context)
 }
 
 // SubContext 启用一个子Span
@@ -133,40 +219,19 @@ func (ctx *tracingCtx) SubContext(name string) Context {
 			opentracing.SpanFromContext(ctx.Context).Context(),
 		),
 	)
-	return &tracingCtx{
-		Context:     opentracing.ContextWithSpan(ctx.Context, sp),
-		FieldLogger: ctx.FieldLogger,
-	}
+	sub := newTracingCtx(ctx.Context, sp, ctx.span.Child(), ctx.FieldLogger)
+	sub.baggage = ctx.baggages()
+	return sub
 }
 
-// TracingId 获取当前的Tracing
+// TracingId 获取当前的Tracing Id，没有配置Tracer时使用生成的Id
 func (ctx *tracingCtx) TracingId() string {
-	if ctx.tracingId == "" {
-		headers := http.Header{}
-		ctx.Inject(headers)
-		headerValues, exist := headers[TraceIdHeader]
-		if !exist {
-			return ""
-		}
-		if len(headerValues) < 1 {
-			return ""
-		}
-
-		ctx.tracingId = headerValues[0]
-	}
-
-	return ctx.tracingId
+	return ctx.span.TraceId
 }
 
 // SpanId 获取当前的Span Id
 func (ctx *tracingCtx) SpanId() string {
-	if ctx.spanId == "" {
-		headers := http.Header{}
-		ctx.Inject(headers)
-		ctx.spanId = headers[SpanIdHeader][0]
-	}
-
-	return ctx.spanId
+	return ctx.span.SpanId
 }
 
 var directLogFields = logrus.Fields{
@@ -174,9 +239,13 @@ var directLogFields = logrus.Fields{
 }
 
 func contextLogFields(ctx context.Context) logrus.Fields {
-	return logrus.Fields{
+	fields := logrus.Fields{
 		logutils.ContextTag: ctx,
 	}
+	for k, v := range BaggageLogFields(ctx) {
+		fields[k] = v
+	}
+	return fields
 }
 func (ctx *tracingCtx) WithField(key string, value interface{}) *logrus.Entry {
 	return ctx.FieldLogger.WithFields(contextLogFields(ctx)).WithField(key, value)
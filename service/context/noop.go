@@ -21,6 +21,9 @@ func (tracer *NoopTracer) Finish()            {}
 func (tracer *NoopTracer) Inject(http.Header) {}
 func (tracer *NoopTracer) TracingId() string  { return "" }
 func (tracer *NoopTracer) SpanId() string     { return "" }
+
+func (tracer *NoopTracer) SetTag(key string, value interface{}) {}
+func (tracer *NoopTracer) SetError(err error)                   {}
 func (ctx *NoopContext) SubContext(string) Context {
 	return &NoopContext{
 		FieldLogger: &NoopLogger{},
@@ -30,6 +33,10 @@ func (ctx *NoopContext) SubContext(string) Context {
 }
 func (ctx *NoopContext) Inject(http.Header) {}
 
+func (ctx *NoopContext) RequestId() string            { return "" }
+func (ctx *NoopContext) SetBaggage(key, value string) {}
+func (ctx *NoopContext) Baggage(key string) string    { return "" }
+
 type NoopLogger struct {
 }
 
@@ -0,0 +1,72 @@
+package context
+
+import (
+	"golang.org/x/net/context"
+)
+
+// Principal 通过认证的调用方
+type Principal struct {
+	// Subject 调用方的标识，比如JWT的sub，签名或API Key的名称
+	Subject string
+	// Method 认证方式，比如jwt,hmac,apikey
+	Method string
+	Scopes []string
+	Roles  []string
+	// Claims JWT中的所有声明，其他认证方式为nil
+	Claims map[string]interface{}
+}
+
+// HasScope 是否拥有scope
+func (principal *Principal) HasScope(scope string) bool {
+	return principal != nil && contains(principal.Scopes, scope)
+}
+
+// HasRole 是否拥有role
+func (principal *Principal) HasRole(role string) bool {
+	return principal != nil && contains(principal.Roles, role)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// principalCtx 携带调用方的Context，子Context同样携带
+type principalCtx struct {
+	Context
+	principal *Principal
+}
+
+func (ctx *principalCtx) Value(key interface{}) interface{} {
+	if key == (principalKey{}) {
+		return ctx.principal
+	}
+	return ctx.Context.Value(key)
+}
+
+func (ctx *principalCtx) SubContext(name string) Context {
+	return WithPrincipal(ctx.Context.SubContext(name), ctx.principal)
+}
+
+// WithPrincipal 返回携带调用方的Context
+func WithPrincipal(ctx Context, principal *Principal) Context {
+	if principal == nil {
+		return ctx
+	}
+	return &principalCtx{Context: ctx, principal: principal}
+}
+
+// PrincipalFromContext 读取ctx中的调用方，未认证时返回nil
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
@@ -0,0 +1,40 @@
+package context
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestWithPrincipal(t *testing.T) {
+	principal := &Principal{Subject: "user-1", Scopes: []string{"order:read"}, Roles: []string{"admin"}}
+	ctx := WithPrincipal(New("test", nil), principal)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "context", ctx: ctx},
+		{name: "sub context", ctx: ctx.SubContext("sub")},
+		{name: "from context", ctx: FromContext(ctx, "from", nil)},
+		{name: "std context", ctx: context.WithValue(ctx, "k", "v")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrincipalFromContext(tt.ctx); got != principal {
+				t.Errorf("PrincipalFromContext() = %v, want %v", got, principal)
+			}
+		})
+	}
+
+	if PrincipalFromContext(New("anonymous", nil)) != nil || PrincipalFromContext(nil) != nil {
+		t.Errorf("PrincipalFromContext() should be nil without principal")
+	}
+	if !principal.HasScope("order:read") || principal.HasScope("order:write") || !principal.HasRole("admin") {
+		t.Errorf("HasScope/HasRole mismatch")
+	}
+	var anonymous *Principal
+	if anonymous.HasRole("admin") {
+		t.Errorf("nil principal should have no role")
+	}
+}
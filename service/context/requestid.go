@@ -0,0 +1,63 @@
+package context
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"golang.org/x/net/context"
+)
+
+// RequestIdHeader 请求ID的头部，未携带时由服务端生成
+const RequestIdHeader = "X-Request-Id"
+
+// maxRequestIdLength 接受的请求ID的最大长度，超过或包含非法字符时重新生成
+const maxRequestIdLength = 128
+
+type requestIdKey struct{}
+
+// WithRequestId 将请求ID放入ctx
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	if requestId == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFromContext 读取ctx中的请求ID，不存在时返回空
+func RequestIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// NewRequestId 生成一个新的请求ID，32位的十六进制字符串
+func NewRequestId() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIdFromHeader 读取请求头中的请求ID，不存在或不合法时生成一个新的
+func RequestIdFromHeader(header http.Header) string {
+	requestId := header.Get(RequestIdHeader)
+	if !validRequestId(requestId) {
+		return NewRequestId()
+	}
+	return requestId
+}
+
+// validRequestId 只接受可见的ASCII字符，避免日志注入
+func validRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(requestId); i++ {
+		if requestId[i] <= ' ' || requestId[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
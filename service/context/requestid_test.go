@@ -0,0 +1,54 @@
+package context
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestIdFromHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "accept", incoming: "5f0c1c9e-1f4b-4a5e-9a9e-0d8e7e6b1a2c", keep: true},
+		{name: "missing", incoming: ""},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIdLength+1)},
+		{name: "control characters", incoming: "abc\ndef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set(RequestIdHeader, tt.incoming)
+			got := RequestIdFromHeader(header)
+			if tt.keep && got != tt.incoming {
+				t.Errorf("RequestIdFromHeader() = %v, want %v", got, tt.incoming)
+			}
+			if !tt.keep && (got == tt.incoming || len(got) != 32) {
+				t.Errorf("RequestIdFromHeader() = %v, want a generated id", got)
+			}
+		})
+	}
+}
+
+func TestFromHttpRequestRequestId(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set(RequestIdHeader, "req-1")
+	ctx := FromHttpRequest(request, nil)
+	if ctx.RequestId() != "req-1" {
+		t.Errorf("RequestId() = %v, want req-1", ctx.RequestId())
+	}
+	if sub := ctx.SubContext("sub"); sub.RequestId() != "req-1" {
+		t.Errorf("SubContext().RequestId() = %v, want req-1", sub.RequestId())
+	}
+	if from := FromContext(ctx, "from", nil); from.RequestId() != "req-1" {
+		t.Errorf("FromContext().RequestId() = %v, want req-1", from.RequestId())
+	}
+
+	header := http.Header{}
+	ctx.Inject(header)
+	if header.Get(RequestIdHeader) != "req-1" {
+		t.Errorf("Inject() request id = %v, want req-1", header.Get(RequestIdHeader))
+	}
+}
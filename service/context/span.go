@@ -0,0 +1,88 @@
+package context
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Span的标签，其余的使用opentracing-go/ext中的定义
+const (
+	SpanTagHTTPRoute    = "http.route"    // 注册的路径，比如/v1/user/:id
+	SpanTagMcode        = "mcode"         // 错误码
+	SpanTagErrorMessage = "error.message" // 失败的信息，与error标签同时设置
+)
+
+// SetSpanError 标记Span失败，err为code.Error时同时记录mcode
+func SetSpanError(sp opentracing.Span, err error) {
+	if sp == nil || err == nil {
+		return
+	}
+	message := err.Error()
+	if m, ok := err.(interface{ Message() string }); ok {
+		message = m.Message()
+	}
+	ext.Error.Set(sp, true)
+	sp.SetTag(SpanTagErrorMessage, message)
+	if m, ok := err.(interface{ Mcode() string }); ok && m.Mcode() != "" {
+		sp.SetTag(SpanTagMcode, m.Mcode())
+	}
+}
+
+// SetSpanURL 设置http.url，不包含查询参数和用户信息，避免token，签名等敏感信息上报到Tracing后端
+func SetSpanURL(sp opentracing.Span, u *url.URL) {
+	if sp == nil || u == nil {
+		return
+	}
+	ext.HTTPUrl.Set(sp, (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}).String())
+}
+
+// SetSpanPeer 设置对端的服务名和地址，地址为IPv4时同时设置peer.ipv4和peer.port
+func SetSpanPeer(sp opentracing.Span, service, address string) {
+	if sp == nil {
+		return
+	}
+	if service != "" {
+		ext.PeerService.Set(sp, service)
+	}
+	if address == "" {
+		return
+	}
+	ext.PeerAddress.Set(sp, address)
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		ext.PeerHostIPv4.SetString(sp, host)
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+		ext.PeerPort.Set(sp, uint16(p))
+	}
+}
+
+// tagServerSpan 服务端Span的标签，http.route和http.status_code在处理完成之后设置
+func tagServerSpan(sp opentracing.Span, request *http.Request) {
+	ext.SpanKindRPCServer.Set(sp)
+	ext.HTTPMethod.Set(sp, request.Method)
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	SetSpanURL(sp, &url.URL{Scheme: scheme, Host: request.Host, Path: request.URL.Path, RawPath: request.URL.RawPath})
+	SetSpanPeer(sp, "", request.RemoteAddr)
+}
+
+// SetTag 设置当前Span的标签
+func (ctx *tracingCtx) SetTag(key string, value interface{}) {
+	opentracing.SpanFromContext(ctx.Context).SetTag(key, value)
+}
+
+// SetError 标记当前Span失败
+func (ctx *tracingCtx) SetError(err error) {
+	SetSpanError(opentracing.SpanFromContext(ctx.Context), err)
+}
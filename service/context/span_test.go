@@ -0,0 +1,74 @@
+package context
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	logutils "github.com/lworkltd/kits/utils/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/sirupsen/logrus"
+)
+
+type mcodeError struct{}
+
+func (mcodeError) Error() string   { return "USER_NOT_FOUND:user not found" }
+func (mcodeError) Mcode() string   { return "USER_NOT_FOUND" }
+func (mcodeError) Message() string { return "user not found" }
+
+func TestServerSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	logutils.AddTracingLogHook(logger)
+
+	request, _ := http.NewRequest("POST", "http://example.com/v1/users?id=1&access_token=secret", nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	ctx := FromHttpRequest(request, logger)
+	ctx.WithField("user", "u1").Warn("user not found")
+	sub := ctx.SubContext("query")
+	sub.SetError(mcodeError{})
+	sub.Finish()
+	ctx.Finish()
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("finished spans = %d, want 2", len(spans))
+	}
+	tags := spans[1].Tags()
+	want := map[string]interface{}{
+		"span.kind":    ext.SpanKindRPCServerEnum,
+		"http.method":  "POST",
+		"http.url":     "http://example.com/v1/users",
+		"peer.address": "10.0.0.1:5000",
+		"peer.ipv4":    "10.0.0.1",
+		"peer.port":    uint16(5000),
+	}
+	for k, v := range want {
+		if tags[k] != v {
+			t.Errorf("server span tag %s = %v, want %v", k, tags[k], v)
+		}
+	}
+
+	logs := spans[1].Logs()
+	if len(logs) != 1 {
+		t.Fatalf("server span logs = %v, want 1", logs)
+	}
+	fields := map[string]string{}
+	for _, field := range logs[0].Fields {
+		fields[field.Key] = field.ValueString
+	}
+	if fields["message"] != "user not found" || fields["level"] != "warning" || fields["user"] != "u1" {
+		t.Errorf("server span log = %v", fields)
+	}
+
+	tags = spans[0].Tags()
+	if tags["error"] != true || tags[SpanTagErrorMessage] != "user not found" || tags[SpanTagMcode] != "USER_NOT_FOUND" {
+		t.Errorf("sub span tags = %v", tags)
+	}
+}
@@ -0,0 +1,371 @@
+package context
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
+)
+
+// 调用链传递的头部
+const (
+	TraceparentHeader  = "Traceparent" // W3C Trace Context
+	TracestateHeader   = "Tracestate"
+	B3Header           = "B3" // B3单头部格式
+	ParentSpanIdHeader = "X-B3-Parentspanid"
+	SampledHeader      = "X-B3-Sampled"
+	FlagsHeader        = "X-B3-Flags"
+)
+
+const (
+	maxTracestateLength   = 512
+	traceparentVersion    = "00"
+	traceparentFlagSample = 0x01
+)
+
+// SpanContext 调用链中一个Span的标识，不依赖OpenTracing的Tracer
+type SpanContext struct {
+	TraceId    string // 32位十六进制，来自B3的64位Trace Id保持16位
+	SpanId     string // 16位十六进制
+	ParentId   string // 上游的Span Id，根Span为空
+	Sampled    bool
+	TraceState string // W3C的tracestate，原样传递
+}
+
+// IsValid Trace Id和Span Id是否合法
+func (sc SpanContext) IsValid() bool {
+	return isHexId(sc.TraceId, 16, 32) && isHexId(sc.SpanId, 16, 16)
+}
+
+// Child 创建子Span，Trace Id不变
+func (sc SpanContext) Child() SpanContext {
+	return SpanContext{
+		TraceId:    sc.TraceId,
+		SpanId:     NewSpanId(),
+		ParentId:   sc.SpanId,
+		Sampled:    sc.Sampled,
+		TraceState: sc.TraceState,
+	}
+}
+
+// NewSpanContext 创建一个新的调用链的根Span
+func NewSpanContext() SpanContext {
+	return SpanContext{
+		TraceId: NewTraceId(),
+		SpanId:  NewSpanId(),
+		Sampled: true,
+	}
+}
+
+var (
+	idRand  = rand.New(rand.NewSource(seed()))
+	idMutex sync.Mutex
+)
+
+func seed() int64 {
+	var b [8]byte
+	crand.Read(b[:])
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
+// randomId 生成n字节的非零随机Id，使用伪随机数即可，不需要加密强度
+func randomId(n int) string {
+	b := make([]byte, n)
+	idMutex.Lock()
+	for {
+		idRand.Read(b)
+		if !allZero(b) {
+			break
+		}
+	}
+	idMutex.Unlock()
+	return hex.EncodeToString(b)
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NewTraceId 生成一个新的Trace Id，32位的十六进制字符串
+func NewTraceId() string {
+	return randomId(16)
+}
+
+// NewSpanId 生成一个新的Span Id，16位的十六进制字符串
+func NewSpanId() string {
+	return randomId(8)
+}
+
+// isHexId 是否为长度在min和max之间的小写十六进制字符串，全0不合法
+func isHexId(id string, min, max int) bool {
+	if len(id) < min || len(id) > max {
+		return false
+	}
+	zero := true
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+		if c != '0' {
+			zero = false
+		}
+	}
+	return !zero
+}
+
+// Propagator 调用链在HTTP头部中的传递格式
+type Propagator interface {
+	// Extract 解析头部，没有或不合法时返回false
+	Extract(header http.Header) (SpanContext, bool)
+	Inject(sc SpanContext, header http.Header)
+}
+
+// 内置的传递格式
+var (
+	// TraceContext W3C的traceparent和tracestate
+	TraceContext Propagator = traceContextPropagator{}
+	// B3Single B3的单头部格式，b3: {TraceId}-{SpanId}-{Sampled}-{ParentSpanId}
+	B3Single Propagator = b3SinglePropagator{}
+	// B3Multi B3的多头部格式，X-B3-TraceId,X-B3-SpanId等
+	B3Multi Propagator = b3MultiPropagator{}
+)
+
+var (
+	propagators      = []Propagator{TraceContext, B3Multi}
+	propagatorsMutex sync.RWMutex
+)
+
+// SetPropagators 设置注入到后继请求的格式，默认为TraceContext和B3Multi
+//
+// 解析时总是依次尝试设置的格式和所有内置的格式
+func SetPropagators(ps ...Propagator) {
+	propagatorsMutex.Lock()
+	defer propagatorsMutex.Unlock()
+	propagators = ps
+}
+
+// PropagatorByName 按名称返回内置的格式，名称为tracecontext,b3,b3multi
+func PropagatorByName(name string) (Propagator, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "tracecontext", "w3c":
+		return TraceContext, nil
+	case "b3":
+		return B3Single, nil
+	case "b3multi":
+		return B3Multi, nil
+	}
+	return nil, fmt.Errorf("unknown trace propagator %q", name)
+}
+
+func currentPropagators() []Propagator {
+	propagatorsMutex.RLock()
+	defer propagatorsMutex.RUnlock()
+	return propagators
+}
+
+// ExtractSpanContext 从头部解析上游的Span
+func ExtractSpanContext(header http.Header) (SpanContext, bool) {
+	for _, ps := range [][]Propagator{currentPropagators(), {TraceContext, B3Single, B3Multi}} {
+		for _, p := range ps {
+			if sc, ok := p.Extract(header); ok {
+				return sc, true
+			}
+		}
+	}
+	return SpanContext{}, false
+}
+
+// InjectSpanContext 使用设置的格式将Span注入头部
+func InjectSpanContext(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	for _, p := range currentPropagators() {
+		p.Inject(sc, header)
+	}
+}
+
+type spanContextKey struct{}
+
+// WithSpanContext 将Span放入ctx
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 读取ctx中的Span
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// InjectTrace 将ctx中的调用链和baggage注入后继请求的头部，包括OpenTracing的Span
+func InjectTrace(ctx context.Context, header http.Header) {
+	if ctx == nil {
+		return
+	}
+	if sc, ok := SpanContextFromContext(ctx); ok {
+		InjectSpanContext(sc, header)
+	}
+	InjectBaggage(BaggageFromContext(ctx), header)
+	// Tracer的Span可能是调用方的子Span，由Tracer覆盖它使用的头部
+	if sp := opentracing.SpanFromContext(ctx); sp != nil {
+		opentracing.GlobalTracer().Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	}
+}
+
+// adoptTracer 配置了OpenTracing的Tracer时，使用Tracer生成的Id，保证日志和Tracing后端中的Id一致
+func adoptTracer(sp opentracing.Span, sc SpanContext) SpanContext {
+	if _, noop := opentracing.GlobalTracer().(opentracing.NoopTracer); noop || sp == nil {
+		return sc
+	}
+	header := http.Header{}
+	if err := sp.Tracer().Inject(sp.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+		return sc
+	}
+	for _, p := range []Propagator{TraceContext, B3Single, B3Multi} {
+		if tsc, ok := p.Extract(header); ok {
+			if tsc.ParentId == "" {
+				tsc.ParentId = sc.ParentId
+			}
+			if tsc.TraceState == "" {
+				tsc.TraceState = sc.TraceState
+			}
+			return tsc
+		}
+	}
+	return sc
+}
+
+type traceContextPropagator struct{}
+
+// Extract 解析 traceparent: {version}-{trace-id}-{parent-id}-{flags}
+func (traceContextPropagator) Extract(header http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header.Get(TraceparentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// 00版本只有4段，更高的版本可以在后面追加
+	if parts[0] == traceparentVersion && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	if len(parts[1]) != 32 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{
+		TraceId: parts[1],
+		SpanId:  parts[2],
+		Sampled: flags[0]&traceparentFlagSample != 0,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	if state := strings.Join(header[TracestateHeader], ","); len(state) <= maxTracestateLength {
+		sc.TraceState = state
+	}
+	return sc, true
+}
+
+func (traceContextPropagator) Inject(sc SpanContext, header http.Header) {
+	var flags byte
+	if sc.Sampled {
+		flags |= traceparentFlagSample
+	}
+	// B3的64位Trace Id在左侧补0
+	traceId := strings.Repeat("0", 32-len(sc.TraceId)) + sc.TraceId
+	header.Set(TraceparentHeader, fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, traceId, sc.SpanId, flags))
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+type b3SinglePropagator struct{}
+
+// Extract 解析 b3: {TraceId}-{SpanId}-{Sampled}-{ParentSpanId}，只有采样标记时返回false
+func (b3SinglePropagator) Extract(header http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header.Get(B3Header)), "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return SpanContext{}, false
+	}
+	sc := SpanContext{TraceId: parts[0], SpanId: parts[1], Sampled: true}
+	if len(parts) > 2 {
+		switch parts[2] {
+		case "1", "d":
+		case "0":
+			sc.Sampled = false
+		default:
+			return SpanContext{}, false
+		}
+	}
+	if len(parts) > 3 {
+		if !isHexId(parts[3], 16, 16) {
+			return SpanContext{}, false
+		}
+		sc.ParentId = parts[3]
+	}
+	return sc, sc.IsValid()
+}
+
+func (b3SinglePropagator) Inject(sc SpanContext, header http.Header) {
+	value := sc.TraceId + "-" + sc.SpanId + "-" + b3Sampled(sc.Sampled)
+	if sc.ParentId != "" {
+		value += "-" + sc.ParentId
+	}
+	header.Set(B3Header, value)
+}
+
+type b3MultiPropagator struct{}
+
+func (b3MultiPropagator) Extract(header http.Header) (SpanContext, bool) {
+	sc := SpanContext{
+		TraceId: strings.TrimSpace(header.Get(TraceIdHeader)),
+		SpanId:  strings.TrimSpace(header.Get(SpanIdHeader)),
+		Sampled: true,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	if parentId := header.Get(ParentSpanIdHeader); isHexId(parentId, 16, 16) {
+		sc.ParentId = parentId
+	}
+	switch strings.ToLower(header.Get(SampledHeader)) {
+	case "0", "false":
+		sc.Sampled = header.Get(FlagsHeader) == "1"
+	}
+	return sc, true
+}
+
+func (b3MultiPropagator) Inject(sc SpanContext, header http.Header) {
+	header.Set(TraceIdHeader, sc.TraceId)
+	header.Set(SpanIdHeader, sc.SpanId)
+	if sc.ParentId != "" {
+		header.Set(ParentSpanIdHeader, sc.ParentId)
+	}
+	header.Set(SampledHeader, b3Sampled(sc.Sampled))
+}
+
+func b3Sampled(sampled bool) string {
+	if sampled {
+		return "1"
+	}
+	return "0"
+}
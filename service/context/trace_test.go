@@ -0,0 +1,130 @@
+package context
+
+import (
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestExtractSpanContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   SpanContext
+		wantOk bool
+	}{
+		{name: "none", header: map[string]string{}},
+		{
+			name:   "traceparent",
+			header: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate": "congo=t61rcWkgMzE"},
+			want:   SpanContext{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7", Sampled: true, TraceState: "congo=t61rcWkgMzE"},
+			wantOk: true,
+		},
+		{
+			name:   "traceparent not sampled",
+			header: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			want:   SpanContext{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7"},
+			wantOk: true,
+		},
+		{name: "traceparent zero trace id", header: map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+		{name: "traceparent bad version", header: map[string]string{"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		{name: "traceparent upper case", header: map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"}},
+		{
+			name:   "b3 single",
+			header: map[string]string{"b3": "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0-05e3ac9a4f6e3b90"},
+			want:   SpanContext{TraceId: "80f198ee56343ba864fe8b2a57d3eff7", SpanId: "e457b5a2e4d86bd1", ParentId: "05e3ac9a4f6e3b90"},
+			wantOk: true,
+		},
+		{name: "b3 single deny only", header: map[string]string{"b3": "0"}},
+		{
+			name:   "b3 multi",
+			header: map[string]string{"X-B3-TraceId": "463ac35c9f6413ad", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-ParentSpanId": "0020000000000001", "X-B3-Sampled": "1"},
+			want:   SpanContext{TraceId: "463ac35c9f6413ad", SpanId: "a2fb4a1d1a96d312", ParentId: "0020000000000001", Sampled: true},
+			wantOk: true,
+		},
+		{
+			name:   "traceparent first",
+			header: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "X-B3-TraceId": "463ac35c9f6413ad", "X-B3-SpanId": "a2fb4a1d1a96d312"},
+			want:   SpanContext{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7", Sampled: true},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			got, ok := ExtractSpanContext(header)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("ExtractSpanContext() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestPropagatorRoundTrip(t *testing.T) {
+	sc := NewSpanContext().Child()
+	for _, name := range []string{"tracecontext", "b3", "b3multi"} {
+		p, err := PropagatorByName(name)
+		if err != nil {
+			t.Fatalf("PropagatorByName(%s) error = %v", name, err)
+		}
+		header := http.Header{}
+		p.Inject(sc, header)
+		got, ok := p.Extract(header)
+		if !ok || got.TraceId != sc.TraceId || got.SpanId != sc.SpanId || got.Sampled != sc.Sampled {
+			t.Errorf("%s round trip = %+v, want %+v", name, got, sc)
+		}
+	}
+
+	// B3的64位Trace Id在traceparent中补0
+	header := http.Header{}
+	TraceContext.Inject(SpanContext{TraceId: "463ac35c9f6413ad", SpanId: "a2fb4a1d1a96d312", Sampled: true}, header)
+	if got := header.Get(TraceparentHeader); got != "00-0000000000000000463ac35c9f6413ad-a2fb4a1d1a96d312-01" {
+		t.Errorf("traceparent = %s", got)
+	}
+}
+
+func TestTracingIdWithoutTracer(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/", nil)
+	ctx := FromHttpRequest(request, nil)
+	if len(ctx.TracingId()) != 32 || len(ctx.SpanId()) != 16 {
+		t.Fatalf("TracingId() = %q, SpanId() = %q", ctx.TracingId(), ctx.SpanId())
+	}
+
+	sub := ctx.SubContext("sub")
+	if sub.TracingId() != ctx.TracingId() || sub.SpanId() == ctx.SpanId() {
+		t.Errorf("SubContext() trace = %s/%s, parent %s/%s", sub.TracingId(), sub.SpanId(), ctx.TracingId(), ctx.SpanId())
+	}
+	if from := FromContext(sub, "from", nil); from.TracingId() != ctx.TracingId() || from.SpanId() != sub.SpanId() {
+		t.Errorf("FromContext() trace = %s/%s", from.TracingId(), from.SpanId())
+	}
+	if New("new", nil).TracingId() == ctx.TracingId() {
+		t.Errorf("New() should start a new trace")
+	}
+
+	header := http.Header{}
+	sub.Inject(header)
+	if header.Get(TraceparentHeader) != "00-"+ctx.TracingId()+"-"+sub.SpanId()+"-01" || header.Get(TraceIdHeader) != ctx.TracingId() ||
+		header.Get(ParentSpanIdHeader) != ctx.SpanId() {
+		t.Errorf("Inject() = %v", header)
+	}
+
+	// 上游的Span作为父Span
+	request.Header = header
+	downstream := FromHttpRequest(request, nil)
+	if downstream.TracingId() != ctx.TracingId() || downstream.SpanId() == sub.SpanId() {
+		t.Errorf("downstream trace = %s/%s", downstream.TracingId(), downstream.SpanId())
+	}
+	if sc, _ := SpanContextFromContext(downstream); sc.ParentId != sub.SpanId() {
+		t.Errorf("downstream parent = %s, want %s", sc.ParentId, sub.SpanId())
+	}
+
+	header = http.Header{}
+	InjectTrace(context.Background(), header)
+	if len(header) != 0 {
+		t.Errorf("InjectTrace() without trace = %v", header)
+	}
+}
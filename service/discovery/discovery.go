@@ -2,16 +2,14 @@ package discovery
 
 import (
 	"fmt"
-
-	"github.com/lworkltd/kits/helper/consul"
 )
 
 // DiscoverImpl 是服务发现的实现
 type DiscoverImpl struct {
 	seacher    func(string) ([]string, []string, error)
 	static     func(string) ([]string, []string, error)
-	register   func(*consul.RegisterOption) error
-	unregister func(*consul.RegisterOption) error
+	register   func(*Registration) error
+	unregister func(*Registration) error
 }
 
 // Discover 发现服务
@@ -31,19 +29,19 @@ func (discovery *DiscoverImpl) Discover(service string) ([]string, []string, err
 }
 
 // Register 注册服务
-func (discovery *DiscoverImpl) Register(option *consul.RegisterOption) error {
+func (discovery *DiscoverImpl) Register(registration *Registration) error {
 	if discovery.register == nil {
 		return fmt.Errorf("service register not initialize yet")
 	}
 
-	return discovery.register(option)
+	return discovery.register(registration)
 }
 
 // Unregister 删除服务
-func (discovery *DiscoverImpl) Unregister(option *consul.RegisterOption) error {
+func (discovery *DiscoverImpl) Unregister(registration *Registration) error {
 	if discovery.unregister == nil {
 		return fmt.Errorf("service unregister not initialize yet")
 	}
 
-	return discovery.unregister(option)
+	return discovery.unregister(registration)
 }
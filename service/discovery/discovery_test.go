@@ -10,7 +10,7 @@ import (
 func TestInitDiscovery(t *testing.T) {
 	csl, err := consul.New("10.25.100.164:8500")
 	Init(&Option{
-		SearchFunc: csl.Discover,
+		Registry: NewConsulRegistry(csl),
 	})
 	key := "kits/unittest/hello"
 	value, _, e := csl.KeyValue("kits/unittest/hello")
@@ -19,26 +19,50 @@ func TestInitDiscovery(t *testing.T) {
 		return
 	}
 
-	option := &consul.RegisterOption{
+	registration := &Registration{
 		Name: "kits-test-server",
 		Id:   "kits-test-server-001",
 		Ip:   "localhost",
 		Port: 11111,
 	}
 
-	Register(option)
-	remotes, _, err := Discover(option.Name)
+	Register(registration)
+	remotes, _, err := Discover(registration.Name)
 	if err != nil || len(remotes) != 1 {
 		t.Errorf("expect 1 server got %v ,err=%v", len(remotes), err)
 	}
-	if remotes[0] != fmt.Sprintf("%s:%d", option.Ip, option.Port) {
+	if remotes[0] != fmt.Sprintf("%s:%d", registration.Ip, registration.Port) {
 		t.Errorf("expect localhost:11111 server got %v", remotes[0])
 	}
 
-	Unregister(option)
+	Unregister(registration)
 
-	remotes, _, err = Discover(option.Name)
+	remotes, _, err = Discover(registration.Name)
 	if err != nil || len(remotes) != 1 {
 		t.Errorf("expect 0 server got %v ,err=%v", len(remotes), err)
 	}
 }
+
+func TestRegistrationConsulOption(t *testing.T) {
+	registration := &Registration{
+		Protocol: ProtocolGrpc,
+		Name:     "kits-test-server",
+		Id:       "kits-test-server-001",
+		Ip:       "10.0.0.1",
+		Port:     11111,
+		Tags:     []string{"v1"},
+		Meta:     map[string]string{"version": "1.0.0"},
+	}
+
+	option := registration.ConsulOption()
+	if option.ServerType != consul.ServerTypeGrpc {
+		t.Errorf("expect grpc server type,got %v", option.ServerType)
+	}
+	if option.Name != registration.Name || option.Id != registration.Id ||
+		option.Ip != registration.Ip || option.Port != registration.Port {
+		t.Errorf("registration not converted,got %+v", option)
+	}
+	if option.Meta["version"] != "1.0.0" {
+		t.Errorf("expect meta to be converted,got %v", option.Meta)
+	}
+}
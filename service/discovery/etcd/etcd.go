@@ -0,0 +1,479 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lworkltd/kits/service/discovery"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPrefix  = "/kits/services"
+	defaultTTL     = 10 * time.Second
+	defaultTimeout = 3 * time.Second
+	cacheDuration  = 5 * time.Second
+)
+
+// ErrNoEndpoint 没有配置etcd的地址
+var ErrNoEndpoint = errors.New("etcd endpoint not set")
+
+// Option 创建etcd注册中心的参数
+type Option struct {
+	// Endpoints etcd的地址列表，比如`http://127.0.0.1:2379`，请求失败时依次尝试下一个
+	Endpoints []string
+	// Prefix 服务注册的键前缀，默认`/kits/services`，键的格式为`{Prefix}/{Name}/{Id}`
+	Prefix string
+	// TTL 租约的有效期，默认10s，续约间隔为TTL的三分之一
+	TTL time.Duration
+	// Timeout 单次请求的超时，默认3s
+	Timeout time.Duration
+	// HttpClient 自定义HTTP客户端，比如需要TLS的场景
+	HttpClient *http.Client
+}
+
+// Client 使用etcd v3的HTTP网关实现的注册中心
+// 服务注册在租约上，注册后自动续约，进程退出而未注销时，服务将在租约过期后被删除
+type Client struct {
+	endpoints []string
+	prefix    string
+	ttl       time.Duration
+	cli       *http.Client
+
+	mutex  sync.Mutex
+	leases map[string]*lease
+	cache  map[string]*serviceCache
+}
+
+// lease 记录一个已注册服务的租约
+type lease struct {
+	id   int64
+	key  string
+	stop chan struct{}
+	done chan struct{}
+}
+
+// serviceCache 缓存服务的发现信息
+type serviceCache struct {
+	t     time.Time
+	hosts []string
+	ids   []string
+}
+
+// instance 保存在etcd中的服务信息
+type instance struct {
+	Name     string            `json:"name"`
+	Id       string            `json:"id"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Protocol string            `json:"protocol,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+var _ discovery.Registry = new(Client)
+
+// New 创建一个etcd注册中心
+func New(option *Option) (*Client, error) {
+	if len(option.Endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	endpoints := make([]string, 0, len(option.Endpoints))
+	for _, endpoint := range option.Endpoints {
+		if !strings.HasPrefix(endpoint, "http") {
+			endpoint = "http://" + endpoint
+		}
+		endpoints = append(endpoints, strings.TrimRight(endpoint, "/"))
+	}
+
+	client := &Client{
+		endpoints: endpoints,
+		prefix:    strings.TrimRight(option.Prefix, "/"),
+		ttl:       option.TTL,
+		cli:       option.HttpClient,
+		leases:    make(map[string]*lease, 2),
+		cache:     make(map[string]*serviceCache, 10),
+	}
+	if client.prefix == "" {
+		client.prefix = defaultPrefix
+	}
+	if client.ttl < time.Second {
+		client.ttl = defaultTTL
+	}
+	if client.cli == nil {
+		timeout := option.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		client.cli = &http.Client{Timeout: timeout}
+	}
+
+	return client, nil
+}
+
+func (client *Client) serviceKey(name string) string {
+	return client.prefix + "/" + name + "/"
+}
+
+func (client *Client) instanceKey(name, id string) string {
+	return client.serviceKey(name) + id
+}
+
+// Register 注册服务，并在后台自动续约
+func (client *Client) Register(registration *discovery.Registration) error {
+	if err := checkRegistration(registration); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(&instance{
+		Name:     registration.Name,
+		Id:       registration.Id,
+		Address:  registration.Ip,
+		Port:     registration.Port,
+		Protocol: string(registration.Protocol),
+		Tags:     registration.Tags,
+		Meta:     registration.Meta,
+	})
+	if err != nil {
+		return err
+	}
+
+	key := client.instanceKey(registration.Name, registration.Id)
+
+	// 重复注册时先停止之前的续约，写入新的租约之后撤销之前的租约，避免旧的实例保留到租约过期
+	client.mutex.Lock()
+	old := client.leases[key]
+	delete(client.leases, key)
+	client.mutex.Unlock()
+	if old != nil {
+		close(old.stop)
+		<-old.done
+		defer client.revokeReplaced(old)
+	}
+
+	leaseId, err := client.grant()
+	if err != nil {
+		return err
+	}
+	if err := client.put(key, value, leaseId); err != nil {
+		// 写入失败时撤销租约，避免租约泄漏
+		client.revoke(leaseId)
+		return err
+	}
+
+	l := &lease{
+		id:   leaseId,
+		key:  key,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	client.mutex.Lock()
+	client.leases[key] = l
+	delete(client.cache, registration.Name)
+	client.mutex.Unlock()
+
+	go client.keepAlive(l, value)
+
+	return nil
+}
+
+// revokeReplaced 撤销被重复注册替换的租约，失败时等待租约过期
+func (client *Client) revokeReplaced(old *lease) {
+	if err := client.revoke(old.id); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"key":   old.key,
+			"lease": old.id,
+			"error": err,
+		}).Warn("Revoke replaced etcd lease failed")
+	}
+}
+
+// Unregister 注销服务，仅需填写`Name`和`Id`
+func (client *Client) Unregister(registration *discovery.Registration) error {
+	key := client.instanceKey(registration.Name, registration.Id)
+
+	client.mutex.Lock()
+	l := client.leases[key]
+	delete(client.leases, key)
+	delete(client.cache, registration.Name)
+	client.mutex.Unlock()
+
+	if l == nil {
+		return client.deleteKey(key)
+	}
+
+	close(l.stop)
+	<-l.done
+
+	return client.revoke(l.id)
+}
+
+// Discover 从etcd发现服务
+func (client *Client) Discover(name string) ([]string, []string, error) {
+	client.mutex.Lock()
+	cache, exist := client.cache[name]
+	client.mutex.Unlock()
+	if exist && time.Since(cache.t) < cacheDuration {
+		return cache.hosts, cache.ids, nil
+	}
+
+	kvs, err := client.rangePrefix(client.serviceKey(name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("get service %s from etcd failed:%v", name, err)
+	}
+
+	hosts := make([]string, 0, len(kvs))
+	ids := make([]string, 0, len(kvs))
+	for _, value := range kvs {
+		var ins instance
+		if err := json.Unmarshal(value, &ins); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"service": name,
+				"error":   err,
+			}).Warn("Bad service instance in etcd")
+			continue
+		}
+		hosts = append(hosts, net.JoinHostPort(ins.Address, strconv.Itoa(ins.Port)))
+		ids = append(ids, ins.Id)
+	}
+
+	client.mutex.Lock()
+	client.cache[name] = &serviceCache{
+		t:     time.Now(),
+		hosts: hosts,
+		ids:   ids,
+	}
+	client.mutex.Unlock()
+
+	return hosts, ids, nil
+}
+
+// keepAlive 续约，租约丢失时(比如etcd重启)重新注册
+func (client *Client) keepAlive(l *lease, value []byte) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(client.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		alive, err := client.keepAliveOnce(l.id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"key":   l.key,
+				"lease": l.id,
+				"error": err,
+			}).Warn("Keep etcd lease alive failed")
+			continue
+		}
+		if alive {
+			continue
+		}
+
+		leaseId, err := client.grant()
+		if err == nil {
+			err = client.put(l.key, value, leaseId)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"key":   l.key,
+				"error": err,
+			}).Warn("Register service to etcd again failed")
+			continue
+		}
+		l.id = leaseId
+		logrus.WithFields(logrus.Fields{
+			"key":   l.key,
+			"lease": leaseId,
+		}).Info("Etcd lease expired,service registered again")
+	}
+}
+
+func checkRegistration(registration *discovery.Registration) error {
+	if registration.Name == "" {
+		return fmt.Errorf("service name must be set in registration")
+	}
+	if registration.Id == "" {
+		return fmt.Errorf("service id must be set in registration")
+	}
+	if registration.Ip == "" {
+		return fmt.Errorf("ip must be set in registration")
+	}
+	if registration.Port == 0 {
+		return fmt.Errorf("port must be set in registration")
+	}
+
+	return nil
+}
+
+// etcd的HTTP网关中int64以字符串表示
+type grantResponse struct {
+	ID  string `json:"ID"`
+	TTL string `json:"TTL"`
+}
+
+type keepAliveResponse struct {
+	Result struct {
+		ID  string `json:"ID"`
+		TTL string `json:"TTL"`
+	} `json:"result"`
+}
+
+type rangeResponse struct {
+	Kvs []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"kvs"`
+}
+
+type errorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func encode(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// prefixEnd 计算前缀查询的结束键
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+
+	return "\x00"
+}
+
+func (client *Client) grant() (int64, error) {
+	var rsp grantResponse
+	err := client.call("/v3/lease/grant", map[string]interface{}{
+		"TTL": int64(client.ttl / time.Second),
+	}, &rsp)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(rsp.ID, 10, 64)
+}
+
+func (client *Client) keepAliveOnce(leaseId int64) (bool, error) {
+	var rsp keepAliveResponse
+	err := client.call("/v3/lease/keepalive", map[string]interface{}{
+		"ID": strconv.FormatInt(leaseId, 10),
+	}, &rsp)
+	if err != nil {
+		return false, err
+	}
+
+	ttl, _ := strconv.ParseInt(rsp.Result.TTL, 10, 64)
+	return ttl > 0, nil
+}
+
+func (client *Client) revoke(leaseId int64) error {
+	return client.call("/v3/lease/revoke", map[string]interface{}{
+		"ID": strconv.FormatInt(leaseId, 10),
+	}, nil)
+}
+
+func (client *Client) put(key string, value []byte, leaseId int64) error {
+	return client.call("/v3/kv/put", map[string]interface{}{
+		"key":   encode([]byte(key)),
+		"value": encode(value),
+		"lease": strconv.FormatInt(leaseId, 10),
+	}, nil)
+}
+
+func (client *Client) deleteKey(key string) error {
+	return client.call("/v3/kv/deleterange", map[string]interface{}{
+		"key": encode([]byte(key)),
+	}, nil)
+}
+
+func (client *Client) rangePrefix(prefix string) ([][]byte, error) {
+	var rsp rangeResponse
+	err := client.call("/v3/kv/range", map[string]interface{}{
+		"key":       encode([]byte(prefix)),
+		"range_end": encode([]byte(prefixEnd(prefix))),
+	}, &rsp)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, 0, len(rsp.Kvs))
+	for _, kv := range rsp.Kvs {
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("decode value of %s failed,%v", kv.Key, err)
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// call 依次向etcd的各个地址发送请求，直到有一个成功
+func (client *Client) call(path string, req interface{}, out interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, endpoint := range client.endpoints {
+		lastErr = client.callEndpoint(endpoint+path, body, out)
+		if lastErr == nil {
+			return nil
+		}
+	}
+
+	return lastErr
+}
+
+func (client *Client) callEndpoint(url string, body []byte, out interface{}) error {
+	rsp, err := client.cli.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		var errRsp errorResponse
+		if json.Unmarshal(b, &errRsp) == nil && errRsp.Message != "" {
+			return fmt.Errorf("etcd response status %d,%s", rsp.StatusCode, errRsp.Message)
+		}
+		return fmt.Errorf("etcd response status %d", rsp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(b, out)
+}
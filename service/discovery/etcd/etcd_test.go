@@ -0,0 +1,219 @@
+package etcd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lworkltd/kits/service/discovery"
+)
+
+// fakeGateway 模拟etcd v3的HTTP网关
+type fakeGateway struct {
+	mutex     sync.Mutex
+	nextLease int64
+	leases    map[string]int64
+	kvs       map[string]string
+	kvLease   map[string]string
+	keepAlive int
+}
+
+func newFakeGateway() *fakeGateway {
+	return &fakeGateway{
+		nextLease: 100,
+		leases:    map[string]int64{},
+		kvs:       map[string]string{},
+		kvLease:   map[string]string{},
+	}
+}
+
+func decodeKey(s string) string {
+	b, _ := base64.StdEncoding.DecodeString(s)
+	return string(b)
+}
+
+func (gateway *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+
+	req := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&req)
+	str := func(k string) string {
+		v, _ := req[k].(string)
+		return v
+	}
+
+	var rsp interface{} = map[string]interface{}{}
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		gateway.nextLease++
+		id := strconv.FormatInt(gateway.nextLease, 10)
+		gateway.leases[id] = int64(req["TTL"].(float64))
+		rsp = map[string]string{"ID": id, "TTL": strconv.FormatInt(gateway.leases[id], 10)}
+	case "/v3/lease/keepalive":
+		gateway.keepAlive++
+		ttl, exist := gateway.leases[str("ID")]
+		if !exist {
+			ttl = 0
+		}
+		rsp = map[string]interface{}{"result": map[string]string{"ID": str("ID"), "TTL": strconv.FormatInt(ttl, 10)}}
+	case "/v3/lease/revoke":
+		delete(gateway.leases, str("ID"))
+		for key, lease := range gateway.kvLease {
+			if lease == str("ID") {
+				delete(gateway.kvs, key)
+				delete(gateway.kvLease, key)
+			}
+		}
+	case "/v3/kv/put":
+		if _, exist := gateway.leases[str("lease")]; !exist {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": "lease not found", "message": "etcdserver: requested lease not found", "code": 5})
+			return
+		}
+		key := decodeKey(str("key"))
+		gateway.kvs[key] = str("value")
+		gateway.kvLease[key] = str("lease")
+	case "/v3/kv/deleterange":
+		delete(gateway.kvs, decodeKey(str("key")))
+	case "/v3/kv/range":
+		begin, end := decodeKey(str("key")), decodeKey(str("range_end"))
+		kvs := []map[string]string{}
+		for key, value := range gateway.kvs {
+			if key >= begin && key < end {
+				kvs = append(kvs, map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(key)), "value": value})
+			}
+		}
+		rsp = map[string]interface{}{"kvs": kvs}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(rsp)
+}
+
+// expire 模拟所有租约过期
+func (gateway *fakeGateway) expire() {
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+	gateway.leases = map[string]int64{}
+	gateway.kvs = map[string]string{}
+	gateway.kvLease = map[string]string{}
+}
+
+func (gateway *fakeGateway) count() int {
+	gateway.mutex.Lock()
+	defer gateway.mutex.Unlock()
+	return len(gateway.kvs)
+}
+
+func TestClientRegisterDiscover(t *testing.T) {
+	gateway := newFakeGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	client, err := New(&Option{
+		Endpoints: []string{"127.0.0.1:1", server.URL},
+		TTL:       time.Second,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	registration := &discovery.Registration{
+		Name: "kits-test-server",
+		Id:   "kits-test-server-001",
+		Ip:   "10.0.0.1",
+		Port: 11111,
+		Tags: []string{"v1"},
+	}
+	if err := client.Register(registration); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	hosts, ids, err := client.Discover(registration.Name)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(hosts) != 1 || hosts[0] != "10.0.0.1:11111" || ids[0] != registration.Id {
+		t.Errorf("Discover() = %v,%v", hosts, ids)
+	}
+
+	// 租约丢失后应当重新注册
+	gateway.expire()
+	deadline := time.Now().Add(3 * time.Second)
+	for gateway.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if gateway.count() != 1 {
+		t.Errorf("service not registered again after lease expired")
+	}
+
+	if err := client.Unregister(registration); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	hosts, _, err = client.Discover(registration.Name)
+	if err != nil || len(hosts) != 0 {
+		t.Errorf("expect 0 server got %v,err=%v", hosts, err)
+	}
+}
+
+func TestClientRegisterAgain(t *testing.T) {
+	gateway := newFakeGateway()
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	client, _ := New(&Option{Endpoints: []string{server.URL}, TTL: time.Second})
+	registration := &discovery.Registration{
+		Name: "kits-test-server",
+		Id:   "kits-test-server-001",
+		Ip:   "10.0.0.1",
+		Port: 11111,
+	}
+	if err := client.Register(registration); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	registration.Port = 22222
+	if err := client.Register(registration); err != nil {
+		t.Fatalf("Register() again error = %v", err)
+	}
+	defer client.Unregister(registration)
+
+	gateway.mutex.Lock()
+	leases := len(gateway.leases)
+	gateway.mutex.Unlock()
+	if leases != 1 {
+		t.Errorf("%d leases left after registering again, want 1", leases)
+	}
+	hosts, _, err := client.Discover(registration.Name)
+	if err != nil || len(hosts) != 1 || hosts[0] != "10.0.0.1:22222" {
+		t.Errorf("Discover() = %v,err=%v", hosts, err)
+	}
+}
+
+func TestNewWithoutEndpoint(t *testing.T) {
+	if _, err := New(&Option{}); err != ErrNoEndpoint {
+		t.Errorf("New() error = %v,want %v", err, ErrNoEndpoint)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "/a/", want: "/a0"},
+		{prefix: "a\xff", want: "b"},
+	}
+	for _, tt := range tests {
+		if got := prefixEnd(tt.prefix); got != tt.want {
+			t.Errorf("prefixEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,10 @@
 package discovery
 
-import "github.com/lworkltd/kits/helper/consul"
-
 // Discovery 定义了服务发现的接口
 type Discovery interface {
 	Discover(service string) ([]string, []string, error)
-	Register(option *consul.RegisterOption) error
-	Unregister(option *consul.RegisterOption) error
+	Register(registration *Registration) error
+	Unregister(registration *Registration) error
 }
 
 var defaultDiscovery Discovery
@@ -17,13 +15,13 @@ func Discover(service string) ([]string, []string, error) {
 }
 
 // Register 发现服务
-func Register(option *consul.RegisterOption) error {
-	return defaultDiscovery.Register(option)
+func Register(registration *Registration) error {
+	return defaultDiscovery.Register(registration)
 }
 
 // Unregister 删除服务注册
-func Unregister(option *consul.RegisterOption) error {
-	return defaultDiscovery.Unregister(option)
+func Unregister(registration *Registration) error {
+	return defaultDiscovery.Unregister(registration)
 }
 
 // Option 初始化服务发现的
@@ -39,10 +37,14 @@ type Option struct {
 	SearchFunc func(string) ([]string, []string, error)
 
 	// RegisterFunc 注册服务
-	RegisterFunc func(*consul.RegisterOption) error
+	RegisterFunc func(*Registration) error
+
+	// 注销服务，仅需填写`Name`和`Id`
+	UnregisterFunc func(*Registration) error
 
-	// 注销服务，仅需填写`Id`
-	UnregisterFunc func(*consul.RegisterOption) error
+	// Registry 注册中心，比如consul,etcd,nacos
+	// 当SearchFunc,RegisterFunc,UnregisterFunc未设置时，使用Registry对应的实现
+	Registry Registry
 }
 
 // Init 初始化服务发现
@@ -52,6 +54,17 @@ func Init(option *Option) error {
 	dis.seacher = option.SearchFunc
 	dis.register = option.RegisterFunc
 	dis.unregister = option.UnregisterFunc
+	if option.Registry != nil {
+		if dis.seacher == nil {
+			dis.seacher = option.Registry.Discover
+		}
+		if dis.register == nil {
+			dis.register = option.Registry.Register
+		}
+		if dis.unregister == nil {
+			dis.unregister = option.Registry.Unregister
+		}
+	}
 	defaultDiscovery = dis
 
 	return nil
@@ -0,0 +1,408 @@
+package nacos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lworkltd/kits/service/discovery"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultGroup         = "DEFAULT_GROUP"
+	defaultBeatInterval  = 5 * time.Second
+	defaultTimeout       = 3 * time.Second
+	cacheDuration        = 5 * time.Second
+	metaIdKey            = "kits-id"
+	beatResourceNotFound = 20404
+)
+
+// ErrNoEndpoint 没有配置nacos的地址
+var ErrNoEndpoint = errors.New("nacos endpoint not set")
+
+// Option 创建nacos注册中心的参数
+type Option struct {
+	// Endpoints nacos的地址列表，比如`http://127.0.0.1:8848`，请求失败时依次尝试下一个
+	Endpoints []string
+	// Namespace 命名空间ID，默认为public
+	Namespace string
+	// Group 服务分组，默认DEFAULT_GROUP
+	Group string
+	// Cluster 集群名称，默认DEFAULT
+	Cluster string
+	// BeatInterval 心跳间隔，默认5s
+	BeatInterval time.Duration
+	// Timeout 单次请求的超时，默认3s
+	Timeout time.Duration
+	// HttpClient 自定义HTTP客户端
+	HttpClient *http.Client
+}
+
+// Client 使用nacos开放接口(HTTP)实现的注册中心
+// 服务以临时实例注册，注册后自动发送心跳，心跳停止后由nacos摘除
+type Client struct {
+	endpoints    []string
+	namespace    string
+	group        string
+	cluster      string
+	beatInterval time.Duration
+	cli          *http.Client
+
+	mutex sync.Mutex
+	beats map[string]*beat
+	cache map[string]*serviceCache
+}
+
+// beat 记录一个已注册服务的心跳
+type beat struct {
+	registration *discovery.Registration
+	stop         chan struct{}
+	done         chan struct{}
+}
+
+// serviceCache 缓存服务的发现信息
+type serviceCache struct {
+	t     time.Time
+	hosts []string
+	ids   []string
+}
+
+var _ discovery.Registry = new(Client)
+
+// New 创建一个nacos注册中心
+func New(option *Option) (*Client, error) {
+	if len(option.Endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	endpoints := make([]string, 0, len(option.Endpoints))
+	for _, endpoint := range option.Endpoints {
+		if !strings.HasPrefix(endpoint, "http") {
+			endpoint = "http://" + endpoint
+		}
+		endpoints = append(endpoints, strings.TrimRight(endpoint, "/"))
+	}
+
+	client := &Client{
+		endpoints:    endpoints,
+		namespace:    option.Namespace,
+		group:        option.Group,
+		cluster:      option.Cluster,
+		beatInterval: option.BeatInterval,
+		cli:          option.HttpClient,
+		beats:        make(map[string]*beat, 2),
+		cache:        make(map[string]*serviceCache, 10),
+	}
+	if client.group == "" {
+		client.group = defaultGroup
+	}
+	if client.beatInterval <= 0 {
+		client.beatInterval = defaultBeatInterval
+	}
+	if client.cli == nil {
+		timeout := option.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		client.cli = &http.Client{Timeout: timeout}
+	}
+
+	return client, nil
+}
+
+func beatKey(registration *discovery.Registration) string {
+	return registration.Name + "/" + registration.Id
+}
+
+// instanceValues 注册和注销实例共用的参数
+func (client *Client) instanceValues(registration *discovery.Registration) url.Values {
+	values := url.Values{}
+	values.Set("serviceName", registration.Name)
+	values.Set("groupName", client.group)
+	values.Set("ip", registration.Ip)
+	values.Set("port", strconv.Itoa(registration.Port))
+	values.Set("ephemeral", "true")
+	if client.namespace != "" {
+		values.Set("namespaceId", client.namespace)
+	}
+	if client.cluster != "" {
+		values.Set("clusterName", client.cluster)
+	}
+
+	return values
+}
+
+func (client *Client) metadata(registration *discovery.Registration) map[string]string {
+	meta := make(map[string]string, len(registration.Meta)+2)
+	for k, v := range registration.Meta {
+		meta[k] = v
+	}
+	meta[metaIdKey] = registration.Id
+	if len(registration.Tags) > 0 {
+		meta["tags"] = strings.Join(registration.Tags, ",")
+	}
+	if registration.Protocol != "" {
+		meta["protocol"] = string(registration.Protocol)
+	}
+
+	return meta
+}
+
+// Register 注册服务，并在后台发送心跳
+func (client *Client) Register(registration *discovery.Registration) error {
+	if err := checkRegistration(registration); err != nil {
+		return err
+	}
+
+	if err := client.register(registration); err != nil {
+		return err
+	}
+
+	b := &beat{
+		registration: registration,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	client.mutex.Lock()
+	old := client.beats[beatKey(registration)]
+	client.beats[beatKey(registration)] = b
+	delete(client.cache, registration.Name)
+	client.mutex.Unlock()
+
+	if old != nil {
+		close(old.stop)
+		<-old.done
+	}
+
+	go client.heartbeat(b)
+
+	return nil
+}
+
+func (client *Client) register(registration *discovery.Registration) error {
+	values := client.instanceValues(registration)
+	meta, _ := json.Marshal(client.metadata(registration))
+	values.Set("metadata", string(meta))
+	values.Set("enabled", "true")
+	values.Set("healthy", "true")
+
+	_, err := client.call(http.MethodPost, "/nacos/v1/ns/instance", values)
+	return err
+}
+
+// Unregister 注销服务，需要填写`Name`,`Id`,`Ip`和`Port`
+func (client *Client) Unregister(registration *discovery.Registration) error {
+	client.mutex.Lock()
+	b := client.beats[beatKey(registration)]
+	delete(client.beats, beatKey(registration))
+	delete(client.cache, registration.Name)
+	client.mutex.Unlock()
+
+	if b != nil {
+		close(b.stop)
+		<-b.done
+		registration = b.registration
+	}
+
+	_, err := client.call(http.MethodDelete, "/nacos/v1/ns/instance", client.instanceValues(registration))
+	return err
+}
+
+type instanceList struct {
+	Hosts []struct {
+		InstanceId string            `json:"instanceId"`
+		Ip         string            `json:"ip"`
+		Port       int               `json:"port"`
+		Healthy    bool              `json:"healthy"`
+		Enabled    bool              `json:"enabled"`
+		Metadata   map[string]string `json:"metadata"`
+	} `json:"hosts"`
+}
+
+// Discover 从nacos发现健康的服务
+func (client *Client) Discover(name string) ([]string, []string, error) {
+	client.mutex.Lock()
+	cache, exist := client.cache[name]
+	client.mutex.Unlock()
+	if exist && time.Since(cache.t) < cacheDuration {
+		return cache.hosts, cache.ids, nil
+	}
+
+	values := url.Values{}
+	values.Set("serviceName", name)
+	values.Set("groupName", client.group)
+	values.Set("healthyOnly", "true")
+	if client.namespace != "" {
+		values.Set("namespaceId", client.namespace)
+	}
+	if client.cluster != "" {
+		values.Set("clusters", client.cluster)
+	}
+
+	b, err := client.call(http.MethodGet, "/nacos/v1/ns/instance/list", values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get service %s from nacos failed:%v", name, err)
+	}
+
+	var list instanceList
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, nil, fmt.Errorf("parse service %s from nacos failed:%v", name, err)
+	}
+
+	hosts := make([]string, 0, len(list.Hosts))
+	ids := make([]string, 0, len(list.Hosts))
+	for _, host := range list.Hosts {
+		if !host.Healthy || !host.Enabled {
+			continue
+		}
+		id := host.Metadata[metaIdKey]
+		if id == "" {
+			id = host.InstanceId
+		}
+		hosts = append(hosts, net.JoinHostPort(host.Ip, strconv.Itoa(host.Port)))
+		ids = append(ids, id)
+	}
+
+	client.mutex.Lock()
+	client.cache[name] = &serviceCache{
+		t:     time.Now(),
+		hosts: hosts,
+		ids:   ids,
+	}
+	client.mutex.Unlock()
+
+	return hosts, ids, nil
+}
+
+type beatResponse struct {
+	Code               int   `json:"code"`
+	ClientBeatInterval int64 `json:"clientBeatInterval"`
+}
+
+// heartbeat 定时发送心跳，实例被nacos摘除时重新注册
+func (client *Client) heartbeat(b *beat) {
+	defer close(b.done)
+
+	registration := b.registration
+	beatInfo, _ := json.Marshal(map[string]interface{}{
+		"serviceName": client.group + "@@" + registration.Name,
+		"ip":          registration.Ip,
+		"port":        registration.Port,
+		"cluster":     client.cluster,
+		"metadata":    client.metadata(registration),
+		"scheduled":   true,
+	})
+	values := client.instanceValues(registration)
+	values.Set("beat", string(beatInfo))
+
+	timer := time.NewTimer(client.beatInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-timer.C:
+		}
+
+		interval := client.beatInterval
+		rsp, err := client.call(http.MethodPut, "/nacos/v1/ns/instance/beat", values)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"service": registration.Name,
+				"id":      registration.Id,
+				"error":   err,
+			}).Warn("Send beat to nacos failed")
+			timer.Reset(interval)
+			continue
+		}
+
+		var beatRsp beatResponse
+		json.Unmarshal(rsp, &beatRsp)
+		if beatRsp.ClientBeatInterval > 0 {
+			interval = time.Duration(beatRsp.ClientBeatInterval) * time.Millisecond
+		}
+
+		if beatRsp.Code == beatResourceNotFound {
+			if err := client.register(registration); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"service": registration.Name,
+					"id":      registration.Id,
+					"error":   err,
+				}).Warn("Register service to nacos again failed")
+			} else {
+				logrus.WithFields(logrus.Fields{
+					"service": registration.Name,
+					"id":      registration.Id,
+				}).Info("Nacos instance lost,service registered again")
+			}
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+func checkRegistration(registration *discovery.Registration) error {
+	if registration.Name == "" {
+		return fmt.Errorf("service name must be set in registration")
+	}
+	if registration.Id == "" {
+		return fmt.Errorf("service id must be set in registration")
+	}
+	if registration.Ip == "" {
+		return fmt.Errorf("ip must be set in registration")
+	}
+	if registration.Port == 0 {
+		return fmt.Errorf("port must be set in registration")
+	}
+
+	return nil
+}
+
+// call 依次向nacos的各个地址发送请求，直到有一个成功
+func (client *Client) call(method, path string, values url.Values) ([]byte, error) {
+	var lastErr error
+	for _, endpoint := range client.endpoints {
+		b, err := client.callEndpoint(method, endpoint+path, values)
+		if err == nil {
+			return b, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+func (client *Client) callEndpoint(method, u string, values url.Values) ([]byte, error) {
+	request, err := http.NewRequest(method, u+"?"+values.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rsp, err := client.cli.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nacos response status %d,%s", rsp.StatusCode, string(b))
+	}
+
+	return b, nil
+}
@@ -0,0 +1,123 @@
+package nacos
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lworkltd/kits/service/discovery"
+)
+
+// fakeNacos 模拟nacos的实例接口
+type fakeNacos struct {
+	mutex     sync.Mutex
+	instances map[string]map[string]interface{}
+	beats     int
+}
+
+func (server *fakeNacos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	query := r.URL.Query()
+	key := query.Get("serviceName") + "#" + query.Get("ip") + "#" + query.Get("port")
+	switch {
+	case r.URL.Path == "/nacos/v1/ns/instance" && r.Method == http.MethodPost:
+		meta := map[string]string{}
+		json.Unmarshal([]byte(query.Get("metadata")), &meta)
+		port, _ := strconv.Atoi(query.Get("port"))
+		server.instances[key] = map[string]interface{}{
+			"instanceId": key,
+			"ip":         query.Get("ip"),
+			"port":       port,
+			"healthy":    true,
+			"enabled":    true,
+			"metadata":   meta,
+		}
+		w.Write([]byte("ok"))
+	case r.URL.Path == "/nacos/v1/ns/instance" && r.Method == http.MethodDelete:
+		delete(server.instances, key)
+		w.Write([]byte("ok"))
+	case r.URL.Path == "/nacos/v1/ns/instance/beat":
+		server.beats++
+		code := 10200
+		if _, exist := server.instances[key]; !exist {
+			code = beatResourceNotFound
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "clientBeatInterval": 100})
+	case r.URL.Path == "/nacos/v1/ns/instance/list":
+		hosts := []interface{}{}
+		for _, instance := range server.instances {
+			hosts = append(hosts, instance)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"hosts": hosts})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (server *fakeNacos) count() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return len(server.instances)
+}
+
+func (server *fakeNacos) clear() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.instances = map[string]map[string]interface{}{}
+}
+
+func TestClientRegisterDiscover(t *testing.T) {
+	nacos := &fakeNacos{instances: map[string]map[string]interface{}{}}
+	server := httptest.NewServer(nacos)
+	defer server.Close()
+
+	client, err := New(&Option{
+		Endpoints:    []string{server.URL},
+		BeatInterval: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	registration := &discovery.Registration{
+		Name: "kits-test-server",
+		Id:   "kits-test-server-001",
+		Ip:   "10.0.0.1",
+		Port: 11111,
+	}
+	if err := client.Register(registration); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	hosts, ids, err := client.Discover(registration.Name)
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(hosts) != 1 || hosts[0] != "10.0.0.1:11111" || ids[0] != registration.Id {
+		t.Errorf("Discover() = %v,%v", hosts, ids)
+	}
+
+	// 实例被摘除后，心跳应当触发重新注册
+	nacos.clear()
+	deadline := time.Now().Add(3 * time.Second)
+	for nacos.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if nacos.count() != 1 {
+		t.Errorf("service not registered again after instance lost")
+	}
+
+	if err := client.Unregister(&discovery.Registration{Name: registration.Name, Id: registration.Id}); err != nil {
+		t.Fatalf("Unregister() error = %v", err)
+	}
+	hosts, _, err = client.Discover(registration.Name)
+	if err != nil || len(hosts) != 0 {
+		t.Errorf("expect 0 server got %v,err=%v", hosts, err)
+	}
+}
@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"github.com/lworkltd/kits/helper/consul"
+)
+
+// Protocol 注册服务的协议类型，决定了注册中心如何做健康检测
+type Protocol string
+
+const (
+	// ProtocolHttp HTTP服务
+	ProtocolHttp Protocol = "http"
+	// ProtocolGrpc GRPC服务
+	ProtocolGrpc Protocol = "grpc"
+)
+
+// Registration 是与注册中心无关的服务注册信息
+// 各注册中心的实现按照自身的能力使用其中的字段，不支持的字段将被忽略
+type Registration struct {
+	Protocol Protocol // 服务协议，默认为HTTP
+
+	// 必须配置
+	Name string // *服务名
+	Id   string // *服务ID,全局唯一
+	Ip   string // *服务地址
+	Port int    // *端口
+
+	Tags []string          // 服务标签
+	Meta map[string]string // 服务元数据
+
+	// 健康检测的地址，格式参考consul.RegisterOption.CheckUrl
+	// 对于使用租约或心跳的注册中心(etcd,nacos)，此项被忽略
+	CheckUrl                     string
+	CheckInterval                string // 检测间隔或心跳间隔
+	CheckTimeout                 string // 检测超时
+	CheckDeregisterCriticalAfter string // 检测失败多久后注销
+}
+
+// Registry 注册中心需要实现的接口
+type Registry interface {
+	Discover(service string) ([]string, []string, error)
+	Register(registration *Registration) error
+	Unregister(registration *Registration) error
+}
+
+// ConsulOption 转换为consul的注册参数
+func (registration *Registration) ConsulOption() *consul.RegisterOption {
+	option := &consul.RegisterOption{
+		ServerType:                   consul.ServerTypeHttp,
+		Name:                         registration.Name,
+		Id:                           registration.Id,
+		Ip:                           registration.Ip,
+		Port:                         registration.Port,
+		CheckUrl:                     registration.CheckUrl,
+		CheckInterval:                registration.CheckInterval,
+		CheckTimeout:                 registration.CheckTimeout,
+		CheckDeregisterCriticalAfter: registration.CheckDeregisterCriticalAfter,
+		Tags:                         registration.Tags,
+		Meta:                         registration.Meta,
+	}
+	if registration.Protocol == ProtocolGrpc {
+		option.ServerType = consul.ServerTypeGrpc
+	}
+
+	return option
+}
+
+// consulRegistry 将consul客户端适配为Registry
+type consulRegistry struct {
+	client *consul.Client
+}
+
+// NewConsulRegistry 使用consul客户端创建注册中心
+func NewConsulRegistry(client *consul.Client) Registry {
+	return &consulRegistry{client: client}
+}
+
+// Discover 从consul发现服务
+func (registry *consulRegistry) Discover(service string) ([]string, []string, error) {
+	return registry.client.Discover(service)
+}
+
+// Register 向consul注册服务
+func (registry *consulRegistry) Register(registration *Registration) error {
+	return registry.client.Register(registration.ConsulOption())
+}
+
+// Unregister 从consul注销服务
+func (registry *consulRegistry) Unregister(registration *Registration) error {
+	return registry.client.Unregister(registration.ConsulOption())
+}
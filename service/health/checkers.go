@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-redis/redis"
+	"github.com/lworkltd/kits/helper/consul"
+	"github.com/lworkltd/kits/service/invoke"
+)
+
+// Redis 使用PING检查Redis，支持单机和集群的客户端
+func Redis(client redis.Cmdable) Checker {
+	return CheckFunc(func(context.Context) error {
+		return client.Ping().Err()
+	})
+}
+
+// Pinger 提供Ping方法的客户端，比如mgo.Session
+type Pinger interface {
+	Ping() error
+}
+
+// Ping 使用Ping方法检查，适用于Mongo等客户端
+// 需要传入context的客户端可以使用CheckFunc：
+//
+//	health.CheckFunc(func(ctx context.Context) error { return mongoClient.Ping(ctx, nil) })
+func Ping(pinger Pinger) Checker {
+	return CheckFunc(func(context.Context) error {
+		return pinger.Ping()
+	})
+}
+
+// Consul 检查Consul agent是否可以访问
+func Consul(client *consul.Client) Checker {
+	return CheckFunc(func(context.Context) error {
+		_, err := client.Version()
+		return err
+	})
+}
+
+// HTTP 请求url，返回2xx时为可用，client为nil时使用http.DefaultClient
+func HTTP(url string, client *http.Client) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return CheckFunc(func(ctx context.Context) error {
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		rsp, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return checkStatus(rsp)
+	})
+}
+
+// Service 通过服务发现请求下游服务的健康检查接口，返回2xx时为可用
+//
+//	health.Service("order-service", "/health/ready")
+func Service(name, path string) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		rsp, err := invoke.Name(name).Get(path).Context(ctx).Response()
+		if err != nil {
+			return err
+		}
+		return checkStatus(rsp)
+	})
+}
+
+func checkStatus(rsp *http.Response) error {
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(rsp.Body, 4096))
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unhealthy status %d", rsp.StatusCode)
+	}
+	return nil
+}
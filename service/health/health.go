@@ -0,0 +1,297 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status 健康状态
+type Status string
+
+const (
+	StatusUp       Status = "UP"
+	StatusDown     Status = "DOWN"
+	StatusDegraded Status = "DEGRADED" // 非关键的检查失败，实例仍然可以提供服务
+	StatusDraining Status = "DRAINING" // 实例正在退出
+)
+
+// 默认的配置
+const (
+	DefaultTimeout  = 3 * time.Second
+	DefaultCacheTTL = 2 * time.Second
+)
+
+// Checker 检查一个组件是否可用，返回nil表示可用
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc 函数形式的Checker
+type CheckFunc func(ctx context.Context) error
+
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check 注册到Registry的检查项
+type Check struct {
+	Name    string
+	Checker Checker
+	// Timeout 单次检查的超时，默认3s
+	Timeout time.Duration
+	// Critical 关键的检查失败时实例不可用(ready返回503)，非关键的检查失败时为DEGRADED
+	Critical bool
+	// Liveness 同时作为存活检查，失败时live返回503，通常只用于进程内部的状态，比如死锁检测
+	Liveness bool
+	// CacheTTL 检查结果的缓存时长，默认使用Registry的配置
+	CacheTTL time.Duration
+}
+
+// Result 单个检查项的结果
+type Result struct {
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report 汇总的检查结果
+type Report struct {
+	Status Status             `json:"status"`
+	Checks map[string]*Result `json:"checks,omitempty"`
+}
+
+// Option Registry的配置
+type Option struct {
+	// CacheTTL 检查结果的缓存时长，默认2s，避免探针频繁访问依赖的组件
+	CacheTTL time.Duration
+}
+
+// Registry 健康检查的注册中心
+type Registry struct {
+	cacheTTL time.Duration
+	draining int32
+
+	mutex  sync.RWMutex
+	checks map[string]*entry
+}
+
+// entry 检查项和缓存的结果
+type entry struct {
+	check  *Check
+	mutex  sync.Mutex
+	result *Result
+}
+
+// NewRegistry 创建健康检查的注册中心
+func NewRegistry(option *Option) *Registry {
+	registry := &Registry{
+		cacheTTL: DefaultCacheTTL,
+		checks:   map[string]*entry{},
+	}
+	if option != nil && option.CacheTTL > 0 {
+		registry.cacheTTL = option.CacheTTL
+	}
+
+	return registry
+}
+
+// Register 注册检查项，名称重复时返回错误
+func (registry *Registry) Register(check *Check) error {
+	if check.Name == "" || check.Checker == nil {
+		return fmt.Errorf("health check needs a name and a checker")
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if _, exist := registry.checks[check.Name]; exist {
+		return fmt.Errorf("health check %s already registered", check.Name)
+	}
+	registry.checks[check.Name] = &entry{check: check}
+
+	return nil
+}
+
+// Unregister 移除检查项
+func (registry *Registry) Unregister(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	delete(registry.checks, name)
+}
+
+// SetDraining 设置实例正在退出，此后ready总是返回DRAINING
+func (registry *Registry) SetDraining(draining bool) {
+	if draining {
+		atomic.StoreInt32(&registry.draining, 1)
+	} else {
+		atomic.StoreInt32(&registry.draining, 0)
+	}
+}
+
+// Live 存活检查，只执行Liveness的检查项
+func (registry *Registry) Live(ctx context.Context) *Report {
+	return registry.run(ctx, func(check *Check) bool { return check.Liveness })
+}
+
+// Ready 就绪检查，执行所有的检查项
+func (registry *Registry) Ready(ctx context.Context) *Report {
+	if atomic.LoadInt32(&registry.draining) == 1 {
+		return &Report{Status: StatusDraining}
+	}
+	return registry.run(ctx, func(*Check) bool { return true })
+}
+
+func (registry *Registry) run(ctx context.Context, filter func(*Check) bool) *Report {
+	registry.mutex.RLock()
+	entries := make([]*entry, 0, len(registry.checks))
+	for _, e := range registry.checks {
+		if filter(e.check) {
+			entries = append(entries, e)
+		}
+	}
+	registry.mutex.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].check.Name < entries[j].check.Name })
+
+	report := &Report{
+		Status: StatusUp,
+		Checks: make(map[string]*Result, len(entries)),
+	}
+	results := make([]*Result, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = registry.result(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, e := range entries {
+		result := results[i]
+		report.Checks[e.check.Name] = result
+		if result.Status == StatusUp {
+			continue
+		}
+		if e.check.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// result 返回缓存的结果，过期时重新检查，同一检查项同时只有一个检查在执行
+func (registry *Registry) result(ctx context.Context, e *entry) *Result {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	ttl := e.check.CacheTTL
+	if ttl <= 0 {
+		ttl = registry.cacheTTL
+	}
+	if e.result != nil && time.Since(e.result.CheckedAt) < ttl {
+		return e.result
+	}
+
+	result := runCheck(ctx, e.check)
+	if ctx.Err() != nil && result.Status == StatusDown {
+		// 调用方取消导致的失败不是依赖的状态，不缓存
+		return result
+	}
+	e.result = result
+	return e.result
+}
+
+// runCheck 在超时内执行检查，检查函数不响应ctx时也会按时返回
+func runCheck(ctx context.Context, check *Check) *Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	begin := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panic,%v", r)
+			}
+		}()
+		done <- check.Checker.Check(checkCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		if ctx.Err() != nil {
+			err = fmt.Errorf("check canceled,%v", ctx.Err())
+		} else {
+			err = fmt.Errorf("check timeout after %v", timeout)
+		}
+	}
+
+	result := &Result{
+		Status:    StatusUp,
+		Critical:  check.Critical,
+		Duration:  time.Since(begin).String(),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// LiveHandler 存活检查的HTTP接口，失败时返回503
+func (registry *Registry) LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, registry.Live(r.Context()))
+	}
+}
+
+// ReadyHandler 就绪检查的HTTP接口，关键的检查失败或正在退出时返回503
+func (registry *Registry) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, registry.Ready(r.Context()))
+	}
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	status := http.StatusOK
+	if report.Status == StatusDown || report.Status == StatusDraining {
+		status = http.StatusServiceUnavailable
+	}
+
+	b, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+var defaultRegistry = NewRegistry(nil)
+
+// Default 返回默认的注册中心
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register 注册检查项到默认的注册中心
+func Register(check *Check) error {
+	return defaultRegistry.Register(check)
+}
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Ready(t *testing.T) {
+	ok := CheckFunc(func(context.Context) error { return nil })
+	fail := CheckFunc(func(context.Context) error { return errors.New("connection refused") })
+	slow := CheckFunc(func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	tests := []struct {
+		name   string
+		checks []*Check
+		want   Status
+		code   int
+	}{
+		{name: "empty", want: StatusUp, code: http.StatusOK},
+		{name: "all up", checks: []*Check{{Name: "redis", Checker: ok, Critical: true}}, want: StatusUp, code: http.StatusOK},
+		{name: "non critical down", checks: []*Check{
+			{Name: "redis", Checker: ok, Critical: true},
+			{Name: "cache", Checker: fail},
+		}, want: StatusDegraded, code: http.StatusOK},
+		{name: "critical down", checks: []*Check{
+			{Name: "mongo", Checker: fail, Critical: true},
+			{Name: "cache", Checker: fail},
+		}, want: StatusDown, code: http.StatusServiceUnavailable},
+		{name: "timeout", checks: []*Check{{Name: "slow", Checker: slow, Critical: true, Timeout: 10 * time.Millisecond}}, want: StatusDown, code: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(nil)
+			for _, check := range tt.checks {
+				if err := registry.Register(check); err != nil {
+					t.Fatal(err)
+				}
+			}
+			report := registry.Ready(context.Background())
+			if report.Status != tt.want || len(report.Checks) != len(tt.checks) {
+				t.Errorf("Ready() = %+v, want %v", report, tt.want)
+			}
+
+			w := httptest.NewRecorder()
+			registry.ReadyHandler()(w, httptest.NewRequest("GET", "/health/ready", nil))
+			if w.Code != tt.code {
+				t.Errorf("ReadyHandler() status = %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRegistry_Live(t *testing.T) {
+	registry := NewRegistry(nil)
+	registry.Register(&Check{Name: "mongo", Critical: true, Checker: CheckFunc(func(context.Context) error { return errors.New("down") })})
+	registry.Register(&Check{Name: "deadlock", Liveness: true, Critical: true, Checker: CheckFunc(func(context.Context) error { return nil })})
+
+	report := registry.Live(context.Background())
+	if report.Status != StatusUp || len(report.Checks) != 1 || report.Checks["deadlock"] == nil {
+		t.Errorf("Live() = %+v, dependencies should not affect liveness", report)
+	}
+}
+
+func TestRegistry_Cache(t *testing.T) {
+	var calls int32
+	registry := NewRegistry(&Option{CacheTTL: time.Hour})
+	registry.Register(&Check{Name: "counter", Checker: CheckFunc(func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})})
+	for i := 0; i < 3; i++ {
+		registry.Ready(context.Background())
+	}
+	if calls != 1 {
+		t.Errorf("check called %d times, want 1", calls)
+	}
+}
+
+func TestRegistry_CanceledNotCached(t *testing.T) {
+	registry := NewRegistry(&Option{CacheTTL: time.Hour})
+	registry.Register(&Check{Name: "mongo", Critical: true, Checker: CheckFunc(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return nil
+		}
+	})})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := registry.Ready(ctx); report.Status != StatusDown {
+		t.Errorf("Ready() with canceled ctx = %v, want DOWN", report.Status)
+	}
+	if report := registry.Ready(context.Background()); report.Status != StatusUp {
+		t.Errorf("Ready() after canceled probe = %v, canceled result should not be cached", report.Status)
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry := NewRegistry(nil)
+	check := &Check{Name: "redis", Checker: CheckFunc(func(context.Context) error { return nil })}
+	if err := registry.Register(check); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(check); err == nil {
+		t.Errorf("Register() duplicated name should fail")
+	}
+	if err := registry.Register(&Check{Name: "nil"}); err == nil {
+		t.Errorf("Register() without checker should fail")
+	}
+
+	registry.SetDraining(true)
+	if report := registry.Ready(context.Background()); report.Status != StatusDraining {
+		t.Errorf("Ready() while draining = %v", report.Status)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := HTTP(server.URL+"/up", nil).Check(context.Background()); err != nil {
+		t.Errorf("HTTP() up error = %v", err)
+	}
+	if err := HTTP(server.URL+"/down", nil).Check(context.Background()); err == nil {
+		t.Errorf("HTTP() down should fail")
+	}
+}
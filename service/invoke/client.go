@@ -14,8 +14,11 @@ import (
 
 	"github.com/afex/hystrix-go/hystrix"
 	"github.com/golang/protobuf/proto"
+	"github.com/lworkltd/kits/service/auth"
+	servicecontext "github.com/lworkltd/kits/service/context"
 	"github.com/lworkltd/kits/service/monitor"
 	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/sirupsen/logrus"
 )
 
@@ -62,12 +65,16 @@ type client struct {
 	logFields  map[string]interface{}
 	ctx        context.Context
 	useTracing bool
+	span       opentracing.Span // 启用Tracing时本次调用的客户端Span
 	useCircuit bool
 	fallback   func(error) error
 
 	logSuccess bool
 	logError   bool
 	doLogger   bool
+
+	signKeyId  string
+	signSecret []byte
 }
 
 func (client *client) circuitName() string {
@@ -83,6 +90,52 @@ func (client *client) tracingName() string {
 	return client.serverid
 }
 
+// startSpan 创建客户端Span，后继请求以它为父Span
+func (client *client) startSpan() {
+	ctx := client.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	client.span, client.ctx = opentracing.StartSpanFromContext(ctx, client.tracingName(), ext.SpanKindRPCClient)
+}
+
+// tagRequestSpan 服务发现之后设置Span的名称，方法，地址和对端
+func (client *client) tagRequestSpan(request *http.Request) {
+	if client.span == nil {
+		return
+	}
+	client.span.SetOperationName(client.tracingName())
+	ext.HTTPMethod.Set(client.span, request.Method)
+	servicecontext.SetSpanURL(client.span, request.URL)
+	servicecontext.SetSpanPeer(client.span, client.service.Name(), client.host)
+}
+
+// tagResponseSpan 设置Span的状态码，返回为通用的结构时记录mcode和业务错误
+func (client *client) tagResponseSpan(status int, body []byte) {
+	if client.span == nil {
+		return
+	}
+	ext.HTTPStatusCode.Set(client.span, uint16(status))
+	if body == nil {
+		return
+	}
+	var result struct {
+		Result  *bool  `json:"result"`
+		Mcode   string `json:"mcode"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return
+	}
+	if result.Mcode != "" {
+		client.span.SetTag(servicecontext.SpanTagMcode, result.Mcode)
+	}
+	if result.Result != nil && !*result.Result {
+		ext.Error.Set(client.span, true)
+		client.span.SetTag(servicecontext.SpanTagErrorMessage, result.Message)
+	}
+}
+
 func (client *client) clear() {
 	client.service = nil
 	client.path = ""
@@ -97,6 +150,9 @@ func (client *client) clear() {
 	client.payload = nil
 	client.logFields = make(map[string]interface{}, 10)
 	client.ctx = nil
+	client.span = nil
+	client.signKeyId = ""
+	client.signSecret = nil
 }
 
 func (client *client) Tls() Client {
@@ -284,6 +340,18 @@ func (client *client) Context(ctx context.Context) Client {
 	return client
 }
 
+// Sign 使用HMAC-SHA256为请求签名，被调方使用auth.HMACAuthenticator校验
+func (client *client) Sign(keyId string, secret []byte) Client {
+	if client.errInProcess != nil {
+		return client
+	}
+
+	client.signKeyId = keyId
+	client.signSecret = secret
+
+	return client
+}
+
 func (client *client) Hystrix(timeOutMillisecond, maxConn, thresholdPercent int) Client {
 	if client.errInProcess != nil {
 		return client
@@ -313,9 +381,8 @@ func (client *client) Hystrix(timeOutMillisecond, maxConn, thresholdPercent int)
 
 func (client *client) Exec(out interface{}) (int, error) {
 	if client.useTracing {
-		span, ctx := opentracing.StartSpanFromContext(client.ctx, client.tracingName())
-		client.ctx = ctx
-		defer span.Finish()
+		client.startSpan()
+		defer client.span.Finish()
 	}
 
 	beginTime := time.Now()
@@ -337,6 +404,7 @@ func (client *client) Exec(out interface{}) (int, error) {
 		}
 	}
 	client.processExecMonitorReport(status, err, beginTime)
+	servicecontext.SetSpanError(client.span, err)
 
 	if client.doLogger {
 		fileds := logrus.Fields{
@@ -418,6 +486,7 @@ func (client *client) build() (*http.Request, error) {
 	if client.ctx != nil {
 		request = request.WithContext(client.ctx)
 	}
+	client.tagRequestSpan(request)
 
 	if _, ok := client.headers[HTTP_HEADER_CONTENT_TYPE]; !ok {
 		request.Header.Add(HTTP_HEADER_CONTENT_TYPE, HTTP_HEADER_CONTENT_TYPE_JSON)
@@ -427,6 +496,33 @@ func (client *client) build() (*http.Request, error) {
 		request.Header.Add(headerKey, headerValue)
 	}
 
+	// 转发上游的请求ID
+	if requestId := servicecontext.RequestIdFromContext(client.ctx); requestId != "" && request.Header.Get(servicecontext.RequestIdHeader) == "" {
+		request.Header.Set(servicecontext.RequestIdHeader, requestId)
+	}
+
+	// 传递调用链和baggage，业务已经设置了调用链或baggage头部时保持不变
+	traceSet := request.Header.Get(servicecontext.TraceparentHeader) != "" || request.Header.Get(servicecontext.TraceIdHeader) != "" ||
+		request.Header.Get(servicecontext.B3Header) != ""
+	traceHeader := http.Header{}
+	servicecontext.InjectTrace(client.ctx, traceHeader)
+	for k, values := range traceHeader {
+		if k == servicecontext.BaggageHeader {
+			if request.Header.Get(k) == "" {
+				request.Header[k] = values
+			}
+		} else if !traceSet {
+			request.Header[k] = values
+		}
+	}
+
+	// 签名在所有的头部和消息体确定之后计算
+	if client.signKeyId != "" {
+		if err := auth.SignRequest(request, client.signKeyId, client.signSecret); err != nil {
+			return nil, fmt.Errorf("sign request failed,%v", err)
+		}
+	}
+
 	return request, nil
 }
 
@@ -440,6 +536,7 @@ func (client *client) reportErrorToMonitor(code string, beginTime time.Time) {
 	failedCountReport.TIP = client.host
 	failedCountReport.Code = code
 	failedCountReport.Infc = infc
+	failedCountReport.Extra = servicecontext.BaggageMonitorTags(client.ctx)
 	monitor.ReportReqFailed(&failedCountReport)
 
 	var failedAvgTimeReport monitor.ReqFailedAvgTimeDimension
@@ -448,6 +545,7 @@ func (client *client) reportErrorToMonitor(code string, beginTime time.Time) {
 	failedAvgTimeReport.TName = client.service.Name()
 	failedAvgTimeReport.TIP = client.host
 	failedAvgTimeReport.Infc = infc
+	failedAvgTimeReport.Extra = servicecontext.BaggageMonitorTags(client.ctx)
 	monitor.ReportFailedAvgTime(&failedAvgTimeReport, (timeNow.UnixNano()-beginTime.UnixNano())/1e3) //耗时单位为微秒
 }
 
@@ -461,6 +559,7 @@ func (client *client) reportSuccessToMonitor(beginTime time.Time) {
 	succCountReport.TName = client.service.Name()
 	succCountReport.TIP = client.host
 	succCountReport.Infc = infc
+	succCountReport.Extra = servicecontext.BaggageMonitorTags(client.ctx)
 	monitor.ReportReqSuccess(&succCountReport)
 
 	var succAvgTimeReport monitor.ReqSuccessAvgTimeDimension
@@ -469,6 +568,7 @@ func (client *client) reportSuccessToMonitor(beginTime time.Time) {
 	succAvgTimeReport.TName = client.service.Name()
 	succAvgTimeReport.TIP = client.host
 	succAvgTimeReport.Infc = infc
+	succAvgTimeReport.Extra = servicecontext.BaggageMonitorTags(client.ctx)
 	monitor.ReportSuccessAvgTime(&succAvgTimeReport, (timeNow.UnixNano()-beginTime.UnixNano())/1e3) //耗时单位为微秒
 }
 
@@ -542,6 +642,7 @@ func (client *client) exec(out interface{}, cancel *context.CancelFunc) (int, er
 
 	client.logFields["status"] = resp.StatusCode
 	client.logFields["status_code"] = resp.Status
+	client.tagResponseSpan(resp.StatusCode, nil)
 
 	if resp.StatusCode < http.StatusOK ||
 		resp.StatusCode >= http.StatusMultipleChoices {
@@ -557,6 +658,7 @@ func (client *client) exec(out interface{}, cancel *context.CancelFunc) (int, er
 	defer resp.Body.Close()
 
 	client.logFields["response_payload_len"] = len(rsp)
+	client.tagResponseSpan(resp.StatusCode, rsp)
 
 	err = json.Unmarshal(rsp, out)
 	if err != nil {
@@ -596,6 +698,7 @@ func (client *client) getResp(cancel *context.CancelFunc) (*http.Response, error
 		client.logFields["error"] = err
 		return nil, err
 	}
+	client.tagResponseSpan(resp.StatusCode, nil)
 
 	return resp, nil
 }
@@ -611,9 +714,8 @@ func (client *client) updateHystrix() {
 
 func (client *client) Response() (*http.Response, error) {
 	if client.useTracing {
-		span, ctx := opentracing.StartSpanFromContext(client.ctx, client.tracingName())
-		client.ctx = ctx
-		defer span.Finish()
+		client.startSpan()
+		defer client.span.Finish()
 	}
 
 	beginTime := time.Now()
@@ -635,6 +737,7 @@ func (client *client) Response() (*http.Response, error) {
 		}
 	}
 	client.processResponseMonitorReport(resp, beginTime) //若resp为nil则上报错误，否则添加请求信息到header待进一步上报monitor数据
+	servicecontext.SetSpanError(client.span, err)
 
 	if client.doLogger {
 		fileds := logrus.Fields{
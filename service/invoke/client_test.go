@@ -5,8 +5,16 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/lworkltd/kits/service/auth"
+	servicecontext "github.com/lworkltd/kits/service/context"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
 )
 
 func TestClientExec(t *testing.T) {
@@ -109,3 +117,193 @@ func TestClientExec(t *testing.T) {
 		t.Errorf("client.exec() ResultCode = %v expect %d", response.ResultCode, 200)
 	}
 }
+
+func TestClientForwardRequestId(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(servicecontext.RequestIdHeader)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	service := &service{
+		discovery: func(string) ([]string, []string, error) {
+			return []string{strings.TrimPrefix(server.URL, "http://")}, []string{"service-id"}, nil
+		},
+		name: "test-service",
+	}
+
+	ctx := servicecontext.WithRequestId(context.Background(), "req-1")
+	var out map[string]interface{}
+	if _, err := service.Get("/").Context(ctx).Exec(&out); err != nil {
+		t.Fatalf("client.Exec() error = %v", err)
+	}
+	if got != "req-1" {
+		t.Errorf("request id = %q, want %q", got, "req-1")
+	}
+
+	if _, err := service.Get("/").Header(servicecontext.RequestIdHeader, "req-2").Context(ctx).Exec(&out); err != nil {
+		t.Fatalf("client.Exec() error = %v", err)
+	}
+	if got != "req-2" {
+		t.Errorf("explicit request id = %q, want %q", got, "req-2")
+	}
+}
+
+func TestClientForwardTrace(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	service := &service{
+		discovery: func(string) ([]string, []string, error) {
+			return []string{strings.TrimPrefix(server.URL, "http://")}, []string{"service-id"}, nil
+		},
+		name: "test-service",
+	}
+
+	servicecontext.SetBaggagePolicy(&servicecontext.BaggagePolicy{AllowKeys: []string{"tenant_id"}})
+	defer servicecontext.SetBaggagePolicy(nil)
+
+	incoming, _ := http.NewRequest("GET", "/", nil)
+	incoming.Header.Set(servicecontext.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Header.Set(servicecontext.BaggageHeader, "tenant_id=t1")
+	ctx := servicecontext.FromHttpRequest(incoming, nil)
+	ctx.SetBaggage("ab_bucket", "b")
+	var out map[string]interface{}
+	if _, err := service.Get("/").Context(ctx).Exec(&out); err != nil {
+		t.Fatalf("client.Exec() error = %v", err)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + ctx.SpanId() + "-01"
+	if got.Get(servicecontext.TraceparentHeader) != want || got.Get(servicecontext.TraceIdHeader) != ctx.TracingId() {
+		t.Errorf("trace headers = %v, want traceparent %s", got, want)
+	}
+	if baggage := got.Get(servicecontext.BaggageHeader); baggage != "ab_bucket=b,tenant_id=t1" {
+		t.Errorf("baggage header = %q, want %q", baggage, "ab_bucket=b,tenant_id=t1")
+	}
+}
+
+func TestClientSign(t *testing.T) {
+	authenticator := auth.NewHMACAuthenticator(&auth.HMACOption{
+		Keys: map[string]*auth.HMACKey{"order-service": {Secret: []byte("secret")}},
+	})
+	var subject string
+	var authErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+		subject, authErr = "", err
+		if principal != nil {
+			subject = principal.Subject
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	service := &service{
+		discovery: func(string) ([]string, []string, error) {
+			return []string{strings.TrimPrefix(server.URL, "http://")}, []string{"service-id"}, nil
+		},
+		name: "test-service",
+	}
+
+	var out map[string]interface{}
+	if _, err := service.Post("/orders").Query("b", "2").Query("a", "1").Json(map[string]int{"amount": 1}).Sign("order-service", []byte("secret")).Exec(&out); err != nil {
+		t.Fatalf("client.Exec() error = %v", err)
+	}
+	if authErr != nil || subject != "order-service" {
+		t.Errorf("signed request: subject = %q, error = %v", subject, authErr)
+	}
+
+	if _, err := service.Post("/orders").Json(map[string]int{"amount": 1}).Sign("order-service", []byte("wrong")).Exec(&out); err != nil {
+		t.Fatalf("client.Exec() error = %v", err)
+	}
+	if authErr == nil {
+		t.Errorf("request signed with a wrong secret should fail")
+	}
+}
+
+func TestClientSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantTags  map[string]interface{}
+		wantError bool
+	}{
+		{
+			name:     "success",
+			status:   http.StatusOK,
+			body:     `{"result":true,"data":{}}`,
+			wantTags: map[string]interface{}{"http.status_code": uint16(200)},
+		},
+		{
+			name:      "business error",
+			status:    http.StatusOK,
+			body:      `{"result":false,"mcode":"USER_NOT_FOUND","message":"user not found"}`,
+			wantTags:  map[string]interface{}{"http.status_code": uint16(200), "mcode": "USER_NOT_FOUND", "error.message": "user not found"},
+			wantError: true,
+		},
+		{
+			name:      "bad status",
+			status:    http.StatusServiceUnavailable,
+			wantTags:  map[string]interface{}{"http.status_code": uint16(503), "error.message": "reponse with bad status,503"},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer.Reset()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+			service := &service{
+				discovery: func(string) ([]string, []string, error) {
+					return []string{host}, []string{"service-id"}, nil
+				},
+				name:       "test-service",
+				useTracing: true,
+			}
+
+			var out map[string]interface{}
+			service.Get("/v1/users").Query("token", "secret").Context(servicecontext.New("caller", nil)).Exec(&out)
+
+			spans := tracer.FinishedSpans()
+			if len(spans) != 1 {
+				t.Fatalf("finished spans = %d, want 1", len(spans))
+			}
+			tags := spans[0].Tags()
+			want := map[string]interface{}{
+				"span.kind":    ext.SpanKindRPCClientEnum,
+				"http.method":  "GET",
+				"http.url":     server.URL + "/v1/users",
+				"peer.service": "test-service",
+				"peer.address": host,
+				"peer.ipv4":    "127.0.0.1",
+			}
+			for k, v := range tt.wantTags {
+				want[k] = v
+			}
+			for k, v := range want {
+				if tags[k] != v {
+					t.Errorf("tag %s = %v, want %v", k, tags[k], v)
+				}
+			}
+			if failed, _ := tags["error"].(bool); failed != tt.wantError {
+				t.Errorf("tag error = %v, want %v", failed, tt.wantError)
+			}
+			if spans[0].OperationName != "service-id" {
+				t.Errorf("operation name = %s, want service-id", spans[0].OperationName)
+			}
+		})
+	}
+}
@@ -79,6 +79,7 @@ type (
 		Timeout(time.Duration) Client
 		HttpClient(*http.Client) Client
 		LogMode(logOptions *LogModeOptions) Client
+		Sign(keyId string, secret []byte) Client // 使用HMAC-SHA256为请求签名
 	}
 )
 
@@ -27,6 +27,7 @@ type ReqSuccessCountDimension struct {
     TName string `json:"tName,omitempty"` // 目标端服务名称，若非空则上报到阿里云时：TName = "{TName}_{environmen_type}"
     TIP   string `json:"tIP,omitempty"`   // 目标端IP地址
     Infc  string `json:"infc,omitempty"`  // {direction}_{method}_{path}"，method取值：direction：ACTIVE/PASSIVE，GET/POST/DELETE/PUT/RPC/GRPC， path：Http Path/Interface Name；例如：ACTIVE_GET_/v1/user/right
+    Extra map[string]string `json:"-"` // 附加的维度，比如来自baggage的A/B分组，上报时与以上字段并列
 }
 
 // ReqFailedCountDimension 请求失败量的监控项字段
@@ -36,6 +37,7 @@ type ReqFailedCountDimension struct {
     TIP   string `json:"tIP,omitempty"`   // 目标端IP地址
     Code  string `json:"code,omitempty"`  // 错误码
     Infc  string `json:"infc,omitempty"`  // {direction}_{method}_{path}"，method取值：direction：ACTIVE/PASSIVE，GET/POST/DELETE/PUT/RPC/GRPC， path：Http Path/Interface Name；例如：ACTIVE_GET_/v1/user/right
+    Extra map[string]string `json:"-"` // 附加的维度，比如来自baggage的A/B分组，上报时与以上字段并列
 }
 
 // ReqSuccessAvgTimeDimension 请求成功平均耗时的监控项字段
@@ -45,6 +47,7 @@ type ReqSuccessAvgTimeDimension struct {
     TName string `json:"tName,omitempty"` // 目标端服务名称
     TIP   string `json:"tIP,omitempty"`   // 目标端IP地址
     Infc  string `json:"infc,omitempty"`  // {direction}_{method}_{path}"，method取值：direction：ACTIVE/PASSIVE，GET/POST/DELETE/PUT/RPC/GRPC， path：Http Path/Interface Name；例如：ACTIVE_GET_/v1/user/right
+    Extra map[string]string `json:"-"` // 附加的维度，比如来自baggage的A/B分组，上报时与以上字段并列
 }
 
 // ReqFailedAvgTimeDimension 请求失败平均耗时的监控项字段
@@ -54,6 +57,7 @@ type ReqFailedAvgTimeDimension struct {
     TName string `json:"tName,omitempty"` // 目标端服务名称，若非空则上报到阿里云时：TName = "{TName}_{environmen_type}"
     TIP   string `json:"tIP,omitempty"`   // 目标端IP地址
     Infc  string `json:"infc,omitempty"`  // {direction}_{method}_{path}"，method取值：direction：ACTIVE/PASSIVE，GET/POST/DELETE/PUT/RPC/GRPC， path：Http Path/Interface Name；例如：ACTIVE_GET_/v1/user/right
+    Extra map[string]string `json:"-"` // 附加的维度，比如来自baggage的A/B分组，上报时与以上字段并列
 }
 
 type RuntimeDataDimension struct {
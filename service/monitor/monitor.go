@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -27,15 +29,77 @@ const (
 	sendReportDataTimeoutSecond   = 3   // 发送上报数据到阿里云的超时时间，单位为秒
 )
 
+// extraKey 附加维度的序列化，没有时为空以兼容原有的key
+func extraKey(extra map[string]string) string {
+	if len(extra) == 0 {
+		return ""
+	}
+	values := url.Values{}
+	for k, v := range extra {
+		values.Set(k, v)
+	}
+	return delimit + values.Encode()
+}
+
+// parseExtraKey 附加维度的反序列化
+func parseExtraKey(strArray []string) map[string]string {
+	if len(strArray) == 0 {
+		return nil
+	}
+	values, err := url.ParseQuery(strArray[0])
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	extra := make(map[string]string, len(values))
+	for k := range values {
+		extra[k] = values.Get(k)
+	}
+	return extra
+}
+
+// aliyunDimensions 附加维度与原有的维度并列上报，不覆盖原有的维度
+func aliyunDimensions(dimessionObj interface{}, extra map[string]string) interface{} {
+	if len(extra) == 0 {
+		return dimessionObj
+	}
+	dimensions := make(map[string]interface{})
+	b, _ := json.Marshal(dimessionObj)
+	json.Unmarshal(b, &dimensions)
+	for k, v := range extra {
+		if _, exist := dimensions[k]; !exist {
+			dimensions[k] = v
+		}
+	}
+	return dimensions
+}
+
+// statsdExtra 附加维度按key排序追加到statsd的指标名之后
+func statsdExtra(extra map[string]string) string {
+	if len(extra) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(".")
+		b.WriteString(strings.NewReplacer(".", "-", ":", "-", "|", "-").Replace(extra[k]))
+	}
+	return b.String()
+}
+
 // generatekey 简易序列化
 func (me *ReqSuccessCountDimension) generatekey() string {
-	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc
+	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc + extraKey(me.Extra)
 }
 
 // parseSuccessCountDimension 简易反序列化
 func parseSuccessCountDimension(successCountKey string) *ReqSuccessCountDimension {
 	strArray := strings.Split(successCountKey, delimit)
-	if 5 != len(strArray) {
+	if 5 != len(strArray) && 6 != len(strArray) {
 		return nil
 	}
 	var obj ReqSuccessCountDimension
@@ -44,6 +108,7 @@ func parseSuccessCountDimension(successCountKey string) *ReqSuccessCountDimensio
 	obj.TName = strArray[2]
 	obj.TIP = strArray[3]
 	obj.Infc = strArray[4]
+	obj.Extra = parseExtraKey(strArray[5:])
 	return &obj
 }
 
@@ -53,13 +118,13 @@ func (me *ReqSuccessCountDimension) getMetricName() string {
 
 // generatekey 简易序列化
 func (me *ReqFailedCountDimension) generatekey() string {
-	return me.SName + delimit + me.TName + delimit + me.TIP + delimit + me.Code + delimit + me.Infc
+	return me.SName + delimit + me.TName + delimit + me.TIP + delimit + me.Code + delimit + me.Infc + extraKey(me.Extra)
 }
 
 // parseFailedCountDimension 简易反序列化
 func parseFailedCountDimension(failedCountKey string) *ReqFailedCountDimension {
 	strArray := strings.Split(failedCountKey, delimit)
-	if 5 != len(strArray) {
+	if 5 != len(strArray) && 6 != len(strArray) {
 		return nil
 	}
 	var obj ReqFailedCountDimension
@@ -68,6 +133,7 @@ func parseFailedCountDimension(failedCountKey string) *ReqFailedCountDimension {
 	obj.TIP = strArray[2]
 	obj.Code = strArray[3]
 	obj.Infc = strArray[4]
+	obj.Extra = parseExtraKey(strArray[5:])
 	return &obj
 }
 
@@ -77,13 +143,13 @@ func (me *ReqFailedCountDimension) getMetricName() string {
 
 // generatekey 简易序列化
 func (me *ReqSuccessAvgTimeDimension) generatekey() string {
-	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc
+	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc + extraKey(me.Extra)
 }
 
 // parseSuccessAvgTimeDimension 简易反序列化
 func parseSuccessAvgTimeDimension(successAvgTimeKey string) *ReqSuccessAvgTimeDimension {
 	strArray := strings.Split(successAvgTimeKey, delimit)
-	if 5 != len(strArray) {
+	if 5 != len(strArray) && 6 != len(strArray) {
 		return nil
 	}
 	var obj ReqSuccessAvgTimeDimension
@@ -92,6 +158,7 @@ func parseSuccessAvgTimeDimension(successAvgTimeKey string) *ReqSuccessAvgTimeDi
 	obj.TName = strArray[2]
 	obj.TIP = strArray[3]
 	obj.Infc = strArray[4]
+	obj.Extra = parseExtraKey(strArray[5:])
 	return &obj
 }
 func (me *ReqSuccessAvgTimeDimension) getMetricName() string {
@@ -100,13 +167,13 @@ func (me *ReqSuccessAvgTimeDimension) getMetricName() string {
 
 // parseFailedAvgTimeDimension 简易序列化
 func (me *ReqFailedAvgTimeDimension) generatekey() string {
-	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc
+	return me.SName + delimit + me.SIP + delimit + me.TName + delimit + me.TIP + delimit + me.Infc + extraKey(me.Extra)
 }
 
 // parseFailedAvgTimeDimension 简易反序列化
 func parseFailedAvgTimeDimension(failedAvgTimeKey string) *ReqFailedAvgTimeDimension {
 	strArray := strings.Split(failedAvgTimeKey, delimit)
-	if 5 != len(strArray) {
+	if 5 != len(strArray) && 6 != len(strArray) {
 		return nil
 	}
 	var obj ReqFailedAvgTimeDimension
@@ -115,6 +182,7 @@ func parseFailedAvgTimeDimension(failedAvgTimeKey string) *ReqFailedAvgTimeDimen
 	obj.TName = strArray[2]
 	obj.TIP = strArray[3]
 	obj.Infc = strArray[4]
+	obj.Extra = parseExtraKey(strArray[5:])
 	return &obj
 }
 
@@ -372,7 +440,7 @@ func getSuccCountAliyunMetrics(succCountMap map[string]countInfo, reportTime tim
 		metric.MetricName = dimessionObj.getMetricName()
 		metric.Value = countObj.counter
 		metric.Timestamp = reportTime.UnixNano() / 1e6
-		metric.Dimensions = dimessionObj
+		metric.Dimensions = aliyunDimensions(dimessionObj, dimessionObj.Extra)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -397,7 +465,7 @@ func getFailedCountAliyunMetrics(failedCountMap map[string]countInfo, reportTime
 		metric.MetricName = dimessionObj.getMetricName()
 		metric.Value = countObj.counter
 		metric.Timestamp = reportTime.UnixNano() / 1e6
-		metric.Dimensions = dimessionObj
+		metric.Dimensions = aliyunDimensions(dimessionObj, dimessionObj.Extra)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -422,7 +490,7 @@ func getSuccAvgTimeAliyunMetrics(succAvgTimeMap map[string]countInfo, reportTime
 		metric.MetricName = dimessionObj.getMetricName()
 		metric.Value = countObj.sum / countObj.counter //平均值
 		metric.Timestamp = reportTime.UnixNano() / 1e6
-		metric.Dimensions = dimessionObj
+		metric.Dimensions = aliyunDimensions(dimessionObj, dimessionObj.Extra)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -447,7 +515,7 @@ func getFailedAvgTimeAliyunMetrics(failedAvgTimeMap map[string]countInfo, report
 		metric.MetricName = dimessionObj.getMetricName()
 		metric.Value = countObj.sum / countObj.counter //平均值
 		metric.Timestamp = reportTime.UnixNano() / 1e6
-		metric.Dimensions = dimessionObj
+		metric.Dimensions = aliyunDimensions(dimessionObj, dimessionObj.Extra)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -489,7 +557,7 @@ func getSuccCountStatsdMetrics(succCountMap map[string]countInfo, reportTime tim
 			dimessionObj.TName += "_" + monitorObj.conf.EnvironmentType
 		}
 
-		metric := fmt.Sprintf("req.success.count.%v.%v.%v.%v.%v:%v|c", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), countObj.counter)
+		metric := fmt.Sprintf("req.success.count.%v.%v.%v.%v.%v%v:%v|c", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), statsdExtra(dimessionObj.Extra), countObj.counter)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -511,7 +579,7 @@ func getFailedCountStatsdMetrics(failedCountMap map[string]countInfo, reportTime
 			dimessionObj.TName += "_" + monitorObj.conf.EnvironmentType
 		}
 
-		metric := fmt.Sprintf("req.failed.count.%v.%v.%v.%v.%v:%v|c", dimessionObj.SName, dimessionObj.TName, dimessionObj.TIP, dimessionObj.Code, strings.Replace(dimessionObj.Infc, ":", "-", -1), countObj.counter)
+		metric := fmt.Sprintf("req.failed.count.%v.%v.%v.%v.%v%v:%v|c", dimessionObj.SName, dimessionObj.TName, dimessionObj.TIP, dimessionObj.Code, strings.Replace(dimessionObj.Infc, ":", "-", -1), statsdExtra(dimessionObj.Extra), countObj.counter)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -533,7 +601,7 @@ func getSuccAvgTimeStatsdMetrics(succAvgTimeMap map[string]countInfo, reportTime
 			dimessionObj.TName += "_" + monitorObj.conf.EnvironmentType
 		}
 
-		metric := fmt.Sprintf("req.success.avg.time.%v.%v.%v.%v.%v:%v|ms", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), countObj.sum/countObj.counter)
+		metric := fmt.Sprintf("req.success.avg.time.%v.%v.%v.%v.%v%v:%v|ms", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), statsdExtra(dimessionObj.Extra), countObj.sum/countObj.counter)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -555,7 +623,7 @@ func getFailedAvgTimeStatsdMetrics(failedAvgTimeMap map[string]countInfo, report
 			dimessionObj.TName += "_" + monitorObj.conf.EnvironmentType
 		}
 
-		metric := fmt.Sprintf("req.failed.avg.time.%v.%v.%v.%v.%v:%v|ms", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), countObj.sum/countObj.counter)
+		metric := fmt.Sprintf("req.failed.avg.time.%v.%v.%v.%v.%v%v:%v|ms", dimessionObj.SName, dimessionObj.SIP, dimessionObj.TName, dimessionObj.TIP, strings.Replace(dimessionObj.Infc, ":", "-", -1), statsdExtra(dimessionObj.Extra), countObj.sum/countObj.counter)
 		metrics = append(metrics, metric)
 	}
 	return metrics
@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDimensionKeyExtra(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra map[string]string
+	}{
+		{name: "none"},
+		{name: "extra", extra: map[string]string{"ab_bucket": "b", "tenant_id": "t#1&2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dimension := &ReqFailedCountDimension{SName: "a", TName: "b", TIP: "10.0.0.1", Code: "500", Infc: "ACTIVE_GET_/v1", Extra: tt.extra}
+			got := parseFailedCountDimension(dimension.generatekey())
+			if got == nil || !reflect.DeepEqual(got, dimension) {
+				t.Errorf("parseFailedCountDimension() = %+v, want %+v", got, dimension)
+			}
+		})
+	}
+
+	// 没有附加维度时与原有的格式相同
+	dimension := &ReqSuccessCountDimension{SName: "a", SIP: "10.0.0.2", TName: "b", TIP: "10.0.0.1", Infc: "PASSIVE_GET_/v1"}
+	if key := dimension.generatekey(); key != "a#@#10.0.0.2#@#b#@#10.0.0.1#@#PASSIVE_GET_/v1" {
+		t.Errorf("generatekey() = %s", key)
+	}
+}
+
+func TestExtraReport(t *testing.T) {
+	extra := map[string]string{"ab_bucket": "b.1", "sName": "x"}
+	dimensions, ok := aliyunDimensions(&ReqSuccessCountDimension{SName: "a"}, extra).(map[string]interface{})
+	if !ok || dimensions["sName"] != "a" || dimensions["ab_bucket"] != "b.1" {
+		t.Errorf("aliyunDimensions() = %v", dimensions)
+	}
+	if got := statsdExtra(extra); got != ".b-1.x" {
+		t.Errorf("statsdExtra() = %s, want .b-1.x", got)
+	}
+}
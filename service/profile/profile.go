@@ -74,8 +74,18 @@ type Service struct {
 	CheckInterval  string   `toml:"check_interval"`   // consul健康检测间隔，默认 "5s"
 	CheckTimeout   string   `toml:"check_timeout"`    // consul健康检测超时，默认 "3s"
 
+	Admission []AdmissionRule `toml:"admission"`  // 准入控制规则，按顺序检查，配置后SnowSlideLimit不再生效
+	AccessLog AccessLog       `toml:"access_log"` // 访问日志的配置，AccessLogEnabled时生效
+
+	HTTP HTTP `toml:"http"` // CORS，安全头部，请求大小限制和返回压缩
+
 	PprofEnabled    bool   `toml:"pprof_enabled"`     // 启用PPROF
 	PprofPathPrefix string `toml:"pprof_path_prefix"` // PPROF的路径前缀,
+
+	TLSCertFile     string `toml:"tls_cert_file"`    // TLS证书，与TLSKeyFile同时配置时启用HTTPS
+	TLSKeyFile      string `toml:"tls_key_file"`     // TLS私钥
+	ShutdownTimeout string `toml:"shutdown_timeout"` // 优雅退出时等待进行中请求的最长时间，默认 "15s"
+	DrainDelay      string `toml:"drain_delay"`      // 就绪检查返回503之后，停止监听之前的等待时间，比如 "5s"
 	//srvContext log
 	LogLevel    string `toml:"log_level"`
 	LogFilePath string `toml:"log_file_path"`
@@ -99,6 +109,64 @@ func (service *Service) AfterParse() {
 	}
 }
 
+// AdmissionRule 服务端准入控制规则
+// 例如按调用方服务名限制每秒100个请求:
+//
+//	[[service.admission]]
+//	limiter = "token_bucket"
+//	key = "header:X-Service-Name"
+//	rate = 100
+type AdmissionRule struct {
+	Limiter string `toml:"limiter"` // 限流器:token_bucket,sliding_window,concurrency,adaptive
+	Key     string `toml:"key"`     // 分组:global,route,ip,header:{Header-Name}，默认global
+
+	TrustedProxies []string `toml:"trusted_proxies"` // ip:可信代理的IP或CIDR，配置后才解析这些代理设置的X-Forwarded-For，否则使用连接的远端地址
+
+	Rate   float64 `toml:"rate"`   // token_bucket:每秒补充的令牌数
+	Burst  int     `toml:"burst"`  // token_bucket:最多积累的令牌数，默认与rate相同
+	Limit  int     `toml:"limit"`  // sliding_window:窗口内最大请求数;concurrency:最大并发数;adaptive:初始并发上限
+	Window string  `toml:"window"` // sliding_window:窗口时长，默认"1s"
+
+	Algorithm     string  `toml:"algorithm"`      // adaptive:aimd或gradient，默认aimd
+	MinLimit      int     `toml:"min_limit"`      // adaptive:并发上限的下限
+	MaxLimit      int     `toml:"max_limit"`      // adaptive:并发上限的上限
+	TargetLatency string  `toml:"target_latency"` // adaptive:aimd的目标延迟，默认"100ms"
+	BackoffRatio  float64 `toml:"backoff_ratio"`  // adaptive:aimd的收缩比例，默认0.9
+}
+
+// AccessLog 服务端访问日志的配置
+// 例如以JSON格式记录到文件，成功的请求只记录10%:
+//
+//	[service.access_log]
+//	file = "/var/log/myservice/access.log"
+//	format = "json"
+//	fields = ["status", "mcode", "latency", "client_ip", "trace_id"]
+//	success_sampling = 0.1
+type AccessLog struct {
+	File            string   `toml:"file"`             // 输出文件，默认标准输出
+	Format          string   `toml:"format"`           // combined或json，默认combined
+	Fields          []string `toml:"fields"`           // 记录的字段，默认全部
+	SuccessSampling float64  `toml:"success_sampling"` // 成功请求的采样比例(0,1]，默认1，失败的请求总是记录
+	TrustedProxies  []string `toml:"trusted_proxies"`  // 可信代理的IP或CIDR，配置后只信任来自这些代理的X-Forwarded-For
+}
+
+type HTTP struct {
+	CORSAllowOrigins     []string `toml:"cors_allow_origins"`     // 允许跨域的来源，比如["https://*.example.com"]，"*"表示全部，为空时不启用CORS
+	CORSAllowMethods     []string `toml:"cors_allow_methods"`     // 允许的方法，默认GET,POST,PUT,PATCH,DELETE,HEAD
+	CORSAllowHeaders     []string `toml:"cors_allow_headers"`     // 允许的请求头，默认允许预检请求中的全部请求头
+	CORSExposeHeaders    []string `toml:"cors_expose_headers"`    // 暴露给浏览器的返回头，默认X-Request-Id
+	CORSAllowCredentials bool     `toml:"cors_allow_credentials"` // 允许携带Cookie
+	CORSMaxAge           string   `toml:"cors_max_age"`           // 预检结果的缓存时长，默认 "10m"
+
+	SecurityHeaders bool   `toml:"security_headers"` // 添加常用的安全头部
+	HSTSMaxAge      string `toml:"hsts_max_age"`     // HTTPS请求的Strict-Transport-Security时长，默认 "4320h"，"0"表示不添加
+
+	MaxBodySize string `toml:"max_body_size"` // 请求消息体的最大长度，比如 "10MB"，为空时不限制
+
+	Compression        bool `toml:"compression"`          // 启用gzip/br压缩
+	CompressionMinSize int  `toml:"compression_min_size"` // 超过该字节数的返回才压缩，默认1024
+}
+
 type Discovery struct {
 	EnableConsul   bool     `toml:"enable_consul"`   // 启用Consul，仅使用Consul时有效
 	EnableStatic   bool     `toml:"enable_static"`   // 启用静态服务发现
@@ -187,6 +255,64 @@ func (hystrix *Hystrix) AfterParse() {
 	}
 }
 
+// Tracing 调用链的配置，由tracing.InitWithProfile初始化
+//
+//	[tracing]
+//	enabled = true
+//	service_name = "order"
+//	exporter = "otlp"
+//	sampler = "ratio"
+//	sample_ratio = 0.1
+type Tracing struct {
+	Enabled       bool              `toml:"enabled"`
+	ServiceName   string            `toml:"service_name"`   // 上报的服务名
+	Exporter      string            `toml:"exporter"`       // otlp,zipkin,stdout,file，默认otlp
+	Endpoint      string            `toml:"endpoint"`       // otlp默认http://127.0.0.1:4318/v1/traces，zipkin比如http://127.0.0.1:9411/api/v2/spans
+	Headers       map[string]string `toml:"headers"`        // otlp和zipkin请求附加的头部，比如认证信息
+	File          string            `toml:"file"`           // exporter为file时写入的文件
+	Sampler       string            `toml:"sampler"`        // always,never,ratio,rate_limit，默认always
+	SampleRatio   float64           `toml:"sample_ratio"`   // ratio的采样比例，0到1
+	SampleRate    float64           `toml:"sample_rate"`    // rate_limit每秒最多采样的调用链数
+	ParentBased   bool              `toml:"parent_based"`   // 有上游时使用上游的采样决定，默认true
+	Propagators   []string          `toml:"propagators"`    // 注入后继请求的格式:tracecontext,b3,b3multi，默认tracecontext和b3multi
+	BatchSize     int               `toml:"batch_size"`     // 每次上报的最大Span数，默认512
+	FlushInterval string            `toml:"flush_interval"` // 上报的间隔，默认 "5s"
+}
+
+func (tracing *Tracing) BeforeParse() {
+	tracing.Exporter = "otlp"
+	tracing.Sampler = "always"
+	tracing.SampleRatio = 1
+	tracing.ParentBased = true
+}
+
+func (tracing *Tracing) AfterParse() {
+	if tracing.Enabled && tracing.ServiceName == "" {
+		logrus.WithFields(logrus.Fields{
+			"profile": "Tracing",
+		}).Warn("ServiceName is empty")
+	}
+}
+
+// Baggage 随调用链传递的业务上下文，比如租户和A/B分组，由context.NewBaggagePolicyWithProfile使用
+//
+// 面向客户端的服务不配置allow_keys，由业务在认证之后使用SetBaggage设置，内部的服务配置allow_keys接受上游传递的值
+//
+//	[baggage]
+//	allow_keys = ["tenant_id", "user_id", "ab_bucket"]
+//	log_keys = ["tenant_id", "user_id"]
+//	monitor_keys = ["ab_bucket"]
+type Baggage struct {
+	AllowKeys   []string `toml:"allow_keys"`   // 接受上游请求头中的key，为空时不接受
+	MaxEntries  int      `toml:"max_entries"`  // 最多的个数，默认64
+	MaxBytes    int      `toml:"max_bytes"`    // 序列化之后的最大字节数，默认8192
+	LogKeys     []string `toml:"log_keys"`     // 写入日志字段的key
+	MonitorKeys []string `toml:"monitor_keys"` // 作为监控维度的key，只应选择取值有限的key
+}
+
+func (baggage *Baggage) BeforeParse() {}
+func (baggage *Baggage) AfterParse()  {}
+
 // Zipkin OpenTracing 的配置
 type Zipkin struct {
 	Url string `json:"url"` // Zipkin服务的地址
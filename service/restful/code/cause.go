@@ -0,0 +1,155 @@
+package code
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Wrap 创建一个以err为原因的错误，message返回给调用方，err只记录在日志中
+//
+//	if err := db.Find(&user).Error; err != nil {
+//	    return nil, code.Wrap(2001, err, "query user failed")
+//	}
+func Wrap(code int, err error, message string) Error {
+	return &errorImpl{
+		code:    code,
+		message: message,
+		cause:   err,
+	}
+}
+
+// Wrapf 与Wrap相同，使用格式化的错误信息
+func Wrapf(code int, err error, format string, args ...interface{}) Error {
+	return Wrap(code, err, fmt.Sprintf(format, args...))
+}
+
+// WrapMcode 与Wrap相同，使用mcode
+func WrapMcode(mcode string, err error, message string) Error {
+	return &errorImpl{
+		mcode:   mcode,
+		message: message,
+		cause:   err,
+	}
+}
+
+// WrapMcodef 与WrapMcode相同，使用格式化的错误信息
+func WrapMcodef(mcode string, err error, format string, args ...interface{}) Error {
+	return WrapMcode(mcode, err, fmt.Sprintf(format, args...))
+}
+
+// Unwrap 返回原始错误，用于errors.Is/As
+func (err *errorImpl) Unwrap() error {
+	if err.cause != nil {
+		return err.cause
+	}
+	if err.origin != nil {
+		return err.origin
+	}
+	return nil
+}
+
+// StackTrace 捕获的堆栈，没有捕获时返回空
+func (err *errorImpl) StackTrace() string {
+	if len(err.stack) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(err.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// WithStack 捕获调用处的堆栈，已经捕获过时保持不变
+func WithStack(err Error) Error {
+	if err == nil || StackOf(err) != "" {
+		return err
+	}
+	impl := cloneOf(err)
+	impl.stack = callers(3)
+	return impl
+}
+
+// NewWithStack 与New相同，同时捕获调用处的堆栈
+func NewWithStack(code int, message string) Error {
+	return &errorImpl{
+		code:    code,
+		message: message,
+		stack:   callers(3),
+	}
+}
+
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip, pcs)
+	return pcs[:n]
+}
+
+// cloneOf 复制错误用于附加信息，不是errorImpl时保留原始错误
+func cloneOf(err Error) *errorImpl {
+	if impl, ok := err.(*errorImpl); ok {
+		clone := *impl
+		return &clone
+	}
+	return &errorImpl{
+		code:    err.Code(),
+		mcode:   err.Mcode(),
+		message: err.Message(),
+		origin:  err,
+	}
+}
+
+// causeOf 返回err的下一层原因，附加信息产生的副本不视为一层原因
+func causeOf(err error) error {
+	if impl, ok := err.(*errorImpl); ok {
+		if impl.cause != nil {
+			return impl.cause
+		}
+		if impl.origin != nil {
+			return causeOf(impl.origin)
+		}
+		return nil
+	}
+	return errors.Unwrap(err)
+}
+
+// RootCause 返回最底层的原因，没有原因时返回err本身
+func RootCause(err error) error {
+	for err != nil {
+		cause := causeOf(err)
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+	return nil
+}
+
+// CauseChain 返回每一层原因的错误信息，不包括err本身，用于记录日志
+func CauseChain(err error) []string {
+	var chain []string
+	for cause := causeOf(err); cause != nil; cause = causeOf(cause) {
+		chain = append(chain, cause.Error())
+	}
+	return chain
+}
+
+// StackOf 返回错误链中捕获的堆栈，没有时返回空
+func StackOf(err error) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if stacker, ok := err.(interface{ StackTrace() string }); ok {
+			if stack := stacker.StackTrace(); stack != "" {
+				return stack
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package code
+
+import (
+	"net/http"
+)
+
+// Class 错误的分类，用于重试策略和监控
+type Class string
+
+// 错误的分类
+const (
+	ClassUnknown     Class = ""
+	ClassTransient   Class = "transient"   // 临时的失败，请求没有发出，比如连接被拒绝
+	ClassTimeout     Class = "timeout"     // 超时，请求可能已经被处理
+	ClassUnavailable Class = "unavailable" // 服务不可用，比如熔断开启，过载，限流
+	ClassInvalid     Class = "invalid"     // 请求不合法，重试也不会成功
+	ClassBusiness    Class = "business"    // 业务拒绝，比如余额不足
+	ClassInternal    Class = "internal"    // 内部错误，比如返回无法解析
+)
+
+// Retryable 该分类的错误是否可以重试，超时的请求可能已经被处理，只有幂等的请求才应当重试
+func (class Class) Retryable() bool {
+	switch class {
+	case ClassTransient, ClassTimeout, ClassUnavailable:
+		return true
+	}
+	return false
+}
+
+// ClassOfStatus HTTP状态码对应的分类，2xx返回ClassUnknown
+func ClassOfStatus(status int) Class {
+	switch {
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ClassTimeout
+	case status == http.StatusTooManyRequests || status == http.StatusBadGateway || status == http.StatusServiceUnavailable:
+		return ClassUnavailable
+	case status >= 400 && status < 500:
+		return ClassInvalid
+	case status >= 500:
+		return ClassInternal
+	}
+	return ClassUnknown
+}
+
+// Class 错误的分类，未设置时使用声明的分类
+func (err *errorImpl) Class() Class {
+	if err.class != ClassUnknown {
+		return err.class
+	}
+	if err.def != nil {
+		return err.def.Class
+	}
+	return ClassUnknown
+}
+
+// Retryable 错误是否可以重试，优先级为WithRetryable -> 声明的Retryable -> 分类
+func (err *errorImpl) Retryable() bool {
+	if err.retryable != nil {
+		return *err.retryable
+	}
+	if err.def != nil && err.def.Retryable {
+		return true
+	}
+	return err.Class().Retryable()
+}
+
+// WithClass 设置错误的分类
+func WithClass(err Error, class Class) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	impl.class = class
+	return impl
+}
+
+// WithRetryable 明确设置错误是否可以重试，优先于分类
+func WithRetryable(err Error, retryable bool) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	impl.retryable = &retryable
+	return impl
+}
+
+// ClassOf 返回错误的分类，没有分类时按mcode查找声明
+func ClassOf(err error) Class {
+	for e := err; e != nil; e = originOf(e) {
+		if classifier, ok := e.(interface{ Class() Class }); ok {
+			if class := classifier.Class(); class != ClassUnknown {
+				return class
+			}
+		}
+	}
+	if def := DefinitionOf(err); def != nil {
+		return def.Class
+	}
+	return ClassUnknown
+}
+
+// IsRetryable 错误是否可以重试，不是code.Error时返回false
+func IsRetryable(err error) bool {
+	for e := err; e != nil; e = originOf(e) {
+		if impl, ok := e.(*errorImpl); ok && impl.retryable != nil {
+			return *impl.retryable
+		}
+	}
+	if def := DefinitionOf(err); def != nil && def.Retryable {
+		return true
+	}
+	return ClassOf(err).Retryable()
+}
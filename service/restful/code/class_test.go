@@ -0,0 +1,67 @@
+package code
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestClass(t *testing.T) {
+	registry := NewRegistry("")
+	busy := registry.Define(Definition{Code: 2001, Mcode: "TEST_CLASS_BUSY", Message: "busy", Class: ClassUnavailable})
+	quota := registry.Define(Definition{Code: 2002, Mcode: "TEST_CLASS_QUOTA", Message: "quota", Class: ClassBusiness, Retryable: true})
+
+	tests := []struct {
+		name          string
+		err           error
+		wantClass     Class
+		wantRetryable bool
+	}{
+		{name: "nil", err: nil, wantClass: ClassUnknown},
+		{name: "plain", err: errors.New("plain"), wantClass: ClassUnknown},
+		{name: "unclassified", err: NewMcode("FAILED", "failed"), wantClass: ClassUnknown},
+		{name: "timeout", err: WithClass(NewMcode("FAILED", "failed"), ClassTimeout), wantClass: ClassTimeout, wantRetryable: true},
+		{name: "transient", err: WithClass(NewMcode("FAILED", "failed"), ClassTransient), wantClass: ClassTransient, wantRetryable: true},
+		{name: "invalid", err: WithClass(NewMcode("FAILED", "failed"), ClassInvalid), wantClass: ClassInvalid},
+		{name: "business", err: WithClass(NewMcode("FAILED", "failed"), ClassBusiness), wantClass: ClassBusiness},
+		{name: "override", err: WithRetryable(WithClass(NewMcode("FAILED", "failed"), ClassTimeout), false), wantClass: ClassTimeout},
+		{name: "override business", err: WithRetryable(WithClass(NewMcode("FAILED", "failed"), ClassBusiness), true), wantClass: ClassBusiness, wantRetryable: true},
+		{name: "definition class", err: busy.New(), wantClass: ClassUnavailable, wantRetryable: true},
+		{name: "definition retryable", err: quota.New(), wantClass: ClassBusiness, wantRetryable: true},
+		{name: "class over definition", err: WithClass(busy.New(), ClassInternal), wantClass: ClassInternal},
+		{name: "kept by clone", err: WithDetail(WithClass(NewMcode("FAILED", "failed"), ClassTimeout), "key", "value"), wantClass: ClassTimeout, wantRetryable: true},
+		{name: "other implementation", err: WithClass(&customError{cerr: NewMcode("CUSTOM", "custom")}, ClassTransient), wantClass: ClassTransient, wantRetryable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassOf(tt.err); got != tt.wantClass {
+				t.Errorf("ClassOf() = %v, want %v", got, tt.wantClass)
+			}
+			if got := IsRetryable(tt.err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestClassOfStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   Class
+	}{
+		{http.StatusOK, ClassUnknown},
+		{http.StatusBadRequest, ClassInvalid},
+		{http.StatusNotFound, ClassInvalid},
+		{http.StatusRequestTimeout, ClassTimeout},
+		{http.StatusTooManyRequests, ClassUnavailable},
+		{http.StatusInternalServerError, ClassInternal},
+		{http.StatusBadGateway, ClassUnavailable},
+		{http.StatusServiceUnavailable, ClassUnavailable},
+		{http.StatusGatewayTimeout, ClassTimeout},
+	}
+	for _, tt := range tests {
+		if got := ClassOfStatus(tt.status); got != tt.want {
+			t.Errorf("ClassOfStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
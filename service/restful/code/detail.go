@@ -0,0 +1,85 @@
+package code
+
+import (
+	"errors"
+)
+
+// FieldViolation 字段的违规信息，比如参数校验失败
+type FieldViolation struct {
+	Field   string `json:"field"`           // 字段名称
+	Rule    string `json:"rule"`            // 未通过的规则，比如required,max
+	Param   string `json:"param,omitempty"` // 规则的参数，比如max=10中的10
+	Message string `json:"message"`
+}
+
+// Details 附加信息，会返回给调用方
+func (err *errorImpl) Details() map[string]interface{} {
+	return err.details
+}
+
+// Violations 字段的违规信息，会返回给调用方
+func (err *errorImpl) Violations() []FieldViolation {
+	return err.violations
+}
+
+// WithDetail 附加一个返回给调用方的信息，不要放入内部的信息
+//
+//	return nil, code.WithDetail(code.NewMcode("BALANCE_NOT_ENOUGH", "balance not enough"), "balance", balance)
+func WithDetail(err Error, key string, value interface{}) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	details := make(map[string]interface{}, len(impl.details)+1)
+	for k, v := range DetailsOf(err) {
+		details[k] = v
+	}
+	details[key] = value
+	impl.details = details
+	return impl
+}
+
+// WithViolations 附加字段的违规信息
+func WithViolations(err Error, violations ...FieldViolation) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	impl.violations = append(append([]FieldViolation(nil), ViolationsOf(err)...), violations...)
+	return impl
+}
+
+// DetailsOf 返回错误的附加信息，不包括原因中的附加信息，没有时返回nil
+func DetailsOf(err error) map[string]interface{} {
+	for ; err != nil; err = originOf(err) {
+		if detailer, ok := err.(interface{ Details() map[string]interface{} }); ok {
+			if details := detailer.Details(); len(details) != 0 {
+				return details
+			}
+		}
+	}
+	return nil
+}
+
+// ViolationsOf 返回错误中字段的违规信息，不包括原因中的违规信息，没有时返回nil
+func ViolationsOf(err error) []FieldViolation {
+	for ; err != nil; err = originOf(err) {
+		if violator, ok := err.(interface{ Violations() []FieldViolation }); ok {
+			if violations := violator.Violations(); len(violations) != 0 {
+				return violations
+			}
+		}
+	}
+	return nil
+}
+
+// originOf 附加信息之前的错误，原因中的信息属于内部信息，不返回给调用方
+func originOf(err error) error {
+	if impl, ok := err.(*errorImpl); ok {
+		if impl.origin == nil {
+			return nil
+		}
+		return impl.origin
+	}
+	return errors.Unwrap(err)
+}
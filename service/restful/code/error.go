@@ -15,14 +15,30 @@ type errorImpl struct {
 	message string
 	mcode   string
 	code    int
+
+	cause      error                  // 原始错误，只记录在日志中，不返回给调用方
+	origin     Error                  // 使用WithDetail等附加信息时的原始code.Error
+	stack      []uintptr              // WithStack捕获的堆栈
+	details    map[string]interface{} // 返回给调用方的附加信息
+	violations []FieldViolation       // 字段的违规信息
+	def        *Definition            // 使用Definition创建时的声明
+	params     map[string]interface{} // 错误信息模板的参数
+	class      Class                  // 错误的分类
+	retryable  *bool                  // 明确设置的是否可以重试
 }
 
 func (err *errorImpl) Error() string {
+	var s string
 	if err.mcode == "" {
-		return fmt.Sprintf("%d,%s", err.code, err.message)
+		s = fmt.Sprintf("%d,%s", err.code, err.message)
+	} else {
+		s = fmt.Sprintf("%s,%s", err.mcode, err.message)
+	}
+	if err.cause != nil && err.cause.Error() != err.message {
+		s += ": " + err.cause.Error()
 	}
 
-	return fmt.Sprintf("%s,%s", err.mcode, err.message)
+	return s
 }
 
 func (err *errorImpl) Message() string {
@@ -74,10 +90,13 @@ func NewPrefixln(prefix string, code int, args ...interface{}) Error {
 	}
 }
 
+// NewError 使用err的内容作为错误信息，err可以通过errors.Is/As或Unwrap获取
+// err中的内部信息会返回给调用方，不希望暴露时使用Wrap
 func NewError(code int, err error) Error {
 	return &errorImpl{
 		code:    code,
-		message: err.Error(), //
+		message: err.Error(),
+		cause:   err,
 	}
 }
 
@@ -1,7 +1,9 @@
 package code
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +38,87 @@ func TestErrorString(t *testing.T) {
 		})
 	}
 }
+
+func TestWrap(t *testing.T) {
+	root := errors.New("dial tcp 10.0.0.1:3306: connection refused")
+	middle := fmt.Errorf("query user failed: %w", root)
+	err := Wrap(2001, middle, "user service unavailable")
+
+	if !errors.Is(err, root) {
+		t.Errorf("errors.Is(err, root) = false")
+	}
+	if err.Message() != "user service unavailable" {
+		t.Errorf("Message() = %q, cause should not be in message", err.Message())
+	}
+	if want := "2001,user service unavailable: query user failed: " + root.Error(); err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if RootCause(err) != root {
+		t.Errorf("RootCause() = %v", RootCause(err))
+	}
+	if chain := CauseChain(err); len(chain) != 2 || chain[1] != root.Error() {
+		t.Errorf("CauseChain() = %v", chain)
+	}
+
+	legacy := NewError(1, root)
+	if legacy.Error() != "1,"+root.Error() || !errors.Is(legacy, root) {
+		t.Errorf("NewError() = %v", legacy)
+	}
+}
+
+type customError struct{ cerr Error }
+
+func (err *customError) Error() string   { return err.cerr.Error() }
+func (err *customError) Code() int       { return err.cerr.Code() }
+func (err *customError) Mcode() string   { return err.cerr.Mcode() }
+func (err *customError) Message() string { return err.cerr.Message() }
+
+func TestDetails(t *testing.T) {
+	base := NewMcode("BALANCE_NOT_ENOUGH", "balance not enough")
+	err := WithDetail(WithDetail(base, "balance", 10), "required", 20)
+	if details := DetailsOf(err); len(details) != 2 || details["balance"] != 10 || details["required"] != 20 {
+		t.Errorf("DetailsOf() = %v", details)
+	}
+	if DetailsOf(base) != nil {
+		t.Errorf("WithDetail should not modify the original error")
+	}
+	if err.Mcode() != "BALANCE_NOT_ENOUGH" || err.Message() != "balance not enough" || err.Error() != base.Error() {
+		t.Errorf("WithDetail() = %v", err)
+	}
+
+	// 原因中的附加信息不返回给调用方
+	internal := WithDetail(New(1, "internal"), "dsn", "mysql://root@db")
+	if details := DetailsOf(Wrap(2, internal, "failed")); details != nil {
+		t.Errorf("details of cause should be hidden, got %v", details)
+	}
+
+	custom := &customError{cerr: New(3, "custom")}
+	withViolations := WithViolations(custom, FieldViolation{Field: "name", Rule: "required"})
+	if violations := ViolationsOf(withViolations); len(violations) != 1 || violations[0].Field != "name" {
+		t.Errorf("ViolationsOf() = %v", violations)
+	}
+	var target *customError
+	if !errors.As(withViolations, &target) || withViolations.Code() != 3 {
+		t.Errorf("errors.As should find the original error")
+	}
+	if CauseChain(withViolations) != nil {
+		t.Errorf("CauseChain() = %v, want nil", CauseChain(withViolations))
+	}
+}
+
+func TestWithStack(t *testing.T) {
+	err := WithStack(New(1, "failed"))
+	stack := StackOf(err)
+	if !strings.Contains(stack, "TestWithStack") {
+		t.Errorf("StackOf() = %s", stack)
+	}
+	if StackOf(WithStack(err)) != stack {
+		t.Errorf("WithStack should keep the first stack")
+	}
+	if StackOf(Wrap(2, err, "wrapped")) != stack {
+		t.Errorf("StackOf should find the stack of the cause")
+	}
+	if StackOf(New(1, "failed")) != "" {
+		t.Errorf("StackOf() without stack should be empty")
+	}
+}
@@ -0,0 +1,216 @@
+package code
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog 按mcode和语言的错误信息模板，模板中使用{name}引用参数
+//
+//	catalog := code.NewCatalog("en")
+//	catalog.Add("zh-CN", "BALANCE_NOT_ENOUGH", "余额不足，当前余额{balance}")
+//	catalog.Add("en", "BALANCE_NOT_ENOUGH", "Insufficient balance: {balance}")
+//
+//	return nil, code.WithParam(code.NewMcode("BALANCE_NOT_ENOUGH", "balance not enough"), "balance", balance)
+type Catalog struct {
+	fallback string
+	mutex    sync.RWMutex
+	messages map[string]map[string]string // 语言 -> mcode -> 模板
+}
+
+// NewCatalog 创建错误信息目录，fallback为客户端的语言都没有模板时使用的语言，可以为空
+func NewCatalog(fallback string) *Catalog {
+	return &Catalog{
+		fallback: normalizeLocale(fallback),
+		messages: make(map[string]map[string]string),
+	}
+}
+
+// Add 添加语言中mcode的模板
+func (catalog *Catalog) Add(locale, mcode, template string) *Catalog {
+	return catalog.AddMessages(locale, map[string]string{mcode: template})
+}
+
+// AddMessages 添加语言中多个mcode的模板
+func (catalog *Catalog) AddMessages(locale string, messages map[string]string) *Catalog {
+	locale = normalizeLocale(locale)
+	catalog.mutex.Lock()
+	defer catalog.mutex.Unlock()
+
+	templates, exist := catalog.messages[locale]
+	if !exist {
+		templates = make(map[string]string, len(messages))
+		catalog.messages[locale] = templates
+	}
+	for mcode, template := range messages {
+		templates[mcode] = template
+	}
+	return catalog
+}
+
+// LoadDir 加载目录中的<语言>.json文件，文件的内容为mcode到模板的映射
+//
+//	messages/zh-CN.json: {"BALANCE_NOT_ENOUGH": "余额不足，当前余额{balance}"}
+func (catalog *Catalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read message file failed,%v", err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return fmt.Errorf("message file %s is not a json object,%v", file, err)
+		}
+		catalog.AddMessages(strings.TrimSuffix(filepath.Base(file), ".json"), messages)
+	}
+	return nil
+}
+
+// Localize 使用第一个有模板的语言渲染错误信息，参数来自WithParam和WithDetail
+// 没有模板时返回false，返回的locale为使用的语言
+func (catalog *Catalog) Localize(err Error, locales ...string) (message, locale string, ok bool) {
+	if err == nil {
+		return "", "", false
+	}
+	return catalog.Message(err.Mcode(), ParamsOf(err), locales...)
+}
+
+// Message 使用第一个有模板的语言渲染mcode的错误信息，没有模板时返回false
+func (catalog *Catalog) Message(mcode string, params map[string]interface{}, locales ...string) (message, locale string, ok bool) {
+	if mcode == "" {
+		return "", "", false
+	}
+
+	catalog.mutex.RLock()
+	defer catalog.mutex.RUnlock()
+
+	candidates := make([]string, 0, len(locales)*2+1)
+	for _, locale := range locales {
+		locale = normalizeLocale(locale)
+		candidates = append(candidates, locale)
+		// zh-CN没有模板时使用zh
+		if index := strings.Index(locale, "-"); index > 0 {
+			candidates = append(candidates, locale[:index])
+		}
+	}
+	if catalog.fallback != "" {
+		candidates = append(candidates, catalog.fallback)
+	}
+	for _, locale := range candidates {
+		if template, exist := catalog.messages[locale][mcode]; exist {
+			return render(template, params), locale, true
+		}
+	}
+	return "", "", false
+}
+
+// render 替换模板中的{name}，没有的参数保持原样
+func render(template string, params map[string]interface{}) string {
+	if len(params) == 0 || !strings.Contains(template, "{") {
+		return template
+	}
+	replacements := make([]string, 0, len(params)*2)
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
+
+// normalizeLocale 统一语言的格式，比如zh_cn为zh-CN
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.Replace(strings.TrimSpace(locale), "_", "-", -1), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// ParseAcceptLanguage 按q值从高到低返回Accept-Language中的语言，忽略*和q=0
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		locale := strings.TrimSpace(params[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{locale: locale, q: q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	locales := make([]string, 0, len(langs))
+	for _, lang := range langs {
+		locales = append(locales, lang.locale)
+	}
+	return locales
+}
+
+// WithParam 附加一个错误信息模板的参数，参数不会返回给调用方
+func WithParam(err Error, key string, value interface{}) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	params := make(map[string]interface{}, len(impl.params)+1)
+	for k, v := range impl.params {
+		params[k] = v
+	}
+	params[key] = value
+	impl.params = params
+	return impl
+}
+
+// WithMessage 替换返回给调用方的错误信息，其他信息保持不变
+func WithMessage(err Error, message string) Error {
+	if err == nil {
+		return nil
+	}
+	impl := cloneOf(err)
+	impl.message = message
+	return impl
+}
+
+// ParamsOf 返回错误信息模板的参数，包括附加信息
+func ParamsOf(err error) map[string]interface{} {
+	params := map[string]interface{}{}
+	for k, v := range DetailsOf(err) {
+		params[k] = v
+	}
+	for e := err; e != nil; e = originOf(e) {
+		if impl, ok := e.(*errorImpl); ok {
+			for k, v := range impl.params {
+				params[k] = v
+			}
+			break
+		}
+	}
+	return params
+}
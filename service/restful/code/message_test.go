@@ -0,0 +1,87 @@
+package code
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	catalog := NewCatalog("en")
+	catalog.Add("en", "BALANCE_NOT_ENOUGH", "Insufficient balance: {balance}, need {required}")
+	catalog.Add("zh", "BALANCE_NOT_ENOUGH", "余额不足，当前余额{balance}")
+	catalog.Add("zh_tw", "BALANCE_NOT_ENOUGH", "餘額不足")
+
+	err := WithParam(WithDetail(NewMcode("BALANCE_NOT_ENOUGH", "balance not enough"), "balance", 10), "required", 20)
+	tests := []struct {
+		name        string
+		locales     []string
+		want        string
+		wantLocale  string
+		wantMissing bool
+	}{
+		{name: "exact", locales: []string{"zh-TW"}, want: "餘額不足", wantLocale: "zh-TW"},
+		{name: "base language", locales: []string{"zh-CN"}, want: "余额不足，当前余额10", wantLocale: "zh"},
+		{name: "first matched", locales: []string{"fr", "zh"}, want: "余额不足，当前余额10", wantLocale: "zh"},
+		{name: "fallback", locales: []string{"fr"}, want: "Insufficient balance: 10, need 20", wantLocale: "en"},
+		{name: "no locale", want: "Insufficient balance: 10, need 20", wantLocale: "en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, locale, ok := catalog.Localize(err, tt.locales...)
+			if !ok || message != tt.want || locale != tt.wantLocale {
+				t.Errorf("Localize() = %q, %q, %v, want %q, %q", message, locale, ok, tt.want, tt.wantLocale)
+			}
+		})
+	}
+
+	if _, _, ok := catalog.Localize(NewMcode("OTHER", "other"), "en"); ok {
+		t.Errorf("Localize() of unknown mcode should return false")
+	}
+	if _, _, ok := NewCatalog("").Localize(err, "en"); ok {
+		t.Errorf("Localize() of empty catalog should return false")
+	}
+
+	localized := WithMessage(err, "余额不足")
+	if localized.Message() != "余额不足" || err.Message() != "balance not enough" || DetailsOf(localized)["balance"] != 10 {
+		t.Errorf("WithMessage() = %v, original = %v", localized, err)
+	}
+}
+
+func TestCatalogLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "zh-CN.json"), []byte(`{"USER_NOT_FOUND": "用户{id}不存在"}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"USER_NOT_FOUND": "User {id} not found"}`), 0644)
+
+	catalog := NewCatalog("")
+	if err := catalog.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	message, _, _ := catalog.Message("USER_NOT_FOUND", map[string]interface{}{"id": 1}, "zh-cn")
+	if message != "用户1不存在" {
+		t.Errorf("Message() = %q", message)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "fr.json"), []byte(`[]`), 0644)
+	if err := catalog.LoadDir(dir); err == nil {
+		t.Errorf("LoadDir() with bad file should fail")
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{header: "", want: []string{}},
+		{header: "zh-CN", want: []string{"zh-CN"}},
+		{header: "en;q=0.8, zh-CN, zh;q=0.9, *;q=0.1", want: []string{"zh-CN", "zh", "en"}},
+		{header: "fr;q=0, en", want: []string{"en"}},
+	}
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
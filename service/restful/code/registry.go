@@ -0,0 +1,206 @@
+package code
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Definition 一个错误的声明，使用Registry.Define声明后通过New,Newf,Wrap创建错误
+//
+//	var ErrUserNotFound = code.Define(code.Definition{
+//	    Code: 1001, Mcode: "USER_NOT_FOUND", Message: "user not found", Status: http.StatusNotFound,
+//	})
+//
+//	return nil, ErrUserNotFound.Newf("user %s not found", id)
+type Definition struct {
+	Code        int    `json:"code"`
+	Mcode       string `json:"mcode"`                 // 为空时为 前缀_错误码
+	Message     string `json:"message"`               // 默认的错误信息
+	Status      int    `json:"status,omitempty"`      // HTTP状态码，0表示由StatusMapping决定
+	Retryable   bool   `json:"retryable"`             // 调用方是否可以重试，为false时由Class决定
+	Class       Class  `json:"class,omitempty"`       // 错误的分类
+	Description string `json:"description,omitempty"` // 文档中的说明
+}
+
+// New 使用默认的错误信息创建错误
+func (def *Definition) New() Error {
+	return &errorImpl{
+		code:    def.Code,
+		mcode:   def.Mcode,
+		message: def.Message,
+		def:     def,
+	}
+}
+
+// Newf 使用格式化的错误信息创建错误
+func (def *Definition) Newf(format string, args ...interface{}) Error {
+	return &errorImpl{
+		code:    def.Code,
+		mcode:   def.Mcode,
+		message: fmt.Sprintf(format, args...),
+		def:     def,
+	}
+}
+
+// Wrap 使用默认的错误信息创建以err为原因的错误
+func (def *Definition) Wrap(err error) Error {
+	return &errorImpl{
+		code:    def.Code,
+		mcode:   def.Mcode,
+		message: def.Message,
+		cause:   err,
+		def:     def,
+	}
+}
+
+// Is 判断err是否为该声明的错误
+func (def *Definition) Is(err error) bool {
+	cerr, ok := err.(Error)
+	return ok && cerr.Mcode() == def.Mcode
+}
+
+// Registry 错误的声明目录，错误码和mcode都不能重复
+type Registry struct {
+	prefix  string
+	mutex   sync.RWMutex
+	byMcode map[string]*Definition
+	byCode  map[int]*Definition
+}
+
+// NewRegistry 创建声明目录，prefix用于生成未指定的mcode
+func NewRegistry(prefix string) *Registry {
+	return &Registry{
+		prefix:  prefix,
+		byMcode: make(map[string]*Definition),
+		byCode:  make(map[int]*Definition),
+	}
+}
+
+// Default 默认的声明目录，code.Define使用
+var Default = NewRegistry("")
+
+// SetPrefix 设置默认声明目录的前缀，需要在声明之前调用
+func SetPrefix(prefix string) {
+	Default.mutex.Lock()
+	defer Default.mutex.Unlock()
+	Default.prefix = prefix
+}
+
+// Define 在默认的声明目录中声明错误，重复时panic
+func Define(def Definition) *Definition {
+	return Default.Define(def)
+}
+
+// Lookup 在默认的声明目录中查找mcode
+func Lookup(mcode string) *Definition {
+	return Default.Lookup(mcode)
+}
+
+// Define 声明错误，错误码或mcode重复时panic，通常在包初始化时调用
+func (registry *Registry) Define(def Definition) *Definition {
+	d, err := registry.Register(def)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Register 声明错误，错误码或mcode重复时返回错误
+func (registry *Registry) Register(def Definition) (*Definition, error) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if def.Mcode == "" {
+		if registry.prefix == "" {
+			return nil, fmt.Errorf("error %d has neither mcode nor registry prefix", def.Code)
+		}
+		def.Mcode = fmt.Sprintf("%s_%d", registry.prefix, def.Code)
+	}
+	if exist, ok := registry.byMcode[def.Mcode]; ok {
+		return nil, fmt.Errorf("mcode %s already defined by code %d", def.Mcode, exist.Code)
+	}
+	if exist, ok := registry.byCode[def.Code]; ok && def.Code != 0 {
+		return nil, fmt.Errorf("code %d already defined by mcode %s", def.Code, exist.Mcode)
+	}
+
+	d := &def
+	registry.byMcode[d.Mcode] = d
+	if d.Code != 0 {
+		registry.byCode[d.Code] = d
+	}
+	return d, nil
+}
+
+// Lookup 查找mcode的声明，没有时返回nil
+func (registry *Registry) Lookup(mcode string) *Definition {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return registry.byMcode[mcode]
+}
+
+// Definitions 所有的声明，按错误码排序
+func (registry *Registry) Definitions() []Definition {
+	registry.mutex.RLock()
+	defs := make([]Definition, 0, len(registry.byMcode))
+	for _, def := range registry.byMcode {
+		defs = append(defs, *def)
+	}
+	registry.mutex.RUnlock()
+
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Code != defs[j].Code {
+			return defs[i].Code < defs[j].Code
+		}
+		return defs[i].Mcode < defs[j].Mcode
+	})
+	return defs
+}
+
+// ExportJSON 以JSON数组导出所有的声明
+func (registry *Registry) ExportJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(registry.Definitions())
+}
+
+// ExportMarkdown 以Markdown表格导出所有的声明，用于接口文档
+func (registry *Registry) ExportMarkdown(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("| Mcode | Code | HTTP | Retryable | Message | Description |\n")
+	b.WriteString("|-------|------|------|-----------|---------|-------------|\n")
+	for _, def := range registry.Definitions() {
+		status := ""
+		if def.Status != 0 {
+			status = fmt.Sprint(def.Status)
+		}
+		retryable := ""
+		if def.Retryable || def.Class.Retryable() {
+			retryable = "yes"
+		}
+		fmt.Fprintf(&b, "| %s | %d | %s | %s | %s | %s |\n",
+			def.Mcode, def.Code, status, retryable, markdownEscape(def.Message), markdownEscape(def.Description))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// DefinitionOf 返回错误的声明，错误不是由声明创建时按mcode在默认的声明目录中查找
+func DefinitionOf(err error) *Definition {
+	for e := err; e != nil; e = originOf(e) {
+		if impl, ok := e.(*errorImpl); ok && impl.def != nil {
+			return impl.def
+		}
+	}
+	if cerr, ok := err.(Error); ok && cerr.Mcode() != "" {
+		return Lookup(cerr.Mcode())
+	}
+	return nil
+}
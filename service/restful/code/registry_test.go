@@ -0,0 +1,86 @@
+package code
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry("USER")
+	notFound := registry.Define(Definition{Code: 1001, Mcode: "USER_NOT_FOUND", Message: "user not found", Status: 404})
+	busy := registry.Define(Definition{Code: 1002, Message: "user service busy", Retryable: true, Description: "retry | later"})
+
+	if busy.Mcode != "USER_1002" {
+		t.Errorf("generated mcode = %s, want USER_1002", busy.Mcode)
+	}
+
+	tests := []struct {
+		name    string
+		def     Definition
+		wantErr string
+	}{
+		{name: "duplicate mcode", def: Definition{Code: 2001, Mcode: "USER_NOT_FOUND"}, wantErr: "mcode USER_NOT_FOUND already defined"},
+		{name: "duplicate code", def: Definition{Code: 1001, Mcode: "OTHER"}, wantErr: "code 1001 already defined"},
+		{name: "duplicate generated mcode", def: Definition{Code: 1002}, wantErr: "mcode USER_1002 already defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := registry.Register(tt.def); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Register() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Define() with duplicate mcode should panic")
+			}
+		}()
+		registry.Define(Definition{Mcode: "USER_NOT_FOUND"})
+	}()
+	if _, err := NewRegistry("").Register(Definition{Code: 1}); err == nil {
+		t.Errorf("Register() without mcode and prefix should fail")
+	}
+
+	err := notFound.Newf("user %d not found", 1)
+	if err.Code() != 1001 || err.Mcode() != "USER_NOT_FOUND" || err.Message() != "user 1 not found" || DefinitionOf(err) != notFound {
+		t.Errorf("Newf() = %v", err)
+	}
+	cause := errors.New("timeout")
+	wrapped := busy.Wrap(cause)
+	if wrapped.Message() != "user service busy" || !errors.Is(wrapped, cause) || !busy.Is(wrapped) || notFound.Is(wrapped) {
+		t.Errorf("Wrap() = %v", wrapped)
+	}
+	if DefinitionOf(WithDetail(notFound.New(), "id", 1)) != notFound {
+		t.Errorf("DefinitionOf() should keep the definition after WithDetail")
+	}
+
+	var buf bytes.Buffer
+	if err := registry.ExportJSON(&buf); err != nil {
+		t.Fatalf("ExportJSON() error = %v", err)
+	}
+	var defs []Definition
+	if err := json.Unmarshal(buf.Bytes(), &defs); err != nil || len(defs) != 2 || defs[0].Mcode != "USER_NOT_FOUND" || !defs[1].Retryable {
+		t.Errorf("ExportJSON() = %s", buf.String())
+	}
+
+	buf.Reset()
+	registry.ExportMarkdown(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || lines[2] != "| USER_NOT_FOUND | 1001 | 404 |  | user not found |  |" || !strings.Contains(lines[3], `retry \| later`) {
+		t.Errorf("ExportMarkdown() = %s", buf.String())
+	}
+}
+
+func TestDefinitionOfDefault(t *testing.T) {
+	def := Define(Definition{Code: 990001, Mcode: "TEST_DEFAULT_REGISTRY", Message: "test", Status: 409})
+	if Lookup("TEST_DEFAULT_REGISTRY") != def || DefinitionOf(NewMcode("TEST_DEFAULT_REGISTRY", "other")) != def {
+		t.Errorf("errors with a defined mcode should find the definition")
+	}
+	if DefinitionOf(New(1, "undefined")) != nil {
+		t.Errorf("DefinitionOf() of undefined error should be nil")
+	}
+}
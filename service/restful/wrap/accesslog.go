@@ -0,0 +1,393 @@
+package wrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lworkltd/kits/service/profile"
+)
+
+// 访问日志的格式
+const (
+	AccessLogCombined = "combined" // Apache combined格式，其他字段以key=value的形式附加在行尾
+	AccessLogJSON     = "json"
+)
+
+// 访问日志可选的字段，method,path,query和time总是记录
+const (
+	AccessFieldStatus    = "status"
+	AccessFieldMcode     = "mcode"
+	AccessFieldLatency   = "latency"
+	AccessFieldBytesIn   = "bytes_in"
+	AccessFieldBytesOut  = "bytes_out"
+	AccessFieldClientIP  = "client_ip"
+	AccessFieldUserAgent = "user_agent"
+	AccessFieldTraceId   = "trace_id"
+	AccessFieldRequestId = "request_id"
+	AccessFieldRoute     = "route"
+	AccessFieldReferer   = "referer"
+)
+
+// DefaultAccessFields 默认记录的字段
+var DefaultAccessFields = []string{
+	AccessFieldStatus,
+	AccessFieldMcode,
+	AccessFieldLatency,
+	AccessFieldBytesIn,
+	AccessFieldBytesOut,
+	AccessFieldClientIP,
+	AccessFieldUserAgent,
+	AccessFieldTraceId,
+	AccessFieldRequestId,
+	AccessFieldRoute,
+	AccessFieldReferer,
+}
+
+// AccessLogOption 访问日志的配置
+type AccessLogOption struct {
+	// Writer 日志输出，优先于FilePath，都未设置时使用标准输出
+	Writer   io.Writer
+	FilePath string
+	// Format combined或json，默认combined
+	Format string
+	// Fields 记录的字段，默认DefaultAccessFields
+	Fields []string
+	// SuccessSampling 成功请求的采样比例(0,1]，默认1，失败的请求总是记录
+	SuccessSampling float64
+	// TrustedProxies 可信代理的IP或CIDR，为空时总是信任X-Forwarded-For
+	TrustedProxies []string
+}
+
+// AccessRecord 单个请求的访问记录
+type AccessRecord struct {
+	Time      time.Time
+	Method    string
+	Proto     string
+	Path      string
+	Query     string
+	Route     string // 注册路径，比如/user/:id
+	Status    int
+	Mcode     string // 成功时为空
+	Latency   time.Duration
+	BytesIn   int64
+	BytesOut  int
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	TraceId   string
+	RequestId string
+}
+
+// AccessLogger 访问日志，与服务日志分开输出
+type AccessLogger struct {
+	writer   io.Writer
+	mutex    sync.Mutex
+	json     bool
+	fields   map[string]bool
+	order    []string
+	sampling float64
+	proxies  []*net.IPNet
+}
+
+// NewAccessLogger 创建访问日志
+func NewAccessLogger(option *AccessLogOption) (*AccessLogger, error) {
+	logger := &AccessLogger{
+		writer:   option.Writer,
+		sampling: option.SuccessSampling,
+		fields:   map[string]bool{},
+	}
+
+	if logger.writer == nil {
+		logger.writer = os.Stdout
+		if option.FilePath != "" {
+			file, err := os.OpenFile(option.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+			if err != nil {
+				return nil, fmt.Errorf("open access log file failed,err:%v,path:%v", err, option.FilePath)
+			}
+			logger.writer = file
+		}
+	}
+
+	switch option.Format {
+	case AccessLogCombined, "":
+	case AccessLogJSON:
+		logger.json = true
+	default:
+		return nil, fmt.Errorf("unsupport access log format %s", option.Format)
+	}
+
+	fields := option.Fields
+	if len(fields) == 0 {
+		fields = DefaultAccessFields
+	}
+	known := map[string]bool{}
+	for _, field := range DefaultAccessFields {
+		known[field] = true
+	}
+	for _, field := range fields {
+		if !known[field] {
+			return nil, fmt.Errorf("unknown access log field %s", field)
+		}
+		if !logger.fields[field] {
+			logger.fields[field] = true
+			logger.order = append(logger.order, field)
+		}
+	}
+
+	if logger.sampling <= 0 || logger.sampling > 1 {
+		logger.sampling = 1
+	}
+
+	proxies, err := parseTrustedProxies(option.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	logger.proxies = proxies
+
+	return logger, nil
+}
+
+// parseTrustedProxies 解析可信代理的IP或CIDR
+func parseTrustedProxies(trustedProxies []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("bad trusted proxy %s,%v", proxy, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// NewAccessLoggerWithProfile 使用服务配置创建访问日志，未启用时返回nil
+func NewAccessLoggerWithProfile(cfg *profile.Service) (*AccessLogger, error) {
+	if !cfg.AccessLogEnabled {
+		return nil, nil
+	}
+
+	return NewAccessLogger(&AccessLogOption{
+		FilePath:        cfg.AccessLog.File,
+		Format:          cfg.AccessLog.Format,
+		Fields:          cfg.AccessLog.Fields,
+		SuccessSampling: cfg.AccessLog.SuccessSampling,
+		TrustedProxies:  cfg.AccessLog.TrustedProxies,
+	})
+}
+
+// Sampled 成功的请求是否需要记录
+func (logger *AccessLogger) Sampled() bool {
+	return logger.sampling >= 1 || rand.Float64() < logger.sampling
+}
+
+// ClientIP 请求的客户端IP
+// 远端地址是可信代理(未配置可信代理时总是信任)时，使用X-Forwarded-For中最右侧的不可信地址，其次使用X-Real-Ip
+func (logger *AccessLogger) ClientIP(request *http.Request) string {
+	return clientIP(request, logger.proxies)
+}
+
+// remoteIP 连接的远端地址，不解析任何请求头
+func remoteIP(request *http.Request) string {
+	remote, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return remote
+}
+
+// clientIP 远端地址是可信代理时解析X-Forwarded-For和X-Real-Ip，proxies为空时总是信任
+func clientIP(request *http.Request, proxies []*net.IPNet) string {
+	remote := remoteIP(request)
+	if !trustedProxy(proxies, remote) {
+		return remote
+	}
+
+	if forwarded := request.Header.Values("X-Forwarded-For"); len(forwarded) != 0 {
+		ips := make([]string, 0, 4)
+		for _, ip := range strings.Split(strings.Join(forwarded, ","), ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				ips = append(ips, ip)
+			}
+		}
+		if len(ips) != 0 {
+			if len(proxies) == 0 {
+				return ips[0]
+			}
+			for i := len(ips) - 1; i > 0; i-- {
+				if !trustedProxy(proxies, ips[i]) {
+					return ips[i]
+				}
+			}
+			return ips[0]
+		}
+	}
+
+	if realIP := strings.TrimSpace(request.Header.Get("X-Real-Ip")); realIP != "" {
+		return realIP
+	}
+
+	return remote
+}
+
+func trustedProxy(proxies []*net.IPNet, ip string) bool {
+	if len(proxies) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Log 输出一条访问记录
+func (logger *AccessLogger) Log(record *AccessRecord) {
+	var line []byte
+	if logger.json {
+		line = logger.formatJSON(record)
+	} else {
+		line = logger.formatCombined(record)
+	}
+
+	logger.mutex.Lock()
+	logger.writer.Write(line)
+	logger.mutex.Unlock()
+}
+
+func (logger *AccessLogger) value(record *AccessRecord, field string) interface{} {
+	switch field {
+	case AccessFieldStatus:
+		return record.Status
+	case AccessFieldMcode:
+		return record.Mcode
+	case AccessFieldLatency:
+		return float64(record.Latency.Microseconds()) / 1000
+	case AccessFieldBytesIn:
+		return record.BytesIn
+	case AccessFieldBytesOut:
+		return record.BytesOut
+	case AccessFieldClientIP:
+		return record.ClientIP
+	case AccessFieldUserAgent:
+		return record.UserAgent
+	case AccessFieldTraceId:
+		return record.TraceId
+	case AccessFieldRequestId:
+		return record.RequestId
+	case AccessFieldRoute:
+		return record.Route
+	case AccessFieldReferer:
+		return record.Referer
+	}
+	return nil
+}
+
+func (logger *AccessLogger) formatJSON(record *AccessRecord) []byte {
+	data := make(map[string]interface{}, len(logger.order)+4)
+	data["time"] = record.Time.Format(time.RFC3339Nano)
+	data["method"] = record.Method
+	data["path"] = record.Path
+	if record.Query != "" {
+		data["query"] = record.Query
+	}
+	for _, field := range logger.order {
+		data[field] = logger.value(record, field)
+	}
+	if _, exist := data[AccessFieldLatency]; exist {
+		// 延迟的单位为毫秒
+		data["latency_ms"] = data[AccessFieldLatency]
+		delete(data, AccessFieldLatency)
+	}
+
+	line, err := json.Marshal(data)
+	if err != nil {
+		return []byte(fmt.Sprintf("{\"error\":%q}\n", err.Error()))
+	}
+	return append(line, '\n')
+}
+
+// formatCombined host - - [time] "request" status bytes "referer" "user-agent" key=value...
+func (logger *AccessLogger) formatCombined(record *AccessRecord) []byte {
+	uri := record.Path
+	if record.Query != "" {
+		uri += "?" + record.Query
+	}
+	dash := func(field, value string) string {
+		if !logger.fields[field] || value == "" {
+			return "-"
+		}
+		return value
+	}
+	status, bytesOut := "-", "-"
+	if logger.fields[AccessFieldStatus] {
+		status = strconv.Itoa(record.Status)
+	}
+	if logger.fields[AccessFieldBytesOut] {
+		bytesOut = strconv.Itoa(record.BytesOut)
+	}
+
+	b := make([]byte, 0, 256)
+	b = append(b, dash(AccessFieldClientIP, record.ClientIP)...)
+	b = append(b, " - - ["...)
+	b = append(b, record.Time.Format("02/Jan/2006:15:04:05 -0700")...)
+	b = append(b, "] "...)
+	b = strconv.AppendQuote(b, record.Method+" "+uri+" "+record.Proto)
+	b = append(b, ' ')
+	b = append(b, status...)
+	b = append(b, ' ')
+	b = append(b, bytesOut...)
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, dash(AccessFieldReferer, record.Referer))
+	b = append(b, ' ')
+	b = strconv.AppendQuote(b, dash(AccessFieldUserAgent, record.UserAgent))
+
+	for _, field := range logger.order {
+		switch field {
+		case AccessFieldClientIP, AccessFieldStatus, AccessFieldBytesOut, AccessFieldReferer, AccessFieldUserAgent:
+			continue
+		case AccessFieldLatency:
+			b = append(b, " latency="...)
+			b = append(b, record.Latency.String()...)
+		default:
+			b = append(b, ' ')
+			b = append(b, field...)
+			b = append(b, '=')
+			b = append(b, dash(field, fmt.Sprint(logger.value(record, field)))...)
+		}
+	}
+
+	return append(b, '\n')
+}
+
+// countingBody 统计读取的请求消息体字节数
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.n += int64(n)
+	return n, err
+}
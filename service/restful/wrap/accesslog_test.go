@@ -0,0 +1,157 @@
+package wrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestAccessLogger_ClientIP(t *testing.T) {
+	open, _ := NewAccessLogger(&AccessLogOption{})
+	trusted, _ := NewAccessLogger(&AccessLogOption{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}})
+
+	tests := []struct {
+		name      string
+		logger    *AccessLogger
+		remote    string
+		forwarded string
+		realIP    string
+		want      string
+	}{
+		{name: "remote", logger: open, remote: "1.2.3.4:5678", want: "1.2.3.4"},
+		{name: "forwarded", logger: open, remote: "10.0.0.1:80", forwarded: "1.1.1.1, 10.0.0.2", want: "1.1.1.1"},
+		{name: "real ip", logger: open, remote: "10.0.0.1:80", realIP: "2.2.2.2", want: "2.2.2.2"},
+		{name: "untrusted remote", logger: trusted, remote: "8.8.8.8:80", forwarded: "1.1.1.1", want: "8.8.8.8"},
+		{name: "rightmost untrusted", logger: trusted, remote: "192.168.1.1:80", forwarded: "6.6.6.6, 1.1.1.1, 10.0.0.2", want: "1.1.1.1"},
+		{name: "all trusted", logger: trusted, remote: "10.0.0.1:80", forwarded: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-Ip", tt.realIP)
+			}
+			if got := tt.logger.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccessLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  *AccessLogOption
+		wantErr bool
+	}{
+		{name: "default", option: &AccessLogOption{}},
+		{name: "json", option: &AccessLogOption{Format: AccessLogJSON, Fields: []string{AccessFieldStatus}}},
+		{name: "bad format", option: &AccessLogOption{Format: "xml"}, wantErr: true},
+		{name: "bad field", option: &AccessLogOption{Fields: []string{"cookie"}}, wantErr: true},
+		{name: "bad proxy", option: &AccessLogOption{TrustedProxies: []string{"10.0.0.0/99"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAccessLogger(tt.option); (err != nil) != tt.wantErr {
+				t.Errorf("NewAccessLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWrapAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var accessBuf, serviceBuf bytes.Buffer
+	accessLog, err := NewAccessLogger(&AccessLogOption{Writer: &accessBuf, Format: AccessLogJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapper := New(&Option{
+		Prefix:    "TEST",
+		LogWriter: &serviceBuf,
+		AccessLog: accessLog,
+	})
+	r := gin.New()
+	wrapper.Post(r, "/echo/:id", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		var body map[string]interface{}
+		if err := c.BindJSON(&body); err != nil {
+			return nil, code.New(1, "bad body")
+		}
+		return body, nil
+	})
+
+	for _, body := range []string{`{"name":"anna"}`, `{`} {
+		req, _ := http.NewRequest("POST", "/echo/1?x=1", strings.NewReader(body))
+		req.Header.Set("User-Agent", "test-agent")
+		req.Header.Set("X-Forwarded-For", "1.1.1.1")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(accessBuf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 access log lines,got %s", accessBuf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("bad access log %s", lines[0])
+	}
+	want := map[string]interface{}{
+		"method":     "POST",
+		"path":       "/echo/1",
+		"query":      "x=1",
+		"route":      "/echo/:id",
+		"status":     float64(200),
+		"mcode":      "",
+		"bytes_in":   float64(15),
+		"client_ip":  "1.1.1.1",
+		"user_agent": "test-agent",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("access log %s = %v, want %v", key, record[key], value)
+		}
+	}
+	if record["bytes_out"].(float64) <= 0 {
+		t.Errorf("access log bytes_out = %v", record["bytes_out"])
+	}
+	if !strings.Contains(lines[1], `"mcode":"TEST_1"`) {
+		t.Errorf("failed request access log = %s", lines[1])
+	}
+
+	// 成功的请求不再记录到服务日志
+	if strings.Contains(serviceBuf.String(), "HTTP request done") || !strings.Contains(serviceBuf.String(), "HTTP request failed") {
+		t.Errorf("service log = %s", serviceBuf.String())
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewAccessLogger(&AccessLogOption{Writer: &buf, Fields: []string{AccessFieldStatus, AccessFieldMcode, AccessFieldLatency}})
+	logger.Log(&AccessRecord{
+		Method:    "GET",
+		Proto:     "HTTP/1.1",
+		Path:      "/foo",
+		Query:     "a=1",
+		Status:    404,
+		Mcode:     "NOT_FOUND",
+		ClientIP:  "1.1.1.1",
+		UserAgent: "agent",
+	})
+	line := buf.String()
+	for _, want := range []string{`- - - [`, `"GET /foo?a=1 HTTP/1.1" 404 - "-" "-" mcode=NOT_FOUND latency=0s`} {
+		if !strings.Contains(line, want) {
+			t.Errorf("combined log %q should contain %q", line, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package wrap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// McodeAdmissionDenied 请求被准入控制拒绝时返回的错误码，沿用过载保护的错误码
+const McodeAdmissionDenied = "SNOWSLIDE_DENIED"
+
+// AdmissionKeyFunc 计算请求所属的限流分组，route为注册路径
+type AdmissionKeyFunc func(httpCtx *gin.Context, route string) string
+
+// KeyGlobal 整个进程共享一个限制
+func KeyGlobal(*gin.Context, string) string {
+	return ""
+}
+
+// KeyByRoute 按注册的接口限制，比如`GET /v1/user/:id`
+func KeyByRoute(httpCtx *gin.Context, route string) string {
+	return httpCtx.Request.Method + " " + route
+}
+
+// KeyByClientIP 按连接的远端IP限制，不解析X-Forwarded-For和X-Real-IP，客户端无法通过伪造请求头绕过
+func KeyByClientIP(httpCtx *gin.Context, route string) string {
+	return remoteIP(httpCtx.Request)
+}
+
+// KeyByForwardedIP 按客户端IP限制，只有远端地址是可信代理时才解析X-Forwarded-For和X-Real-IP
+// trustedProxies为可信代理的IP或CIDR，不能为空
+func KeyByForwardedIP(trustedProxies []string) (AdmissionKeyFunc, error) {
+	if len(trustedProxies) == 0 {
+		return nil, fmt.Errorf("trusted proxies are required")
+	}
+	proxies, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return func(httpCtx *gin.Context, route string) string {
+		return clientIP(httpCtx.Request, proxies)
+	}, nil
+}
+
+// KeyByHeader 按请求头的值限制，比如调用方的服务名
+func KeyByHeader(header string) AdmissionKeyFunc {
+	return func(httpCtx *gin.Context, route string) string {
+		return httpCtx.GetHeader(header)
+	}
+}
+
+// AdmissionRule 一条准入规则
+type AdmissionRule struct {
+	Name    string           // 规则名称，用于拒绝时的错误信息
+	Key     AdmissionKeyFunc // 分组方法，默认KeyGlobal
+	Limiter Limiter
+}
+
+// Admission 服务端准入控制，请求需要依次通过所有的规则
+type Admission struct {
+	service string
+	rules   []*AdmissionRule
+}
+
+// NewAdmission 创建准入控制
+func NewAdmission(service string, rules ...*AdmissionRule) *Admission {
+	for _, rule := range rules {
+		if rule.Key == nil {
+			rule.Key = KeyGlobal
+		}
+	}
+
+	return &Admission{
+		service: service,
+		rules:   rules,
+	}
+}
+
+// Acquire 检查请求是否准入，准入时返回的release需要在请求处理完成后调用
+func (admission *Admission) Acquire(httpCtx *gin.Context, route string) (func(time.Duration), code.Error) {
+	if admission == nil || len(admission.rules) == 0 {
+		return noopRelease, nil
+	}
+
+	releases := make([]func(time.Duration), 0, len(admission.rules))
+	release := func(latency time.Duration) {
+		for _, r := range releases {
+			r(latency)
+		}
+	}
+
+	for _, rule := range admission.rules {
+		key := rule.Key(httpCtx, route)
+		r, ok := rule.Limiter.Acquire(key)
+		if !ok {
+			// 已经占用的并发名额需要归还，被拒绝的请求不计入延迟统计
+			for _, r := range releases {
+				r(CanceledLatency)
+			}
+			return nil, code.NewMcodef(McodeAdmissionDenied,
+				"Check admission failed,service = %v,rule = %v,key = %v", admission.service, rule.Name, key)
+		}
+		releases = append(releases, r)
+	}
+
+	return release, nil
+}
+
+// admissionKeyFunc 解析配置中的分组方法
+func admissionKeyFunc(cfg *profile.AdmissionRule) (AdmissionKeyFunc, error) {
+	key := cfg.Key
+	switch {
+	case key == "" || key == "global":
+		return KeyGlobal, nil
+	case key == "route":
+		return KeyByRoute, nil
+	case key == "ip" && len(cfg.TrustedProxies) != 0:
+		return KeyByForwardedIP(cfg.TrustedProxies)
+	case key == "ip":
+		return KeyByClientIP, nil
+	case strings.HasPrefix(key, "header:"):
+		header := strings.TrimSpace(strings.TrimPrefix(key, "header:"))
+		if header == "" {
+			return nil, fmt.Errorf("admission key %q missing header name", key)
+		}
+		return KeyByHeader(header), nil
+	}
+
+	return nil, fmt.Errorf("unsupport admission key %q", key)
+}
+
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// admissionLimiter 根据配置创建限流器
+func admissionLimiter(cfg *profile.AdmissionRule) (Limiter, error) {
+	switch cfg.Limiter {
+	case "token_bucket":
+		if cfg.Rate <= 0 {
+			return nil, fmt.Errorf("token_bucket need a positive rate")
+		}
+		return NewTokenBucketLimiter(cfg.Rate, cfg.Burst), nil
+	case "sliding_window":
+		if cfg.Limit <= 0 {
+			return nil, fmt.Errorf("sliding_window need a positive limit")
+		}
+		window, err := parseDuration(cfg.Window, time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("window %s is not a golang duration", cfg.Window)
+		}
+		return NewSlidingWindowLimiter(cfg.Limit, window), nil
+	case "concurrency":
+		if cfg.Limit <= 0 {
+			return nil, fmt.Errorf("concurrency need a positive limit")
+		}
+		return NewConcurrencyLimiter(cfg.Limit), nil
+	case "adaptive":
+		target, err := parseDuration(cfg.TargetLatency, 0)
+		if err != nil {
+			return nil, fmt.Errorf("target_latency %s is not a golang duration", cfg.TargetLatency)
+		}
+		if cfg.Algorithm != "" && cfg.Algorithm != AdaptiveAIMD && cfg.Algorithm != AdaptiveGradient {
+			return nil, fmt.Errorf("unsupport adaptive algorithm %q", cfg.Algorithm)
+		}
+		return NewAdaptiveLimiter(AdaptiveOption{
+			Algorithm:     cfg.Algorithm,
+			InitialLimit:  cfg.Limit,
+			MinLimit:      cfg.MinLimit,
+			MaxLimit:      cfg.MaxLimit,
+			TargetLatency: target,
+			BackoffRatio:  cfg.BackoffRatio,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unsupport admission limiter %q", cfg.Limiter)
+}
+
+// NewAdmissionWithProfile 使用profile.Service.Admission的配置创建准入控制
+func NewAdmissionWithProfile(service string, cfgs []profile.AdmissionRule) (*Admission, error) {
+	rules := make([]*AdmissionRule, 0, len(cfgs))
+	for index := range cfgs {
+		cfg := &cfgs[index]
+		key, err := admissionKeyFunc(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("admission rule %d:%v", index, err)
+		}
+		limiter, err := admissionLimiter(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("admission rule %d:%v", index, err)
+		}
+		name := cfg.Limiter
+		if cfg.Key != "" {
+			name += "/" + cfg.Key
+		}
+		rules = append(rules, &AdmissionRule{
+			Name:    name,
+			Key:     key,
+			Limiter: limiter,
+		})
+	}
+
+	return NewAdmission(service, rules...), nil
+}
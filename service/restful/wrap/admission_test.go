@@ -0,0 +1,252 @@
+package wrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(1, 3)
+	for index := 0; index < 3; index++ {
+		if _, ok := limiter.Acquire("a"); !ok {
+			t.Fatalf("request %d should be allowed", index)
+		}
+	}
+	if _, ok := limiter.Acquire("a"); ok {
+		t.Errorf("request exceed burst should be denied")
+	}
+	if _, ok := limiter.Acquire("b"); !ok {
+		t.Errorf("other key should not be limited")
+	}
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	limiter := NewSlidingWindowLimiter(5, time.Hour)
+	for index := 0; index < 5; index++ {
+		if _, ok := limiter.Acquire("a"); !ok {
+			t.Fatalf("request %d should be allowed", index)
+		}
+	}
+	if _, ok := limiter.Acquire("a"); ok {
+		t.Errorf("request exceed limit should be denied")
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(2)
+	release1, ok1 := limiter.Acquire("a")
+	_, ok2 := limiter.Acquire("a")
+	if !ok1 || !ok2 {
+		t.Fatalf("requests under limit should be allowed")
+	}
+	if _, ok := limiter.Acquire("a"); ok {
+		t.Errorf("request exceed limit should be denied")
+	}
+	release1(time.Millisecond)
+	if _, ok := limiter.Acquire("a"); !ok {
+		t.Errorf("request should be allowed after release")
+	}
+	if limiter.InFlight("a") != 2 {
+		t.Errorf("InFlight() = %d, want 2", limiter.InFlight("a"))
+	}
+}
+
+func TestAdaptiveLimiterAIMD(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveOption{
+		InitialLimit:  10,
+		MinLimit:      2,
+		TargetLatency: 10 * time.Millisecond,
+	})
+	for index := 0; index < 20; index++ {
+		release, ok := limiter.Acquire("a")
+		if !ok {
+			t.Fatalf("request %d should be allowed", index)
+		}
+		release(time.Second)
+	}
+	if limit := limiter.Limit("a"); limit != 2 {
+		t.Errorf("limit should shrink to min limit,got %d", limit)
+	}
+
+	releases := []func(time.Duration){}
+	for index := 0; index < 2; index++ {
+		release, _ := limiter.Acquire("a")
+		releases = append(releases, release)
+	}
+	if _, ok := limiter.Acquire("a"); ok {
+		t.Errorf("request exceed adaptive limit should be denied")
+	}
+	for _, release := range releases {
+		release(time.Millisecond)
+	}
+}
+
+func TestAdaptiveLimiterGradient(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveOption{
+		Algorithm:    AdaptiveGradient,
+		InitialLimit: 100,
+	})
+	release, _ := limiter.Acquire("a")
+	release(10 * time.Millisecond)
+	for index := 0; index < 10; index++ {
+		release, _ := limiter.Acquire("a")
+		release(100 * time.Millisecond)
+	}
+	if limit := limiter.Limit("a"); limit >= 100 {
+		t.Errorf("limit should shrink when latency grows,got %d", limit)
+	}
+}
+
+func TestAdaptiveLimiterSweep(t *testing.T) {
+	limiter := NewAdaptiveLimiter(AdaptiveOption{})
+	busy, _ := limiter.Acquire("busy")
+	idle, _ := limiter.Acquire("idle")
+	idle(time.Millisecond)
+
+	past := time.Now().Add(-time.Hour)
+	limiter.states.mutex.Lock()
+	for _, state := range limiter.states.states {
+		state.lastUsed = past
+	}
+	limiter.states.sweep(time.Now())
+	_, busyExist := limiter.states.states["busy"]
+	_, idleExist := limiter.states.states["idle"]
+	limiter.states.mutex.Unlock()
+
+	if !busyExist || idleExist {
+		t.Errorf("sweep should keep busy state only,busy = %v,idle = %v", busyExist, idleExist)
+	}
+	busy(time.Millisecond)
+}
+
+func TestAdmissionCanceledRelease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	httpCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	httpCtx.Request, _ = http.NewRequest("GET", "/", nil)
+
+	for _, algorithm := range []string{AdaptiveAIMD, AdaptiveGradient} {
+		adaptive := NewAdaptiveLimiter(AdaptiveOption{Algorithm: algorithm, InitialLimit: 2, MaxLimit: 100})
+		admission := NewAdmission("TEST",
+			&AdmissionRule{Name: "adaptive", Limiter: adaptive},
+			&AdmissionRule{Name: "deny", Limiter: NewSlidingWindowLimiter(0, time.Hour)},
+		)
+		for index := 0; index < 50; index++ {
+			if _, cerr := admission.Acquire(httpCtx, "/"); cerr == nil {
+				t.Fatalf("%s: request should be denied by the second rule", algorithm)
+			}
+		}
+		if limit := adaptive.Limit(""); limit != 2 {
+			t.Errorf("%s: denied requests should not change the limit,got %d", algorithm, limit)
+		}
+
+		// 名额已经归还，延迟统计不受影响
+		release, ok := adaptive.Acquire("")
+		if !ok {
+			t.Fatalf("%s: slot should be returned after denied", algorithm)
+		}
+		release(10 * time.Millisecond)
+		adaptive.states.mutex.Lock()
+		state := adaptive.states.states[""].value.(*adaptiveState)
+		minRTT, inFlight := state.minRTT, state.inFlight
+		adaptive.states.mutex.Unlock()
+		if inFlight != 0 || (algorithm == AdaptiveGradient && minRTT != 10*time.Millisecond) {
+			t.Errorf("%s: inFlight = %d,minRTT = %v", algorithm, inFlight, minRTT)
+		}
+	}
+}
+
+func TestNewAdmissionWithProfile(t *testing.T) {
+	_, err := NewAdmissionWithProfile("test", []profile.AdmissionRule{
+		{Limiter: "token_bucket", Key: "header:X-Service-Name", Rate: 10},
+		{Limiter: "sliding_window", Key: "route", Limit: 10, Window: "1s"},
+		{Limiter: "concurrency", Key: "ip", Limit: 10},
+		{Limiter: "adaptive", Algorithm: "gradient"},
+	})
+	if err != nil {
+		t.Errorf("NewAdmissionWithProfile() error = %v", err)
+	}
+
+	badRules := [][]profile.AdmissionRule{
+		{{Limiter: "unknown"}},
+		{{Limiter: "token_bucket"}},
+		{{Limiter: "concurrency", Limit: 1, Key: "cookie"}},
+		{{Limiter: "sliding_window", Limit: 1, Window: "1x"}},
+		{{Limiter: "concurrency", Limit: 1, Key: "ip", TrustedProxies: []string{"10.0.0.0/99"}}},
+	}
+	for _, rules := range badRules {
+		if _, err := NewAdmissionWithProfile("test", rules); err == nil {
+			t.Errorf("NewAdmissionWithProfile(%+v) should failed", rules)
+		}
+	}
+}
+
+func TestWrapAdmissionPerHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	admission, _ := NewAdmissionWithProfile("test", []profile.AdmissionRule{
+		{Limiter: "sliding_window", Key: "header:X-Service-Name", Limit: 1, Window: "1h"},
+	})
+	wrapper := New(&Option{
+		Prefix:    "TEST",
+		Admission: admission,
+	})
+	r := gin.New()
+	wrapper.Get(r, "/foo", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return "ok", nil
+	})
+
+	do := func(caller string) bool {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/foo", nil)
+		req.Header.Set("X-Service-Name", caller)
+		r.ServeHTTP(w, req)
+		return !strings.Contains(w.Body.String(), McodeAdmissionDenied)
+	}
+	if !do("a") {
+		t.Errorf("first request of caller a should be allowed")
+	}
+	if do("a") {
+		t.Errorf("second request of caller a should be denied")
+	}
+	if !do("b") {
+		t.Errorf("first request of caller b should be allowed")
+	}
+}
+
+func TestAdmissionKeyByIP(t *testing.T) {
+	forwarded, err := KeyByForwardedIP([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("KeyByForwardedIP() error = %v", err)
+	}
+	if _, err := KeyByForwardedIP(nil); err == nil {
+		t.Errorf("KeyByForwardedIP() without proxies should fail")
+	}
+
+	tests := []struct {
+		name   string
+		key    AdmissionKeyFunc
+		remote string
+		want   string
+	}{
+		{name: "remote ignores header", key: KeyByClientIP, remote: "1.1.1.1:1234", want: "1.1.1.1"},
+		{name: "untrusted proxy", key: forwarded, remote: "1.1.1.1:1234", want: "1.1.1.1"},
+		{name: "trusted proxy", key: forwarded, remote: "10.0.0.1:1234", want: "2.2.2.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/foo", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-For", "2.2.2.2")
+			if got := tt.key(&gin.Context{Request: req}, "/foo"); got != tt.want {
+				t.Errorf("key = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
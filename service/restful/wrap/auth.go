@@ -0,0 +1,113 @@
+package wrap
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/auth"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+const (
+	// McodeUnauthenticated 没有携带凭证或者凭证不合法
+	McodeUnauthenticated = "UNAUTHENTICATED"
+	// McodeForbidden 调用方没有接口要求的权限或角色
+	McodeForbidden = "FORBIDDEN"
+)
+
+// Authenticate 接口使用指定的认证方式，优先于Option.Authenticator
+//
+//	wrapper.Post(r, "/internal/sync", sync, wrap.Authenticate(hmacAuthenticator))
+func Authenticate(authenticator auth.Authenticator) RouteOption {
+	return func(r *route) {
+		r.authenticator = authenticator
+	}
+}
+
+// Anonymous 接口允许匿名访问，携带了凭证时仍然会认证，凭证不合法时返回UNAUTHENTICATED
+func Anonymous() RouteOption {
+	return func(r *route) {
+		r.anonymous = true
+	}
+}
+
+// RequireScopes 调用方需要拥有所有的scope
+func RequireScopes(scopes ...string) RouteOption {
+	return func(r *route) {
+		r.scopes = append(r.scopes, scopes...)
+	}
+}
+
+// RequireRoles 调用方需要拥有其中一个role
+func RequireRoles(roles ...string) RouteOption {
+	return func(r *route) {
+		r.roles = append(r.roles, roles...)
+	}
+}
+
+// authenticatorOf 接口使用的认证方式，nil表示不需要认证
+func (wrapper *Wrapper) authenticatorOf(r *route) auth.Authenticator {
+	if r.authenticator != nil {
+		return r.authenticator
+	}
+	return wrapper.authenticator
+}
+
+// checkAuth 注册接口时检查认证的配置，并声明认证相关的错误码
+func (wrapper *Wrapper) checkAuth(r *route) {
+	if wrapper.authenticatorOf(r) == nil {
+		if len(r.scopes) != 0 || len(r.roles) != 0 {
+			panic(fmt.Errorf("route %s %s requires scopes or roles but no authenticator", r.method, r.path))
+		}
+		return
+	}
+
+	r.mcodes = append(r.mcodes, McodeUnauthenticated)
+	if len(r.scopes) != 0 || len(r.roles) != 0 {
+		r.mcodes = append(r.mcodes, McodeForbidden)
+	}
+}
+
+// authenticate 认证调用方并检查权限，不需要认证或者匿名访问时返回nil
+func (wrapper *Wrapper) authenticate(httpCtx *gin.Context, r *route) (*context.Principal, code.Error) {
+	authenticator := wrapper.authenticatorOf(r)
+	if authenticator == nil {
+		return nil, nil
+	}
+
+	principal, err := authenticator.Authenticate(httpCtx.Request)
+	if err == auth.ErrNoCredentials {
+		principal, err = nil, nil
+	}
+	if err != nil {
+		return nil, code.NewMcodef(McodeUnauthenticated, "authentication failed,%v", err)
+	}
+	if principal == nil {
+		if r.anonymous {
+			return nil, nil
+		}
+		return nil, code.NewMcode(McodeUnauthenticated, "authentication required")
+	}
+
+	for _, scope := range r.scopes {
+		if !principal.HasScope(scope) {
+			return principal, code.NewMcodef(McodeForbidden, "scope %s required", scope)
+		}
+	}
+	if len(r.roles) != 0 {
+		allowed := false
+		for _, role := range r.roles {
+			if principal.HasRole(role) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return principal, code.NewMcodef(McodeForbidden, "one of roles %s required", strings.Join(r.roles, ","))
+		}
+	}
+
+	return principal, nil
+}
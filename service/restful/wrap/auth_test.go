@@ -0,0 +1,89 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/auth"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestWrapAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{
+		Prefix:        "TEST",
+		StatusMapping: NewStatusMapping(),
+		Authenticator: auth.NewAPIKeyAuthenticator(&auth.APIKeyOption{
+			Keys: map[string]*context.Principal{
+				"reader": {Subject: "reader", Scopes: []string{"order:read"}},
+				"admin":  {Subject: "admin", Scopes: []string{"order:read", "order:write"}, Roles: []string{"admin"}},
+			},
+		}),
+	})
+	r := gin.New()
+
+	whoami := func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		principal := context.PrincipalFromContext(srvContext)
+		if principal == nil {
+			return "anonymous", nil
+		}
+		return principal.Subject, nil
+	}
+	wrapper.Get(r, "/me", whoami)
+	wrapper.Get(r, "/public", whoami, Anonymous())
+	wrapper.Post(r, "/orders", whoami, RequireScopes("order:read", "order:write"))
+	wrapper.Delete(r, "/orders", whoami, RequireRoles("admin", "ops"))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+		mcode  string
+		data   string
+	}{
+		{name: "authenticated", method: "GET", path: "/me", key: "reader", status: http.StatusOK, data: "reader"},
+		{name: "missing credentials", method: "GET", path: "/me", status: http.StatusUnauthorized, mcode: McodeUnauthenticated},
+		{name: "invalid credentials", method: "GET", path: "/me", key: "other", status: http.StatusUnauthorized, mcode: McodeUnauthenticated},
+		{name: "anonymous", method: "GET", path: "/public", status: http.StatusOK, data: "anonymous"},
+		{name: "anonymous with credentials", method: "GET", path: "/public", key: "admin", status: http.StatusOK, data: "admin"},
+		{name: "anonymous with invalid credentials", method: "GET", path: "/public", key: "other", status: http.StatusUnauthorized, mcode: McodeUnauthenticated},
+		{name: "missing scope", method: "POST", path: "/orders", key: "reader", status: http.StatusForbidden, mcode: McodeForbidden},
+		{name: "all scopes", method: "POST", path: "/orders", key: "admin", status: http.StatusOK, data: "admin"},
+		{name: "missing role", method: "DELETE", path: "/orders", key: "reader", status: http.StatusForbidden, mcode: McodeForbidden},
+		{name: "any role", method: "DELETE", path: "/orders", key: "admin", status: http.StatusOK, data: "admin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			r.ServeHTTP(w, req)
+
+			var rsp Response
+			json.Unmarshal(w.Body.Bytes(), &rsp)
+			if w.Code != tt.status || rsp.Mcode != tt.mcode || tt.data != "" && rsp.Data != tt.data {
+				t.Errorf("%s %s = %d %s", tt.method, tt.path, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWrapAuthWithoutAuthenticator(t *testing.T) {
+	wrapper := New(&Option{Prefix: "TEST"})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("route requiring roles without authenticator should panic")
+		}
+	}()
+	wrapper.Get(gin.New(), "/admin", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	}, RequireRoles("admin"))
+}
@@ -0,0 +1,383 @@
+package wrap
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// CacheStatusHeader 返回头，HIT表示来自缓存，MISS表示由业务函数计算
+const CacheStatusHeader = "X-Cache"
+
+// McodeRequestCanceled 等待相同请求的结果时，请求被取消
+const McodeRequestCanceled = "REQUEST_CANCELED"
+
+// 缓存的默认配置
+const (
+	DefaultCacheTTL        = time.Minute
+	DefaultCacheMaxEntries = 10000
+	DefaultCacheMaxBytes   = 64 << 20
+)
+
+// CachedResponse 缓存的返回，Data为业务函数返回的data序列化之后的JSON
+type CachedResponse struct {
+	Data         []byte
+	ETag         string
+	LastModified time.Time
+	ExpireAt     time.Time
+}
+
+// ResponseCacheStore 缓存的存储
+type ResponseCacheStore interface {
+	// Get 读取未过期的缓存
+	Get(key string) (*CachedResponse, bool)
+	// Set 写入缓存
+	Set(key string, response *CachedResponse)
+}
+
+// CacheOption 缓存的配置
+type CacheOption struct {
+	// Store 缓存的存储，默认为最多10000条，64MB的内存LRU
+	Store ResponseCacheStore
+	// TTL 缓存的时长，默认1m
+	TTL time.Duration
+	// Query 参与缓存键的查询参数，为空时使用全部的查询参数
+	Query []string
+	// Headers 参与缓存键的请求头，比如Accept-Language
+	Headers []string
+	// Shared 为true时不同调用方共用缓存，只用于返回内容与调用方无关的接口
+	// 默认缓存键包含认证的调用方(Principal.Subject)
+	Shared bool
+}
+
+// responseCache 接口的缓存配置
+type responseCache struct {
+	store   ResponseCacheStore
+	ttl     time.Duration
+	query   []string
+	headers []string
+	shared  bool
+	flights flightGroup
+}
+
+// Cached 为GET接口开启缓存，缓存键由调用方，请求路径，查询参数和Headers中的请求头组成
+// 只有成功的返回会被缓存，同一个键同时只有一个请求执行业务函数，其他请求等待并共用它的结果
+// 返回头中带有ETag和Last-Modified，客户端携带匹配的If-None-Match或If-Modified-Since时返回304
+//
+//	wrapper.Get(r, "/products", listProducts, wrap.Cached(&wrap.CacheOption{
+//		TTL:   30 * time.Second,
+//		Query: []string{"category", "page"},
+//	}))
+func Cached(option *CacheOption) RouteOption {
+	cache := &responseCache{
+		ttl:     DefaultCacheTTL,
+		flights: flightGroup{flights: map[string]*flight{}},
+	}
+	if option != nil {
+		cache.store = option.Store
+		cache.shared = option.Shared
+		cache.query = append([]string(nil), option.Query...)
+		sort.Strings(cache.query)
+		for _, header := range option.Headers {
+			cache.headers = append(cache.headers, http.CanonicalHeaderKey(header))
+		}
+		sort.Strings(cache.headers)
+		if option.TTL > 0 {
+			cache.ttl = option.TTL
+		}
+	}
+	if cache.store == nil {
+		cache.store = NewMemoryResponseCache(DefaultCacheMaxEntries, DefaultCacheMaxBytes)
+	}
+
+	return func(r *route) {
+		r.cache = cache
+	}
+}
+
+// do 返回缓存的结果，未命中时执行f并缓存成功的结果
+func (cache *responseCache) do(serviceCtx context.Context, httpCtx *gin.Context, f WrappedFunc) (interface{}, code.Error) {
+	method := httpCtx.Request.Method
+	if method != http.MethodGet && method != http.MethodHead {
+		return f(serviceCtx, httpCtx)
+	}
+
+	key := cache.key(serviceCtx, httpCtx.Request)
+	if cached, ok := cache.store.Get(key); ok {
+		httpCtx.Header(CacheStatusHeader, "HIT")
+		return cache.respond(httpCtx, cached)
+	}
+
+	var data interface{}
+	cached, cerr, leader := cache.flights.do(httpCtx.Request.Context().Done(), key, func() (*CachedResponse, code.Error) {
+		var cerr code.Error
+		data, cerr = f(serviceCtx, httpCtx)
+		return cache.save(key, data, cerr), cerr
+	})
+	if leader {
+		httpCtx.Header(CacheStatusHeader, "MISS")
+		if cached == nil {
+			return data, cerr
+		}
+		return cache.respond(httpCtx, cached)
+	}
+
+	// 第一个请求的错误直接共用，避免后端故障时每个等待的请求都再执行一次
+	if cerr != nil {
+		return nil, cerr
+	}
+	// 第一个请求成功但结果不能缓存，比如流式返回，自己执行一次
+	if cached == nil {
+		return f(serviceCtx, httpCtx)
+	}
+	httpCtx.Header(CacheStatusHeader, "HIT")
+	return cache.respond(httpCtx, cached)
+}
+
+// save 缓存成功的结果，失败，劫持，流式或者没有数据的返回不缓存
+func (cache *responseCache) save(key string, data interface{}, cerr code.Error) *CachedResponse {
+	if cerr != nil || data == nil {
+		return nil
+	}
+	switch data.(type) {
+	case *HijackedResponse, *StreamResponse:
+		return nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(b)
+	now := time.Now()
+	cached := &CachedResponse{
+		Data:         b,
+		ETag:         `"` + hex.EncodeToString(sum[:16]) + `"`,
+		LastModified: now.Truncate(time.Second),
+		ExpireAt:     now.Add(cache.ttl),
+	}
+	cache.store.Set(key, cached)
+
+	return cached
+}
+
+// respond 写入缓存相关的返回头，条件请求匹配时返回304
+func (cache *responseCache) respond(httpCtx *gin.Context, cached *CachedResponse) (interface{}, code.Error) {
+	httpCtx.Header("ETag", cached.ETag)
+	httpCtx.Header("Last-Modified", cached.LastModified.UTC().Format(http.TimeFormat))
+
+	if notModified(httpCtx.Request, cached) {
+		httpCtx.Status(http.StatusNotModified)
+		httpCtx.Writer.WriteHeaderNow()
+		return Hijacked, nil
+	}
+
+	return json.RawMessage(cached.Data), nil
+}
+
+// notModified 优先使用If-None-Match，没有时使用If-Modified-Since
+func notModified(request *http.Request, cached *CachedResponse) bool {
+	if inm := request.Header.Get("If-None-Match"); inm != "" {
+		for _, etag := range strings.Split(inm, ",") {
+			etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+			if etag == "*" || etag == cached.ETag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := request.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !cached.LastModified.After(t)
+	}
+
+	return false
+}
+
+// key 缓存键：方法，路径，排序后的查询参数和请求头，不共用时加上调用方
+func (cache *responseCache) key(serviceCtx context.Context, request *http.Request) string {
+	var b strings.Builder
+	b.WriteString(request.Method)
+	b.WriteByte(' ')
+	b.WriteString(request.URL.Path)
+	if !cache.shared {
+		b.WriteByte(' ')
+		if principal := context.PrincipalFromContext(serviceCtx); principal != nil {
+			b.WriteString(url.QueryEscape(principal.Subject))
+		}
+	}
+
+	query := request.URL.Query()
+	if len(cache.query) > 0 {
+		selected := url.Values{}
+		for _, name := range cache.query {
+			if values, exist := query[name]; exist {
+				selected[name] = values
+			}
+		}
+		query = selected
+	}
+	b.WriteByte('?')
+	b.WriteString(query.Encode())
+
+	for _, header := range cache.headers {
+		b.WriteByte('\n')
+		b.WriteString(header)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(request.Header.Values(header), ","))
+	}
+
+	return b.String()
+}
+
+// flight 正在执行的计算
+type flight struct {
+	done   chan struct{}
+	result *CachedResponse
+	err    code.Error
+}
+
+// flightGroup 相同键的并发计算只执行一次
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[string]*flight
+}
+
+// do 执行fn，相同键的计算正在执行时等待它的结果和错误，leader表示fn由本次调用执行
+// 等待的请求被取消时返回REQUEST_CANCELED，fn panic时等待的请求返回内部错误
+func (group *flightGroup) do(cancel <-chan struct{}, key string, fn func() (*CachedResponse, code.Error)) (result *CachedResponse, cerr code.Error, leader bool) {
+	group.mutex.Lock()
+	if f, exist := group.flights[key]; exist {
+		group.mutex.Unlock()
+		select {
+		case <-f.done:
+			return f.result, f.err, false
+		case <-cancel:
+			return nil, code.NewMcode(McodeRequestCanceled, "request canceled while waiting for the same request"), false
+		}
+	}
+	f := &flight{done: make(chan struct{})}
+	group.flights[key] = f
+	group.mutex.Unlock()
+
+	// fn panic时也要唤醒等待的请求
+	finished := false
+	defer func() {
+		if !finished {
+			f.err = code.New(100000000, "Service internal error")
+		}
+		group.mutex.Lock()
+		delete(group.flights, key)
+		group.mutex.Unlock()
+		close(f.done)
+	}()
+	f.result, f.err = fn()
+	finished = true
+
+	return f.result, f.err, true
+}
+
+// MemoryResponseCache 按条数和字节数限制大小的内存缓存，超过时淘汰最久未使用的缓存
+type MemoryResponseCache struct {
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	mutex      sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List
+}
+
+type memoryCacheItem struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewMemoryResponseCache 创建内存缓存，maxEntries和maxBytes小于等于0时使用默认值
+func NewMemoryResponseCache(maxEntries int, maxBytes int64) *MemoryResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultCacheMaxBytes
+	}
+	return &MemoryResponseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		items:      map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (cache *MemoryResponseCache) Get(key string) (*CachedResponse, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, exist := cache.items[key]
+	if !exist {
+		return nil, false
+	}
+	item := element.Value.(*memoryCacheItem)
+	if !time.Now().Before(item.response.ExpireAt) {
+		cache.remove(element)
+		return nil, false
+	}
+	cache.lru.MoveToFront(element)
+
+	return item.response, true
+}
+
+func (cache *MemoryResponseCache) Set(key string, response *CachedResponse) {
+	size := cacheItemSize(key, response)
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, exist := cache.items[key]; exist {
+		cache.remove(element)
+	}
+	// 单条超过上限的不缓存
+	if size > cache.maxBytes {
+		return
+	}
+	for cache.lru.Len() >= cache.maxEntries || cache.bytes+size > cache.maxBytes {
+		cache.remove(cache.lru.Back())
+	}
+	cache.items[key] = cache.lru.PushFront(&memoryCacheItem{key: key, response: response})
+	cache.bytes += size
+}
+
+// Len 当前缓存的条数
+func (cache *MemoryResponseCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.lru.Len()
+}
+
+// Bytes 当前缓存占用的字节数
+func (cache *MemoryResponseCache) Bytes() int64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.bytes
+}
+
+func (cache *MemoryResponseCache) remove(element *list.Element) {
+	item := element.Value.(*memoryCacheItem)
+	cache.lru.Remove(element)
+	delete(cache.items, item.key)
+	cache.bytes -= cacheItemSize(item.key, item.response)
+}
+
+func cacheItemSize(key string, response *CachedResponse) int64 {
+	return int64(len(key) + len(response.Data) + len(response.ETag))
+}
@@ -0,0 +1,230 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/auth"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST"})
+	r := gin.New()
+
+	var calls int64
+	wrapper.Get(r, "/products", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		atomic.AddInt64(&calls, 1)
+		if c.Query("fail") != "" {
+			return nil, code.New(1, "failed")
+		}
+		return map[string]string{"category": c.Query("category"), "lang": c.GetHeader("Accept-Language")}, nil
+	}, Cached(&CacheOption{Query: []string{"category", "fail"}, Headers: []string{"accept-language"}}))
+
+	get := func(query string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/products"+query, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("?category=a&ts=1", nil)
+	second := get("?ts=2&category=a", nil)
+	if first.Header().Get(CacheStatusHeader) != "MISS" || second.Header().Get(CacheStatusHeader) != "HIT" {
+		t.Errorf("X-Cache = %s,%s, want MISS,HIT", first.Header().Get(CacheStatusHeader), second.Header().Get(CacheStatusHeader))
+	}
+	var rsp Response
+	json.Unmarshal(second.Body.Bytes(), &rsp)
+	if data, _ := rsp.Data.(map[string]interface{}); !rsp.Result || data["category"] != "a" {
+		t.Errorf("cached response = %s", second.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	etag := first.Header().Get("ETag")
+	if etag == "" || second.Header().Get("ETag") != etag || first.Header().Get("Last-Modified") == "" {
+		t.Errorf("ETag = %q,%q", etag, second.Header().Get("ETag"))
+	}
+	if w := get("?category=a", map[string]string{"If-None-Match": `"other", ` + etag}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("If-None-Match = %d %s, want 304", w.Code, w.Body.String())
+	}
+	if w := get("?category=a", map[string]string{"If-Modified-Since": first.Header().Get("Last-Modified")}); w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since = %d, want 304", w.Code)
+	}
+
+	get("?category=b", nil)
+	get("?category=a", map[string]string{"Accept-Language": "zh-CN"})
+	if calls != 3 {
+		t.Errorf("different query or header should miss, calls %d", calls)
+	}
+
+	get("?fail=1", nil)
+	if w := get("?fail=1", nil); w.Header().Get(CacheStatusHeader) != "MISS" || calls != 5 {
+		t.Errorf("failed response should not be cached, calls %d", calls)
+	}
+}
+
+func TestCachedPrincipal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST"})
+	r := gin.New()
+	authenticator := auth.AuthenticatorFunc(func(request *http.Request) (*context.Principal, error) {
+		return &context.Principal{Subject: request.Header.Get("X-User")}, nil
+	})
+
+	var calls int64
+	handler := func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		atomic.AddInt64(&calls, 1)
+		return context.PrincipalFromContext(srvContext).Subject, nil
+	}
+	wrapper.Get(r, "/me", handler, Authenticate(authenticator), Cached(nil))
+	wrapper.Get(r, "/products", handler, Authenticate(authenticator), Cached(&CacheOption{Shared: true}))
+
+	get := func(path, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("X-User", user)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	get("/me", "alice")
+	if w := get("/me", "bob"); w.Header().Get(CacheStatusHeader) != "MISS" || !strings.Contains(w.Body.String(), "bob") {
+		t.Errorf("cache should not be shared between callers = %s", w.Body.String())
+	}
+	if w := get("/me", "alice"); w.Header().Get(CacheStatusHeader) != "HIT" || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("same caller should hit = %s", w.Body.String())
+	}
+
+	get("/products", "alice")
+	if w := get("/products", "bob"); w.Header().Get(CacheStatusHeader) != "HIT" {
+		t.Errorf("shared cache should hit for another caller")
+	}
+	if calls != 3 {
+		t.Errorf("handler called %d times, want 3", calls)
+	}
+}
+
+func TestCachedSingleflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST"})
+	r := gin.New()
+
+	var calls int64
+	release := make(chan struct{})
+	wrapper.Get(r, "/slow", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return "done", nil
+	}, Cached(nil))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/slow", nil)
+			r.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	for i, c := range codes {
+		if c != http.StatusOK {
+			t.Errorf("request %d status = %d", i, c)
+		}
+	}
+}
+
+func TestFlightGroupShareError(t *testing.T) {
+	group := &flightGroup{flights: map[string]*flight{}}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var calls int64
+	fn := func() (*CachedResponse, code.Error) {
+		atomic.AddInt64(&calls, 1)
+		close(entered)
+		<-release
+		return nil, code.New(1, "backend failed")
+	}
+
+	leaderErr := make(chan code.Error, 1)
+	go func() {
+		_, cerr, _ := group.do(nil, "k", fn)
+		leaderErr <- cerr
+	}()
+	<-entered
+
+	canceled := make(chan struct{})
+	close(canceled)
+	if _, cerr, leader := group.do(canceled, "k", fn); leader || cerr == nil || cerr.Mcode() != McodeRequestCanceled {
+		t.Errorf("canceled waiter = %v %v, want %s", cerr, leader, McodeRequestCanceled)
+	}
+
+	waiterErr := make(chan code.Error, 1)
+	go func() {
+		_, cerr, _ := group.do(nil, "k", fn)
+		waiterErr <- cerr
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if cerr := <-waiterErr; cerr == nil || cerr.Message() != "backend failed" {
+		t.Errorf("waiter error = %v, want the leader's error", cerr)
+	}
+	if cerr := <-leaderErr; cerr == nil || calls != 1 {
+		t.Errorf("leader error = %v, calls = %d, want 1", cerr, calls)
+	}
+}
+
+func TestMemoryResponseCache(t *testing.T) {
+	cache := NewMemoryResponseCache(3, 15)
+	expireAt := time.Now().Add(time.Minute)
+
+	cache.Set("a", &CachedResponse{Data: []byte("123456789"), ExpireAt: expireAt})
+	cache.Set("b", &CachedResponse{Data: []byte("123456789"), ExpireAt: expireAt})
+	if _, ok := cache.Get("a"); ok || cache.Len() != 1 || cache.Bytes() != 10 {
+		t.Errorf("a should be evicted by size, len %d bytes %d", cache.Len(), cache.Bytes())
+	}
+
+	cache.Set("c", &CachedResponse{Data: []byte("1"), ExpireAt: expireAt})
+	cache.Set("d", &CachedResponse{Data: []byte("1"), ExpireAt: expireAt})
+	cache.Get("b")
+	cache.Set("e", &CachedResponse{Data: []byte("1"), ExpireAt: expireAt})
+	if _, ok := cache.Get("c"); ok {
+		t.Errorf("least recently used c should be evicted by count")
+	}
+	if _, ok := cache.Get("b"); !ok {
+		t.Errorf("recently used b should be kept")
+	}
+
+	cache.Set("big", &CachedResponse{Data: make([]byte, 100), ExpireAt: expireAt})
+	if _, ok := cache.Get("big"); ok {
+		t.Errorf("response larger than max bytes should not be cached")
+	}
+
+	cache.Set("expired", &CachedResponse{Data: []byte("1"), ExpireAt: time.Now()})
+	if _, ok := cache.Get("expired"); ok {
+		t.Errorf("expired response should not be returned")
+	}
+}
@@ -0,0 +1,234 @@
+package wrap
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCompressionMinSize 默认超过该字节数的返回才压缩
+const DefaultCompressionMinSize = 1024
+
+// Encoder 创建压缩的Writer，level为CompressionOption.Level，0表示使用默认的压缩等级
+type Encoder func(w io.Writer, level int) (io.WriteCloser, error)
+
+var (
+	encoders = map[string]Encoder{
+		"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = gzip.DefaultCompression
+			}
+			return gzip.NewWriterLevel(w, level)
+		},
+		// br的压缩等级为0-11，0时使用默认的6
+		"br": func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level == 0 {
+				level = brotli.DefaultCompression
+			}
+			return brotli.NewWriterLevel(w, level), nil
+		},
+	}
+	encodersMutex sync.RWMutex
+)
+
+// RegisterEncoder 注册Content-Encoding对应的压缩方式，内置了gzip和br，客户端同时接受时优先使用br
+//
+//	wrap.RegisterEncoder("zstd", func(w io.Writer, level int) (io.WriteCloser, error) {
+//	    return zstd.NewWriter(w)
+//	})
+func RegisterEncoder(name string, encoder Encoder) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+	encoders[strings.ToLower(name)] = encoder
+}
+
+func encoderOf(name string) Encoder {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	return encoders[name]
+}
+
+// CompressionOption 返回压缩的配置
+type CompressionOption struct {
+	// Level 压缩等级，0表示使用默认的压缩等级
+	Level int
+	// MinSize 超过该字节数的返回才压缩，默认1024
+	MinSize int
+}
+
+// encodingPreference 客户端接受程度相同时的优先顺序
+var encodingPreference = map[string]int{"br": 2, "gzip": 1}
+
+// negotiateEncoding 根据Accept-Encoding选择已注册的压缩方式，不压缩时返回空
+func negotiateEncoding(acceptEncoding string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" || encoderOf(name) == nil {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || q == bestQ && encodingPreference[name] > encodingPreference[best] {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter 在返回超过MinSize之后才决定压缩，小的返回和在此之前Flush的流式返回保持原样
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser // 不压缩时为nil
+}
+
+// newWriter 客户端不接受任何已注册的压缩方式时返回nil
+func (option *CompressionOption) newWriter(httpCtx *gin.Context) *compressWriter {
+	encoding := negotiateEncoding(httpCtx.GetHeader("Accept-Encoding"))
+	if encoding == "" || httpCtx.Request.Method == http.MethodHead {
+		return nil
+	}
+	minSize := option.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	return &compressWriter{
+		ResponseWriter: httpCtx.Writer,
+		encoding:       encoding,
+		level:          option.Level,
+		minSize:        minSize,
+	}
+}
+
+// compressible 返回的状态码和类型是否适合压缩
+func (w *compressWriter) compressible() bool {
+	status := w.ResponseWriter.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	header := w.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-gzip"} {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide 决定是否压缩并写入已缓存的数据
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if compress && w.compressible() {
+		encoder, err := encoderOf(w.encoding)(w.ResponseWriter, w.level)
+		if err == nil {
+			header := w.ResponseWriter.Header()
+			header.Set("Content-Encoding", w.encoding)
+			header.Add("Vary", "Accept-Encoding")
+			header.Del("Content-Length")
+			w.encoder = encoder
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize {
+			return len(p), nil
+		}
+		return len(p), w.decide(true)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 在写入数据之前发送头部时不再压缩
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(false)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Written 缓存中的数据也视为已写入
+func (w *compressWriter) Written() bool {
+	return len(w.buf) != 0 || w.ResponseWriter.Written()
+}
+
+// Flush 在决定压缩之前Flush时不再压缩，保证流式返回可以立即送达
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if !w.decided {
+		w.decide(false)
+	}
+	return w.ResponseWriter.Hijack()
+}
+
+// close 写入剩余的数据，在业务函数返回并写入返回之后调用
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
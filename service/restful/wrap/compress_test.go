@@ -0,0 +1,94 @@
+package wrap
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "gzip, deflate, br", want: "br"},
+		{accept: "br;q=0.5, gzip", want: "gzip"},
+		{accept: "gzip;q=0, deflate", want: ""},
+		{accept: "compress, identity", want: ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", Compression: &CompressionOption{MinSize: 100}})
+	r := gin.New()
+	wrapper.Get(r, "/text", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return strings.Repeat(c.Query("s"), 100), nil
+	})
+	wrapper.Get(r, "/image", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		c.Data(http.StatusOK, "image/png", make([]byte, 1000))
+		return Hijacked, nil
+	})
+	wrapper.Get(r, "/events", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return SSE(func(w *StreamWriter) error {
+			return w.Event("tick", strings.Repeat("a", 1000))
+		}), nil
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		encoding string
+	}{
+		{name: "large", path: "/text?s=abc", accept: "gzip", encoding: "gzip"},
+		{name: "brotli", path: "/text?s=abc", accept: "gzip, br", encoding: "br"},
+		{name: "small", path: "/text?s=", accept: "gzip"},
+		{name: "not accepted", path: "/text?s=abc"},
+		{name: "image", path: "/image", accept: "gzip"},
+		{name: "stream", path: "/events", accept: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			r.ServeHTTP(w, req)
+
+			if encoding := w.Header().Get("Content-Encoding"); encoding != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", encoding, tt.encoding)
+			}
+			var body io.Reader = w.Body
+			switch tt.encoding {
+			case "gzip":
+				reader, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				body = reader
+			case "br":
+				body = brotli.NewReader(w.Body)
+			}
+			b, _ := ioutil.ReadAll(body)
+			if tt.path == "/text?s=abc" && !strings.Contains(string(b), strings.Repeat("abc", 100)) {
+				t.Errorf("body = %s", b)
+			}
+		})
+	}
+}
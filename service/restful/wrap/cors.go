@@ -0,0 +1,197 @@
+package wrap
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+)
+
+// DefaultCORSMethods 默认允许跨域的方法
+var DefaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"}
+
+// DefaultCORSMaxAge 默认的预检结果缓存时长
+const DefaultCORSMaxAge = 10 * time.Minute
+
+// CORSPolicy 跨域策略
+//
+// 设置后注册接口时会为每个路径注册一个OPTIONS接口处理预检请求，
+// 需要自定义OPTIONS接口时应当在同一路径的其他接口之前注册
+type CORSPolicy struct {
+	// AllowOrigins 允许的来源，"*"表示全部，支持"https://*.example.com"形式的通配
+	AllowOrigins []string
+	// AllowMethods 允许的方法，默认DefaultCORSMethods
+	AllowMethods []string
+	// AllowHeaders 允许的请求头，为空时允许预检请求中的全部请求头
+	AllowHeaders []string
+	// ExposeHeaders 浏览器可以读取的返回头，默认X-Request-Id
+	ExposeHeaders []string
+	// AllowCredentials 允许携带Cookie，此时Allow-Origin返回请求的来源，不能与"*"同时使用
+	AllowCredentials bool
+	// MaxAge 预检结果的缓存时长，默认10m
+	MaxAge time.Duration
+}
+
+// cors 预先计算好头部的跨域策略
+type cors struct {
+	anyOrigin        bool
+	origins          map[string]bool
+	wildcards        [][2]string // 通配的前缀和后缀
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// validate 允许全部来源时携带Cookie会使任意网站都可以读取用户的数据
+func (policy *CORSPolicy) validate() error {
+	if !policy.AllowCredentials {
+		return nil
+	}
+	for _, origin := range policy.AllowOrigins {
+		if origin == "*" {
+			return errors.New("cors allow origin * cannot be used with allow credentials")
+		}
+	}
+	return nil
+}
+
+func newCORS(policy *CORSPolicy) (*cors, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	c := &cors{
+		origins:          make(map[string]bool, len(policy.AllowOrigins)),
+		allowCredentials: policy.AllowCredentials,
+	}
+	for _, origin := range policy.AllowOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+			continue
+		}
+		if index := strings.Index(origin, "*"); index >= 0 {
+			c.wildcards = append(c.wildcards, [2]string{origin[:index], origin[index+1:]})
+			continue
+		}
+		c.origins[origin] = true
+	}
+
+	methods := policy.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSMethods
+	}
+	c.allowMethods = strings.Join(methods, ", ")
+	c.allowHeaders = strings.Join(policy.AllowHeaders, ", ")
+
+	exposeHeaders := policy.ExposeHeaders
+	if len(exposeHeaders) == 0 {
+		exposeHeaders = []string{context.RequestIdHeader}
+	}
+	c.exposeHeaders = strings.Join(exposeHeaders, ", ")
+
+	maxAge := policy.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultCORSMaxAge
+	}
+	c.maxAge = strconv.Itoa(int(maxAge / time.Second))
+
+	return c, nil
+}
+
+// allowed 来源是否允许跨域
+func (c *cors) allowed(origin string) bool {
+	if c.anyOrigin || c.origins[origin] {
+		return true
+	}
+	for _, wildcard := range c.wildcards {
+		if len(origin) > len(wildcard[0])+len(wildcard[1]) &&
+			strings.HasPrefix(origin, wildcard[0]) && strings.HasSuffix(origin, wildcard[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrigin 写入Allow-Origin相关的头部，来源不允许时返回false
+func (c *cors) setOrigin(httpCtx *gin.Context, origin string) bool {
+	header := httpCtx.Writer.Header()
+	header.Add("Vary", "Origin")
+	if !c.allowed(origin) {
+		return false
+	}
+
+	if c.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// apply 为跨域的实际请求写入头部，不允许的来源不附带任何头部，由浏览器拒绝
+func (c *cors) apply(httpCtx *gin.Context) {
+	origin := httpCtx.GetHeader("Origin")
+	if origin == "" {
+		return
+	}
+	if c.setOrigin(httpCtx, origin) && c.exposeHeaders != "" {
+		httpCtx.Header("Access-Control-Expose-Headers", c.exposeHeaders)
+	}
+}
+
+// preflight 处理预检请求，不允许的来源返回403
+func (c *cors) preflight(httpCtx *gin.Context) {
+	origin := httpCtx.GetHeader("Origin")
+	method := httpCtx.GetHeader("Access-Control-Request-Method")
+	if origin == "" || method == "" {
+		httpCtx.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	if !c.setOrigin(httpCtx, origin) {
+		httpCtx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	header := httpCtx.Writer.Header()
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	header.Set("Access-Control-Allow-Methods", c.allowMethods)
+	if c.allowHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", c.allowHeaders)
+	} else if requestHeaders := httpCtx.GetHeader("Access-Control-Request-Headers"); requestHeaders != "" {
+		header.Set("Access-Control-Allow-Headers", requestHeaders)
+	}
+	header.Set("Access-Control-Max-Age", c.maxAge)
+	httpCtx.AbortWithStatus(http.StatusNoContent)
+}
+
+// registerPreflight 为接口的路径注册预检接口，每个路径只注册一次
+func (wrapper *Wrapper) registerPreflight(srv HttpServer, method, path, fullPath string) {
+	if wrapper.cors == nil {
+		return
+	}
+
+	wrapper.routesMutex.Lock()
+	registered := wrapper.preflights[fullPath]
+	wrapper.preflights[fullPath] = true
+	wrapper.routesMutex.Unlock()
+
+	// 自定义的OPTIONS接口需要自己处理预检请求
+	if registered || method == http.MethodOptions {
+		return
+	}
+	srv.Handle(http.MethodOptions, path, func(httpCtx *gin.Context) {
+		if wrapper.securityHeaders != nil {
+			wrapper.securityHeaders.apply(httpCtx)
+		}
+		wrapper.cors.preflight(httpCtx)
+	})
+}
@@ -0,0 +1,112 @@
+package wrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{
+		Prefix: "TEST",
+		CORS: &CORSPolicy{
+			AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+			AllowCredentials: true,
+			MaxAge:           time.Hour,
+		},
+	})
+	r := gin.New()
+	handler := func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return "ok", nil
+	}
+	wrapper.Get(r, "/orders", handler)
+	wrapper.Post(r, "/orders", handler)
+
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		headers map[string]string
+		status  int
+		allowed bool
+	}{
+		{name: "actual", method: "GET", origin: "https://app.example.com", status: http.StatusOK, allowed: true},
+		{name: "wildcard", method: "GET", origin: "https://a.example.org", status: http.StatusOK, allowed: true},
+		{name: "wildcard without subdomain", method: "GET", origin: "https://.example.org", status: http.StatusOK},
+		{name: "not allowed", method: "GET", origin: "https://evil.com", status: http.StatusOK},
+		{
+			name: "preflight", method: "OPTIONS", origin: "https://app.example.com",
+			headers: map[string]string{"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "Authorization, X-Trace"},
+			status:  http.StatusNoContent, allowed: true,
+		},
+		{
+			name: "preflight not allowed", method: "OPTIONS", origin: "https://evil.com",
+			headers: map[string]string{"Access-Control-Request-Method": "POST"},
+			status:  http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/orders", nil)
+			req.Header.Set("Origin", tt.origin)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+
+			header := w.Header()
+			if w.Code != tt.status || (header.Get("Access-Control-Allow-Origin") == tt.origin) != tt.allowed {
+				t.Fatalf("%s %s = %d %v", tt.method, tt.origin, w.Code, header)
+			}
+			if !tt.allowed {
+				return
+			}
+			if header.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Errorf("Allow-Credentials = %q", header.Get("Access-Control-Allow-Credentials"))
+			}
+			if tt.method != "OPTIONS" {
+				if header.Get("Access-Control-Expose-Headers") != context.RequestIdHeader {
+					t.Errorf("Expose-Headers = %q", header.Get("Access-Control-Expose-Headers"))
+				}
+				return
+			}
+			if header.Get("Access-Control-Allow-Headers") != "Authorization, X-Trace" || header.Get("Access-Control-Max-Age") != "3600" ||
+				header.Get("Access-Control-Allow-Methods") == "" {
+				t.Errorf("preflight headers = %v", header)
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", CORS: &CORSPolicy{AllowOrigins: []string{"*"}}})
+	r := gin.New()
+	wrapper.Get(r, "/", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://any.com")
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("headers = %v", w.Header())
+	}
+}
+
+func TestCORSAnyOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("New() should panic when allow origin * with credentials")
+		}
+	}()
+	New(&Option{Prefix: "TEST", CORS: &CORSPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}})
+}
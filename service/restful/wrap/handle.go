@@ -0,0 +1,268 @@
+package wrap
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+const (
+	// McodeBindFailed 请求参数无法解析到请求结构
+	McodeBindFailed = "REQUEST_BIND_FAILED"
+	// McodeValidateFailed 请求参数校验失败，返回中会附带每个字段的错误
+	McodeValidateFailed = "REQUEST_VALIDATE_FAILED"
+)
+
+// 请求结构中用于绑定的标签
+const (
+	TagPath   = "path"   // 路径参数，比如`path:"id"`对应`/user/:id`
+	TagQuery  = "query"  // 查询参数
+	TagHeader = "header" // 请求头，使用规范格式，比如`header:"X-Service-Name"`
+	TagBody   = "json"   // JSON消息体
+)
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`           // 字段名称，优先使用绑定标签中的名称
+	Rule    string `json:"rule"`            // 未通过的规则，比如required,max
+	Param   string `json:"param,omitempty"` // 规则的参数，比如max=10中的10
+	Message string `json:"message"`
+}
+
+// FieldErrors 包含字段错误的code.Error，Wrapper会把字段错误放在返回的errors中
+type FieldErrors interface {
+	code.Error
+	FieldErrors() []FieldError
+}
+
+// validateError 实现FieldErrors
+type validateError struct {
+	cerr   code.Error
+	fields []FieldError
+}
+
+func (err *validateError) Error() string             { return err.cerr.Error() }
+func (err *validateError) Code() int                 { return err.cerr.Code() }
+func (err *validateError) Mcode() string             { return err.cerr.Mcode() }
+func (err *validateError) Message() string           { return err.cerr.Message() }
+func (err *validateError) FieldErrors() []FieldError { return err.fields }
+func (err *validateError) Unwrap() error             { return err.cerr }
+
+// NewValidateError 创建一个参数校验错误
+func NewValidateError(fields []FieldError) FieldErrors {
+	names := make([]string, 0, len(fields))
+	violations := make([]code.FieldViolation, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Field)
+		violations = append(violations, code.FieldViolation(field))
+	}
+	return &validateError{
+		cerr:   code.WithViolations(code.NewMcodef(McodeValidateFailed, "invalid fields:%s", strings.Join(names, ",")), violations...),
+		fields: fields,
+	}
+}
+
+// fieldErrorsOf 错误中附带的字段错误，包括使用code.WithViolations附加的违规信息
+func fieldErrorsOf(cerr code.Error) []FieldError {
+	if fieldErrs, ok := cerr.(FieldErrors); ok {
+		return fieldErrs.FieldErrors()
+	}
+	violations := code.ViolationsOf(cerr)
+	if len(violations) == 0 {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(violations))
+	for _, violation := range violations {
+		fields = append(fields, FieldError(violation))
+	}
+	return fields
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+// Validator 返回请求校验使用的validator，可以用来注册自定义的校验规则
+func Validator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New()
+		validate.RegisterTagNameFunc(fieldName)
+	})
+	return validate
+}
+
+// fieldName 字段在错误中展示的名称
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{TagPath, TagQuery, TagHeader, TagBody} {
+		name := strings.Split(field.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// Bind 将请求的消息体，查询参数，请求头和路径参数依次绑定到req，并按`validate`标签校验
+func Bind(httpCtx *gin.Context, req interface{}) code.Error {
+	request := httpCtx.Request
+	if request.Body != nil && request.Body != http.NoBody && request.ContentLength != 0 {
+		if err := json.NewDecoder(request.Body).Decode(req); err != nil && !errors.Is(err, io.EOF) {
+			if errors.Is(err, ErrBodyTooLarge) {
+				return code.NewMcode(McodeRequestTooLarge, err.Error())
+			}
+			return code.NewMcodef(McodeBindFailed, "bind body failed,%v", err)
+		}
+	}
+
+	t := reflect.TypeOf(req)
+
+	query := request.URL.Query()
+	if err := mapWithTag(req, t, TagQuery, func(key string) []string { return query[key] }); err != nil {
+		return code.NewMcodef(McodeBindFailed, "bind query failed,%v", err)
+	}
+
+	if err := mapWithTag(req, t, TagHeader, func(key string) []string { return request.Header.Values(key) }); err != nil {
+		return code.NewMcodef(McodeBindFailed, "bind header failed,%v", err)
+	}
+
+	if err := mapWithTag(req, t, TagPath, func(key string) []string {
+		if value, exist := httpCtx.Params.Get(key); exist {
+			return []string{value}
+		}
+		return nil
+	}); err != nil {
+		return code.NewMcodef(McodeBindFailed, "bind path failed,%v", err)
+	}
+
+	return validateRequest(req)
+}
+
+// taggedKeyCache 缓存请求结构中各标签声明的名称
+var taggedKeyCache sync.Map
+
+type taggedKeyCacheKey struct {
+	t   reflect.Type
+	tag string
+}
+
+// taggedKeys 返回结构中使用tag声明的所有名称
+func taggedKeys(t reflect.Type, tag string) []string {
+	cacheKey := taggedKeyCacheKey{t: t, tag: tag}
+	if keys, exist := taggedKeyCache.Load(cacheKey); exist {
+		return keys.([]string)
+	}
+
+	keys := []string{}
+	visited := map[reflect.Type]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || visited[t] {
+			return
+		}
+		visited[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get(tag), ",")[0]
+			if name != "" && name != "-" {
+				keys = append(keys, name)
+				continue
+			}
+			if field.Type.Kind() == reflect.Struct || field.Type.Kind() == reflect.Ptr {
+				walk(field.Type)
+			}
+		}
+	}
+	walk(t)
+
+	taggedKeyCache.Store(cacheKey, keys)
+	return keys
+}
+
+// mapWithTag 仅使用结构中声明了tag的名称进行绑定
+// gin的绑定在字段没有标签时会使用字段名，这里过滤掉未声明的名称，避免查询参数或请求头意外覆盖消息体中的字段
+func mapWithTag(req interface{}, t reflect.Type, tag string, lookup func(string) []string) error {
+	keys := taggedKeys(t, tag)
+	if len(keys) == 0 {
+		return nil
+	}
+
+	form := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		if values := lookup(key); len(values) != 0 {
+			form[key] = values
+		}
+	}
+	if len(form) == 0 {
+		return nil
+	}
+
+	return binding.MapFormWithTag(req, form, tag)
+}
+
+func validateRequest(req interface{}) code.Error {
+	err := Validator().Struct(req)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return code.NewMcodef(McodeValidateFailed, "validate request failed,%v", err)
+	}
+
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		fields = append(fields, FieldError{
+			Field:   fieldErr.Field(),
+			Rule:    fieldErr.Tag(),
+			Param:   fieldErr.Param(),
+			Message: fieldErr.Error(),
+		})
+	}
+
+	return NewValidateError(fields)
+}
+
+// Handle 将强类型的业务函数转换为WrappedFunc，请求参数会自动绑定并校验
+//
+//	type GetUserRequest struct {
+//		Id     string `path:"id" validate:"required"`
+//		Fields string `query:"fields"`
+//		Caller string `header:"X-Service-Name" validate:"required"`
+//	}
+//
+//	wrapper.Get(r, "/user/:id", wrap.Handle(func(ctx context.Context, req *GetUserRequest) (*User, code.Error) {
+//		// ...
+//	}))
+func Handle[Req any, Resp any](f func(ctx context.Context, req *Req) (*Resp, code.Error)) WrappedFunc {
+	return func(srvContext context.Context, httpCtx *gin.Context) (interface{}, code.Error) {
+		req := new(Req)
+		if cerr := Bind(httpCtx, req); cerr != nil {
+			return nil, cerr
+		}
+
+		resp, cerr := f(srvContext, req)
+		if cerr != nil {
+			return nil, cerr
+		}
+		if resp == nil {
+			return nil, nil
+		}
+
+		return resp, nil
+	}
+}
@@ -0,0 +1,105 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+type updateUserRequest struct {
+	Id     int    `path:"id" validate:"required,min=1"`
+	Force  bool   `query:"force"`
+	Caller string `header:"X-Service-Name" validate:"required"`
+	Name   string `json:"name" validate:"required,max=8"`
+	Age    int    `json:"age" validate:"gte=0,lte=150"`
+}
+
+type updateUserResponse struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name"`
+	Force  bool   `json:"force"`
+	Caller string `json:"caller"`
+}
+
+func TestHandle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST"})
+	r := gin.New()
+	wrapper.Put(r, "/user/:id", Handle(func(ctx context.Context, req *updateUserRequest) (*updateUserResponse, code.Error) {
+		return &updateUserResponse{
+			Id:     req.Id,
+			Name:   req.Name,
+			Force:  req.Force,
+			Caller: req.Caller,
+		}, nil
+	}))
+
+	type envelope struct {
+		Result bool               `json:"result"`
+		Mcode  string             `json:"mcode"`
+		Data   updateUserResponse `json:"data"`
+		Errors []FieldError       `json:"errors"`
+	}
+	do := func(path, caller, body string) envelope {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PUT", path, strings.NewReader(body))
+		if caller != "" {
+			req.Header.Set("x-service-name", caller)
+		}
+		r.ServeHTTP(w, req)
+		var rsp envelope
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil {
+			t.Fatalf("bad response %s", w.Body.String())
+		}
+		return rsp
+	}
+
+	rsp := do("/user/12?force=true", "order-service", `{"name":"anna","age":15}`)
+	want := updateUserResponse{Id: 12, Name: "anna", Force: true, Caller: "order-service"}
+	if !rsp.Result || rsp.Data != want {
+		t.Errorf("Handle() = %+v, want %+v", rsp, want)
+	}
+
+	rsp = do("/user/0", "", `{"name":"a-very-long-name","age":200}`)
+	if rsp.Result || rsp.Mcode != McodeValidateFailed {
+		t.Fatalf("Handle() mcode = %v, want %v", rsp.Mcode, McodeValidateFailed)
+	}
+	fields := map[string]string{}
+	for _, fieldErr := range rsp.Errors {
+		fields[fieldErr.Field] = fieldErr.Rule
+	}
+	wantFields := map[string]string{"id": "required", "X-Service-Name": "required", "name": "max", "age": "lte"}
+	for field, rule := range wantFields {
+		if fields[field] != rule {
+			t.Errorf("field %s rule = %q, want %q, all=%v", field, fields[field], rule, fields)
+		}
+	}
+
+	rsp = do("/user/abc", "order-service", `{"name":"anna"}`)
+	if rsp.Mcode != McodeBindFailed {
+		t.Errorf("Handle() mcode = %v, want %v", rsp.Mcode, McodeBindFailed)
+	}
+
+	rsp = do("/user/1", "order-service", `{"name":`)
+	if rsp.Mcode != McodeBindFailed {
+		t.Errorf("Handle() mcode = %v, want %v", rsp.Mcode, McodeBindFailed)
+	}
+}
+
+func TestBindIgnoreUndeclaredNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	httpCtx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	httpCtx.Request, _ = http.NewRequest("POST", "/?Name=query", strings.NewReader(`{"name":"body"}`))
+
+	var req updateUserRequest
+	Bind(httpCtx, &req)
+	if req.Name != "body" {
+		t.Errorf("query should not override body field,got %s", req.Name)
+	}
+}
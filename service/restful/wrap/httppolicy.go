@@ -0,0 +1,197 @@
+package wrap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// McodeRequestTooLarge 请求消息体超过了限制的长度
+const McodeRequestTooLarge = "REQUEST_TOO_LARGE"
+
+// ErrBodyTooLarge 读取的请求消息体超过了限制的长度，业务函数自行读取消息体时可以使用errors.Is判断
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// DefaultHSTSMaxAge 默认的Strict-Transport-Security时长
+const DefaultHSTSMaxAge = 180 * 24 * time.Hour
+
+// SecurityHeaders 所有返回都附带的安全头部，空值的项不添加
+type SecurityHeaders struct {
+	// ContentTypeNosniff 添加X-Content-Type-Options: nosniff
+	ContentTypeNosniff bool
+	// FrameOptions X-Frame-Options，比如DENY,SAMEORIGIN
+	FrameOptions string
+	// ReferrerPolicy Referrer-Policy，比如no-referrer
+	ReferrerPolicy string
+	// ContentSecurityPolicy Content-Security-Policy
+	ContentSecurityPolicy string
+	// HSTSMaxAge Strict-Transport-Security的时长，只在HTTPS请求(包括X-Forwarded-Proto为https)中添加
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains Strict-Transport-Security附带includeSubDomains
+	HSTSIncludeSubdomains bool
+}
+
+// DefaultSecurityHeaders 适用于API服务的安全头部
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		ContentTypeNosniff:    true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+		HSTSMaxAge:            DefaultHSTSMaxAge,
+	}
+}
+
+func (headers *SecurityHeaders) apply(httpCtx *gin.Context) {
+	header := httpCtx.Writer.Header()
+	if headers.ContentTypeNosniff {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	if headers.FrameOptions != "" {
+		header.Set("X-Frame-Options", headers.FrameOptions)
+	}
+	if headers.ReferrerPolicy != "" {
+		header.Set("Referrer-Policy", headers.ReferrerPolicy)
+	}
+	if headers.ContentSecurityPolicy != "" {
+		header.Set("Content-Security-Policy", headers.ContentSecurityPolicy)
+	}
+	if headers.HSTSMaxAge > 0 && isHTTPS(httpCtx) {
+		hsts := "max-age=" + strconv.Itoa(int(headers.HSTSMaxAge/time.Second))
+		if headers.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		header.Set("Strict-Transport-Security", hsts)
+	}
+}
+
+func isHTTPS(httpCtx *gin.Context) bool {
+	return httpCtx.Request.TLS != nil || strings.EqualFold(httpCtx.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// MaxBodySize 接口的请求消息体最大长度，优先于Option.MaxBodySize，<0表示不限制
+//
+//	wrapper.Post(r, "/upload", upload, wrap.MaxBodySize(100<<20))
+func MaxBodySize(n int64) RouteOption {
+	return func(r *route) {
+		r.maxBodySize = n
+	}
+}
+
+// bodyLimitOf 接口的请求消息体最大长度，<=0表示不限制
+func (wrapper *Wrapper) bodyLimitOf(r *route) int64 {
+	if r.maxBodySize != 0 {
+		return r.maxBodySize
+	}
+	return wrapper.maxBodySize
+}
+
+// limitBody 限制请求消息体的长度，Content-Length超过限制时直接拒绝，否则在读取超过限制时返回ErrBodyTooLarge
+func (wrapper *Wrapper) limitBody(httpCtx *gin.Context, r *route) code.Error {
+	limit := wrapper.bodyLimitOf(r)
+	request := httpCtx.Request
+	if limit <= 0 || request.Body == nil {
+		return nil
+	}
+	if request.ContentLength > limit {
+		return code.NewMcodef(McodeRequestTooLarge, "request body %d bytes exceeds %d", request.ContentLength, limit)
+	}
+	request.Body = &limitedBody{ReadCloser: request.Body, remaining: limit}
+	return nil
+}
+
+// limitedBody 与http.MaxBytesReader类似，但不需要关闭连接
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining <= 0 {
+		// 已经读到限制的长度，再读一个字节判断是否还有数据
+		var b [1]byte
+		n, err := body.ReadCloser.Read(b[:])
+		if n > 0 {
+			return 0, ErrBodyTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > body.remaining {
+		p = p[:body.remaining]
+	}
+	n, err := body.ReadCloser.Read(p)
+	body.remaining -= int64(n)
+	return n, err
+}
+
+// parseSize 解析 "512", "64KB", "10MB", "1GB" 形式的大小，单位为1024
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiple := int64(1)
+	for _, unit := range []struct {
+		suffix   string
+		multiple int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, multiple = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.multiple
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return n * multiple, nil
+}
+
+// applyHTTPProfile 使用profile.Service.HTTP的配置填充Option中未设置的项
+func applyHTTPProfile(option *Option, cfg *profile.HTTP) error {
+	if option.CORS == nil && len(cfg.CORSAllowOrigins) != 0 {
+		maxAge, err := parseDuration(cfg.CORSMaxAge, DefaultCORSMaxAge)
+		if err != nil {
+			return fmt.Errorf("cors_max_age %s is not a golang duration", cfg.CORSMaxAge)
+		}
+		option.CORS = &CORSPolicy{
+			AllowOrigins:     cfg.CORSAllowOrigins,
+			AllowMethods:     cfg.CORSAllowMethods,
+			AllowHeaders:     cfg.CORSAllowHeaders,
+			ExposeHeaders:    cfg.CORSExposeHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           maxAge,
+		}
+		if err := option.CORS.validate(); err != nil {
+			return err
+		}
+	}
+
+	if option.SecurityHeaders == nil && cfg.SecurityHeaders {
+		headers := DefaultSecurityHeaders()
+		hstsMaxAge, err := parseDuration(cfg.HSTSMaxAge, DefaultHSTSMaxAge)
+		if err != nil {
+			return fmt.Errorf("hsts_max_age %s is not a golang duration", cfg.HSTSMaxAge)
+		}
+		headers.HSTSMaxAge = hstsMaxAge
+		option.SecurityHeaders = headers
+	}
+
+	if option.MaxBodySize == 0 && cfg.MaxBodySize != "" {
+		size, err := parseSize(cfg.MaxBodySize)
+		if err != nil {
+			return fmt.Errorf("max_body_size:%v", err)
+		}
+		option.MaxBodySize = size
+	}
+
+	if option.Compression == nil && cfg.Compression {
+		option.Compression = &CompressionOption{MinSize: cfg.CompressionMinSize}
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package wrap
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", SecurityHeaders: DefaultSecurityHeaders()})
+	r := gin.New()
+	wrapper.Get(r, "/", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	r.ServeHTTP(w, req)
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Errorf("headers = %v", w.Header())
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("HSTS should only be set over https")
+	}
+
+	w = httptest.NewRecorder()
+	req.TLS = &tls.ConnectionState{}
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Strict-Transport-Security") != "max-age=15552000" {
+		t.Errorf("Strict-Transport-Security = %q", w.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", StatusMapping: NewStatusMapping(), MaxBodySize: 16})
+	r := gin.New()
+	type request struct {
+		Name string `json:"name"`
+	}
+	wrapper.Post(r, "/bind", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		var req request
+		if cerr := Bind(c, &req); cerr != nil {
+			return nil, cerr
+		}
+		return req.Name, nil
+	})
+	wrapper.Post(r, "/upload", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		b, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, code.NewMcode(McodeRequestTooLarge, err.Error())
+		}
+		return len(b), nil
+	}, MaxBodySize(64))
+
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		contentLength bool
+		status        int
+	}{
+		{name: "within limit", path: "/bind", body: `{"name":"a"}`, contentLength: true, status: http.StatusOK},
+		{name: "content length", path: "/bind", body: `{"name":"abcdefghijklmn"}`, contentLength: true, status: http.StatusRequestEntityTooLarge},
+		{name: "chunked", path: "/bind", body: `{"name":"abcdefghijklmn"}`, status: http.StatusRequestEntityTooLarge},
+		{name: "route limit", path: "/upload", body: strings.Repeat("a", 64), status: http.StatusOK},
+		{name: "route limit exceeded", path: "/upload", body: strings.Repeat("a", 65), status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if !tt.contentLength {
+				req.ContentLength = -1
+			}
+			r.ServeHTTP(w, req)
+
+			var rsp Response
+			json.Unmarshal(w.Body.Bytes(), &rsp)
+			if w.Code != tt.status || w.Code != http.StatusOK && rsp.Mcode != McodeRequestTooLarge {
+				t.Errorf("POST %s = %d %s", tt.path, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestApplyHTTPProfile(t *testing.T) {
+	option := &Option{}
+	err := applyHTTPProfile(option, &profile.HTTP{
+		CORSAllowOrigins: []string{"*"},
+		CORSMaxAge:       "1h",
+		SecurityHeaders:  true,
+		HSTSMaxAge:       "0",
+		MaxBodySize:      "10MB",
+		Compression:      true,
+	})
+	if err != nil {
+		t.Fatalf("applyHTTPProfile() error = %v", err)
+	}
+	if option.CORS.MaxAge != time.Hour || option.SecurityHeaders.HSTSMaxAge != 0 || option.MaxBodySize != 10<<20 || option.Compression == nil {
+		t.Errorf("option = %+v", option)
+	}
+
+	for _, cfg := range []*profile.HTTP{
+		{MaxBodySize: "10XB"},
+		{CORSAllowOrigins: []string{"*"}, CORSMaxAge: "1x"},
+		{CORSAllowOrigins: []string{"*"}, CORSAllowCredentials: true},
+	} {
+		if err := applyHTTPProfile(&Option{}, cfg); err == nil {
+			t.Errorf("applyHTTPProfile(%+v) should fail", cfg)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "512", want: 512},
+		{s: "64KB", want: 64 << 10},
+		{s: "10mb", want: 10 << 20},
+		{s: "1G", want: 1 << 30},
+		{s: "10 MB", want: 10 << 20},
+		{s: "-1", wantErr: true},
+		{s: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v", tt.s, got, err)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package wrap
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/restful/code"
+	redisutils "github.com/lworkltd/kits/utils/redis"
+)
+
+const (
+	// IdempotencyKeyHeader 幂等键的默认请求头
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader 返回的是第一次请求的结果时，返回头中会带上该头部
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	// McodeIdempotencyConflict 相同幂等键的请求正在处理中
+	McodeIdempotencyConflict = "IDEMPOTENCY_CONFLICT"
+	// McodeIdempotencyKeyReused 相同的幂等键用于了不同的请求参数
+	McodeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	// McodeIdempotencyKeyMissing 接口要求幂等键，但请求没有携带
+	McodeIdempotencyKeyMissing = "IDEMPOTENCY_KEY_MISSING"
+	// McodeIdempotencyUnavailable 幂等存储不可用
+	McodeIdempotencyUnavailable = "IDEMPOTENCY_UNAVAILABLE"
+)
+
+// ErrIdempotencyStoreFull 内存存储已满，并且所有的记录都在处理中，不能淘汰
+var ErrIdempotencyStoreFull = errors.New("idempotency store is full of requests in progress")
+
+// 幂等的默认配置
+const (
+	DefaultIdempotencyTTL      = 24 * time.Hour
+	DefaultIdempotencyLockTTL  = time.Minute
+	DefaultIdempotencyCapacity = 10000
+)
+
+// IdempotencyRecord 幂等键对应的记录
+type IdempotencyRecord struct {
+	// Fingerprint 请求参数的摘要，用于发现同一个键被用于不同的请求
+	Fingerprint string `json:"fingerprint"`
+	// Done 为false时表示第一次请求仍在处理中
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore 幂等记录的存储
+type IdempotencyStore interface {
+	// Acquire 键不存在时写入进行中的记录，返回acquired为true；键已存在时返回已有的记录
+	Acquire(key string, record *IdempotencyRecord, ttl time.Duration) (existing *IdempotencyRecord, acquired bool, err error)
+	// Complete 保存第一次请求的结果
+	Complete(key string, record *IdempotencyRecord, ttl time.Duration) error
+	// Release 删除进行中的记录，使请求可以重试
+	Release(key string) error
+}
+
+// IdempotencyOption 幂等的配置
+type IdempotencyOption struct {
+	// Store 幂等记录的存储，默认容量为10000的内存LRU
+	Store IdempotencyStore
+	// Header 幂等键的请求头，默认Idempotency-Key
+	Header string
+	// TTL 第一次请求的结果保存的时长，默认24h
+	TTL time.Duration
+	// LockTTL 进行中的记录保存的时长，避免进程退出后键一直被占用，默认1m
+	LockTTL time.Duration
+	// Required 为true时未携带幂等键的请求返回IDEMPOTENCY_KEY_MISSING，否则正常处理
+	Required bool
+	// ClientIdentity 调用方的标识，幂等键只在同一调用方内生效，默认使用认证的调用方(Principal.Subject)
+	ClientIdentity func(serviceCtx context.Context, httpCtx *gin.Context) string
+}
+
+// idempotency 接口的幂等配置
+type idempotency struct {
+	store          IdempotencyStore
+	header         string
+	ttl            time.Duration
+	lockTTL        time.Duration
+	required       bool
+	clientIdentity func(serviceCtx context.Context, httpCtx *gin.Context) string
+}
+
+// principalIdentity 默认的调用方标识，未认证时为空
+func principalIdentity(serviceCtx context.Context, httpCtx *gin.Context) string {
+	if principal := context.PrincipalFromContext(serviceCtx); principal != nil {
+		return principal.Subject
+	}
+	return ""
+}
+
+// Idempotent 为接口开启幂等，同一调用方携带相同幂等键的请求只会执行一次，之后返回第一次的结果
+// 第一次请求仍在处理时返回IDEMPOTENCY_CONFLICT，业务函数panic或返回可重试的错误时删除记录以便重试
+//
+//	wrapper.Post(r, "/order", createOrder, wrap.Idempotent(&wrap.IdempotencyOption{
+//		Store: wrap.NewRedisIdempotencyStore(redisClient, "myservice:idempotency:"),
+//	}))
+func Idempotent(option *IdempotencyOption) RouteOption {
+	idem := &idempotency{
+		header:         IdempotencyKeyHeader,
+		ttl:            DefaultIdempotencyTTL,
+		lockTTL:        DefaultIdempotencyLockTTL,
+		clientIdentity: principalIdentity,
+	}
+	if option != nil {
+		idem.store = option.Store
+		idem.required = option.Required
+		if option.ClientIdentity != nil {
+			idem.clientIdentity = option.ClientIdentity
+		}
+		if option.Header != "" {
+			idem.header = option.Header
+		}
+		if option.TTL > 0 {
+			idem.ttl = option.TTL
+		}
+		if option.LockTTL > 0 {
+			idem.lockTTL = option.LockTTL
+		}
+	}
+	if idem.store == nil {
+		idem.store = NewMemoryIdempotencyStore(DefaultIdempotencyCapacity)
+	}
+
+	return func(r *route) {
+		r.idempotency = idem
+		r.mcodes = append(r.mcodes, McodeIdempotencyConflict, McodeIdempotencyKeyReused, McodeIdempotencyUnavailable)
+		if idem.required {
+			r.mcodes = append(r.mcodes, McodeIdempotencyKeyMissing)
+		}
+	}
+}
+
+// idempotentCall 一次携带幂等键的请求
+type idempotentCall struct {
+	idem        *idempotency
+	key         string
+	fingerprint string
+	replayed    bool
+	writer      *recordingWriter
+}
+
+// begin 占用幂等键，重复的请求直接写入第一次的结果，返回的call为nil时表示不需要幂等处理
+func (idem *idempotency) begin(serviceCtx context.Context, httpCtx *gin.Context, r *route) (*idempotentCall, code.Error) {
+	header := httpCtx.GetHeader(idem.header)
+	if header == "" {
+		if idem.required {
+			return nil, code.NewMcodef(McodeIdempotencyKeyMissing, "header %s is required", idem.header)
+		}
+		return &idempotentCall{}, nil
+	}
+
+	fingerprint, err := requestFingerprint(httpCtx.Request)
+	if err != nil {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, code.NewMcode(McodeRequestTooLarge, err.Error())
+		}
+		return nil, code.NewMcodef(McodeBindFailed, "read request body failed,%v", err)
+	}
+
+	call := &idempotentCall{
+		idem:        idem,
+		key:         r.method + " " + r.path + " " + idem.clientIdentity(serviceCtx, httpCtx) + " " + header,
+		fingerprint: fingerprint,
+	}
+	existing, acquired, err := idem.store.Acquire(call.key, &IdempotencyRecord{Fingerprint: fingerprint}, idem.lockTTL)
+	if err != nil {
+		return nil, code.NewMcodef(McodeIdempotencyUnavailable, "idempotency store failed,%v", err)
+	}
+
+	if !acquired {
+		if existing.Fingerprint != fingerprint {
+			return nil, code.NewMcodef(McodeIdempotencyKeyReused, "%s %s was used by another request", idem.header, header)
+		}
+		if !existing.Done {
+			return nil, code.NewMcodef(McodeIdempotencyConflict, "request with %s %s is in progress", idem.header, header)
+		}
+
+		httpCtx.Header(IdempotentReplayedHeader, "true")
+		httpCtx.Data(existing.Status, existing.ContentType, existing.Body)
+		call.replayed = true
+		return call, nil
+	}
+
+	call.writer = &recordingWriter{ResponseWriter: httpCtx.Writer}
+	httpCtx.Writer = call.writer
+	return call, nil
+}
+
+// finish 保存第一次请求的结果，panic，可重试的错误，返回被劫持或者流式返回时删除记录
+func (call *idempotentCall) finish(httpCtx *gin.Context, data interface{}, cerr code.Error, panicked bool) {
+	if call.idem == nil || call.replayed {
+		return
+	}
+
+	var hijacked bool
+	switch data.(type) {
+	case *HijackedResponse, *StreamResponse:
+		hijacked = true
+	}
+	// 未配置StatusMapping时错误也是200，需要按错误的分类判断
+	retryable := cerr != nil && code.IsRetryable(cerr)
+	if panicked || hijacked || retryable || call.writer.Status() >= http.StatusInternalServerError {
+		call.idem.store.Release(call.key)
+		return
+	}
+
+	call.idem.store.Complete(call.key, &IdempotencyRecord{
+		Fingerprint: call.fingerprint,
+		Done:        true,
+		Status:      call.writer.Status(),
+		ContentType: call.writer.Header().Get("Content-Type"),
+		Body:        call.writer.body.Bytes(),
+	}, call.idem.ttl)
+}
+
+// requestFingerprint 请求参数的摘要，读取的消息体会重新放回请求中
+func requestFingerprint(request *http.Request) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, request.Method+" "+request.URL.RequestURI()+"\n")
+	if request.Body != nil && request.Body != http.NoBody {
+		body, err := ioutil.ReadAll(request.Body)
+		if err != nil {
+			return "", err
+		}
+		request.Body.Close()
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordingWriter 记录写入的消息体
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// MemoryIdempotencyStore 容量有限的内存存储，超过容量时淘汰最久未使用的已完成或已过期的记录
+// 处理中的记录不会被淘汰，全部记录都在处理中时返回ErrIdempotencyStoreFull
+type MemoryIdempotencyStore struct {
+	capacity int
+	mutex    sync.Mutex
+	items    map[string]*list.Element
+	lru      *list.List
+}
+
+type memoryIdempotencyItem struct {
+	key      string
+	record   IdempotencyRecord
+	expireAt time.Time
+}
+
+// NewMemoryIdempotencyStore 创建内存存储，只适用于单实例部署
+func NewMemoryIdempotencyStore(capacity int) *MemoryIdempotencyStore {
+	if capacity <= 0 {
+		capacity = DefaultIdempotencyCapacity
+	}
+	return &MemoryIdempotencyStore{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		lru:      list.New(),
+	}
+}
+
+func (store *MemoryIdempotencyStore) Acquire(key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if element, exist := store.items[key]; exist {
+		item := element.Value.(*memoryIdempotencyItem)
+		if time.Now().Before(item.expireAt) {
+			store.lru.MoveToFront(element)
+			existing := item.record
+			return &existing, false, nil
+		}
+		store.remove(element)
+	}
+
+	if err := store.set(key, record, ttl); err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
+
+func (store *MemoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if element, exist := store.items[key]; exist {
+		store.remove(element)
+	}
+	return store.set(key, record, ttl)
+}
+
+func (store *MemoryIdempotencyStore) Release(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if element, exist := store.items[key]; exist {
+		store.remove(element)
+	}
+	return nil
+}
+
+// Len 当前保存的记录数
+func (store *MemoryIdempotencyStore) Len() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.lru.Len()
+}
+
+func (store *MemoryIdempotencyStore) set(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	if store.lru.Len() >= store.capacity && !store.evict() {
+		return ErrIdempotencyStoreFull
+	}
+	store.items[key] = store.lru.PushFront(&memoryIdempotencyItem{
+		key:      key,
+		record:   *record,
+		expireAt: time.Now().Add(ttl),
+	})
+	return nil
+}
+
+// evict 从最久未使用的一端淘汰一条已完成或已过期的记录，淘汰处理中的记录会使重试的请求再次执行
+func (store *MemoryIdempotencyStore) evict() bool {
+	now := time.Now()
+	for element := store.lru.Back(); element != nil; element = element.Prev() {
+		item := element.Value.(*memoryIdempotencyItem)
+		if item.record.Done || !now.Before(item.expireAt) {
+			store.remove(element)
+			return true
+		}
+	}
+	return false
+}
+
+func (store *MemoryIdempotencyStore) remove(element *list.Element) {
+	store.lru.Remove(element)
+	delete(store.items, element.Value.(*memoryIdempotencyItem).key)
+}
+
+// RedisIdempotencyStore 使用Redis保存幂等记录，适用于多实例部署
+type RedisIdempotencyStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisIdempotencyStore 创建Redis存储，prefix为键的前缀，比如"myservice:idempotency:"
+func NewRedisIdempotencyStore(client redis.Cmdable, prefix string) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+// NewRedisIdempotencyStoreWithProfile 使用Redis的配置创建存储
+func NewRedisIdempotencyStoreWithProfile(cfg *profile.Redis, prefix string) *RedisIdempotencyStore {
+	return NewRedisIdempotencyStore(redis.NewClusterClient(redisutils.Option(cfg)), prefix)
+}
+
+func (store *RedisIdempotencyStore) Acquire(key string, record *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	acquired, err := store.client.SetNX(store.prefix+key, b, ttl).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if acquired {
+		return nil, true, nil
+	}
+
+	value, err := store.client.Get(store.prefix + key).Bytes()
+	if err == redis.Nil {
+		// 记录刚好过期，重新占用
+		return store.Acquire(key, record, ttl)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing := &IdempotencyRecord{}
+	if err := json.Unmarshal(value, existing); err != nil {
+		return nil, false, err
+	}
+	return existing, false, nil
+}
+
+func (store *RedisIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.client.Set(store.prefix+key, b, ttl).Err()
+}
+
+func (store *RedisIdempotencyStore) Release(key string) error {
+	return store.client.Del(store.prefix + key).Err()
+}
@@ -0,0 +1,216 @@
+package wrap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/auth"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestIdempotent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", StatusMapping: NewStatusMapping()})
+	r := gin.New()
+
+	var calls int64
+	entered := make(chan struct{})
+	block := make(chan struct{})
+	wrapper.Post(r, "/order", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		n := atomic.AddInt64(&calls, 1)
+		if c.Query("block") != "" {
+			entered <- struct{}{}
+			<-block
+		}
+		if c.Query("panic") != "" && n == 1 {
+			panic("first call panic")
+		}
+		return n, nil
+	}, Idempotent(nil))
+
+	post := func(key, query, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/order"+query, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	mcodeOf := func(w *httptest.ResponseRecorder) string {
+		var rsp Response
+		json.Unmarshal(w.Body.Bytes(), &rsp)
+		return rsp.Mcode
+	}
+
+	first := post("k1", "", `{"amount":1}`)
+	replay := post("k1", "", `{"amount":1}`)
+	if replay.Body.String() != first.Body.String() || replay.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("replay = %s, want %s", replay.Body.String(), first.Body.String())
+	}
+	if atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	if w := post("k1", "", `{"amount":2}`); w.Code != http.StatusUnprocessableEntity || mcodeOf(w) != McodeIdempotencyKeyReused {
+		t.Errorf("reused key = %d %s", w.Code, w.Body.String())
+	}
+
+	post("", "", `{"amount":1}`)
+	post("", "", `{"amount":1}`)
+	if atomic.LoadInt64(&calls) != 3 {
+		t.Errorf("requests without key should not be deduplicated, calls %d", calls)
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post("k2", "?block=1", "") }()
+	<-entered
+	if w := post("k2", "?block=1", ""); w.Code != http.StatusConflict || mcodeOf(w) != McodeIdempotencyConflict {
+		t.Errorf("in flight = %d %s", w.Code, w.Body.String())
+	}
+	close(block)
+	if w := <-done; w.Code != http.StatusOK {
+		t.Errorf("blocked request = %d %s", w.Code, w.Body.String())
+	}
+
+	atomic.StoreInt64(&calls, 0)
+	if w := post("k3", "?panic=1", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("panic = %d %s", w.Code, w.Body.String())
+	}
+	if w := post("k3", "?panic=1", ""); w.Code != http.StatusOK || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("retry after panic = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotentScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST"})
+	r := gin.New()
+
+	var calls int64
+	authenticator := auth.AuthenticatorFunc(func(request *http.Request) (*context.Principal, error) {
+		return &context.Principal{Subject: request.Header.Get("X-User")}, nil
+	})
+	wrapper.Post(r, "/order", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		n := atomic.AddInt64(&calls, 1)
+		if c.Query("transient") != "" && n == 1 {
+			return nil, code.WithClass(code.New(1, "connection reset"), code.ClassTransient)
+		}
+		if c.Query("invalid") != "" {
+			return nil, code.WithClass(code.New(2, "bad amount"), code.ClassInvalid)
+		}
+		return n, nil
+	}, Authenticate(authenticator), Idempotent(nil))
+
+	post := func(user, key, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/order"+query, strings.NewReader(`{"amount":1}`))
+		req.Header.Set("X-User", user)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	post("alice", "k1", "")
+	if w := post("bob", "k1", ""); w.Header().Get(IdempotentReplayedHeader) != "" || atomic.LoadInt64(&calls) != 2 {
+		t.Errorf("same key from another caller should not replay, calls %d", calls)
+	}
+
+	// 未配置StatusMapping时错误也是200，可重试的错误不保存
+	atomic.StoreInt64(&calls, 0)
+	post("alice", "k2", "?transient=1")
+	if w := post("alice", "k2", "?transient=1"); w.Header().Get(IdempotentReplayedHeader) != "" || !strings.Contains(w.Body.String(), `"result":true`) {
+		t.Errorf("retry after transient error = %s", w.Body.String())
+	}
+
+	// 不可重试的错误仍然保存
+	atomic.StoreInt64(&calls, 0)
+	post("alice", "k3", "?invalid=1")
+	if w := post("alice", "k3", "?invalid=1"); w.Header().Get(IdempotentReplayedHeader) != "true" || atomic.LoadInt64(&calls) != 1 {
+		t.Errorf("invalid error should be replayed, calls %d", calls)
+	}
+}
+
+func TestIdempotentRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", StatusMapping: NewStatusMapping()})
+	r := gin.New()
+	wrapper.Post(r, "/order", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	}, Idempotent(&IdempotencyOption{Required: true}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/order", nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), McodeIdempotencyKeyMissing) {
+		t.Errorf("missing key = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotentBodyTooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", StatusMapping: NewStatusMapping()})
+	r := gin.New()
+	wrapper.Post(r, "/order", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	}, Idempotent(nil), MaxBodySize(4))
+
+	w := httptest.NewRecorder()
+	// 没有Content-Length，读取时才发现超过限制
+	req, _ := http.NewRequest("POST", "/order", struct{ io.Reader }{strings.NewReader(`{"amount":1}`)})
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), McodeRequestTooLarge) {
+		t.Errorf("too large body = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(2)
+	record := &IdempotencyRecord{Fingerprint: "f"}
+
+	if _, acquired, _ := store.Acquire("a", record, time.Minute); !acquired {
+		t.Fatalf("Acquire(a) should succeed")
+	}
+	store.Acquire("b", record, time.Minute)
+	if _, acquired, err := store.Acquire("c", record, time.Minute); acquired || err != ErrIdempotencyStoreFull {
+		t.Errorf("Acquire(c) = %v %v, records in progress should not be evicted", acquired, err)
+	}
+
+	done := &IdempotencyRecord{Fingerprint: "f", Done: true}
+	store.Complete("a", done, time.Minute)
+	store.Complete("b", done, time.Minute)
+	if existing, acquired, _ := store.Acquire("a", record, time.Minute); acquired || existing.Fingerprint != "f" {
+		t.Errorf("Acquire(a) again = %v %v, want existing record", existing, acquired)
+	}
+	store.Acquire("c", record, time.Minute)
+	if store.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", store.Len())
+	}
+	if existing, _, _ := store.Acquire("a", record, time.Minute); existing == nil || !existing.Done {
+		t.Errorf("a = %v, want the completed record", existing)
+	}
+	if _, acquired, _ := store.Acquire("b", record, time.Minute); !acquired {
+		t.Errorf("least recently used completed b should be evicted")
+	}
+
+	store = NewMemoryIdempotencyStore(2)
+
+	store.Acquire("expired", record, -time.Second)
+	if _, acquired, _ := store.Acquire("expired", record, time.Minute); !acquired {
+		t.Errorf("expired record should be replaced")
+	}
+
+	store.Release("expired")
+	if _, acquired, _ := store.Acquire("expired", record, time.Minute); !acquired {
+		t.Errorf("released record should be acquired again")
+	}
+}
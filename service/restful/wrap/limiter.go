@@ -0,0 +1,341 @@
+package wrap
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter 准入控制器，key为请求的分组，同一个key的请求共享限制
+// Acquire 返回是否准入，准入时返回的release必须在请求处理完成后调用，参数为处理耗时
+// 请求没有被处理时(比如被之后的规则拒绝)，release的参数为CanceledLatency，只归还名额不计入延迟统计
+type Limiter interface {
+	Acquire(key string) (release func(latency time.Duration), ok bool)
+}
+
+// CanceledLatency 请求没有被处理时release的参数
+const CanceledLatency time.Duration = -1
+
+func noopRelease(time.Duration) {}
+
+// defaultMaxKeys 每个限流器最多保存的key数量，超过后清理长时间未使用的key
+const defaultMaxKeys = 10000
+
+// keyedStates 按key保存限流状态，key过多时清理空闲的状态，避免按IP限流时内存无限增长
+type keyedStates struct {
+	mutex   sync.Mutex
+	states  map[string]*keyedState
+	newFn   func() interface{}
+	idleFor time.Duration
+	// inUse 为true的状态即使空闲也不清理，比如还有正在处理的请求
+	inUse func(value interface{}) bool
+}
+
+type keyedState struct {
+	lastUsed time.Time
+	value    interface{}
+}
+
+func newKeyedStates(idleFor time.Duration, newFn func() interface{}) *keyedStates {
+	return &keyedStates{
+		states:  make(map[string]*keyedState, 16),
+		newFn:   newFn,
+		idleFor: idleFor,
+	}
+}
+
+// get 获取key对应的状态，调用时必须持有锁
+func (states *keyedStates) get(key string, now time.Time) interface{} {
+	state, exist := states.states[key]
+	if !exist {
+		if len(states.states) >= defaultMaxKeys {
+			states.sweep(now)
+		}
+		state = &keyedState{value: states.newFn()}
+		states.states[key] = state
+	}
+	state.lastUsed = now
+
+	return state.value
+}
+
+func (states *keyedStates) sweep(now time.Time) {
+	for key, state := range states.states {
+		if now.Sub(state.lastUsed) > states.idleFor && (states.inUse == nil || !states.inUse(state.value)) {
+			delete(states.states, key)
+		}
+	}
+}
+
+// TokenBucketLimiter 令牌桶限流，每秒补充Rate个令牌，最多积累Burst个令牌
+type TokenBucketLimiter struct {
+	rate   float64
+	burst  float64
+	states *keyedStates
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter 创建令牌桶限流器，burst<=0时与rate相同
+func NewTokenBucketLimiter(rate float64, burst int) *TokenBucketLimiter {
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Max(rate, 1)
+	}
+	idle := time.Minute
+	if rate > 0 && time.Duration(b/rate*float64(time.Second)) > idle {
+		idle = time.Duration(b / rate * float64(time.Second))
+	}
+
+	return &TokenBucketLimiter{
+		rate:  rate,
+		burst: b,
+		states: newKeyedStates(idle, func() interface{} {
+			return &tokenBucket{tokens: b}
+		}),
+	}
+}
+
+// Acquire 实现Limiter
+func (limiter *TokenBucketLimiter) Acquire(key string) (func(time.Duration), bool) {
+	now := time.Now()
+	limiter.states.mutex.Lock()
+	defer limiter.states.mutex.Unlock()
+
+	bucket := limiter.states.get(key, now).(*tokenBucket)
+	if !bucket.last.IsZero() {
+		bucket.tokens = math.Min(limiter.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limiter.rate)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return nil, false
+	}
+	bucket.tokens--
+
+	return noopRelease, true
+}
+
+// SlidingWindowLimiter 滑动窗口限流，任意Window时长内最多Limit个请求
+// 使用前后两个窗口的计数按时间加权估算，避免固定窗口在边界处的突发
+type SlidingWindowLimiter struct {
+	limit  float64
+	window time.Duration
+	states *keyedStates
+}
+
+type slidingWindow struct {
+	start    time.Time
+	current  float64
+	previous float64
+}
+
+// NewSlidingWindowLimiter 创建滑动窗口限流器
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowLimiter {
+	if window <= 0 {
+		window = time.Second
+	}
+	return &SlidingWindowLimiter{
+		limit:  float64(limit),
+		window: window,
+		states: newKeyedStates(window*2, func() interface{} {
+			return &slidingWindow{}
+		}),
+	}
+}
+
+// Acquire 实现Limiter
+func (limiter *SlidingWindowLimiter) Acquire(key string) (func(time.Duration), bool) {
+	now := time.Now()
+	limiter.states.mutex.Lock()
+	defer limiter.states.mutex.Unlock()
+
+	w := limiter.states.get(key, now).(*slidingWindow)
+	start := now.Truncate(limiter.window)
+	switch {
+	case start.Equal(w.start):
+	case start.Sub(w.start) == limiter.window:
+		w.previous, w.current, w.start = w.current, 0, start
+	default:
+		w.previous, w.current, w.start = 0, 0, start
+	}
+
+	elapsed := float64(now.Sub(start)) / float64(limiter.window)
+	if w.previous*(1-elapsed)+w.current >= limiter.limit {
+		return nil, false
+	}
+	w.current++
+
+	return noopRelease, true
+}
+
+// ConcurrencyLimiter 并发限制，同一个key同时处理的请求数不超过Limit
+type ConcurrencyLimiter struct {
+	limit  int
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+// NewConcurrencyLimiter 创建并发限制器
+func NewConcurrencyLimiter(limit int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limit:  limit,
+		counts: make(map[string]int, 16),
+	}
+}
+
+// Acquire 实现Limiter
+func (limiter *ConcurrencyLimiter) Acquire(key string) (func(time.Duration), bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if limiter.counts[key] >= limiter.limit {
+		return nil, false
+	}
+	limiter.counts[key]++
+
+	return func(time.Duration) {
+		limiter.mutex.Lock()
+		defer limiter.mutex.Unlock()
+		if limiter.counts[key]--; limiter.counts[key] <= 0 {
+			delete(limiter.counts, key)
+		}
+	}, true
+}
+
+// InFlight 返回key当前正在处理的请求数
+func (limiter *ConcurrencyLimiter) InFlight(key string) int {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	return limiter.counts[key]
+}
+
+const (
+	// AdaptiveAIMD 加性增乘性减，延迟超过目标时按比例收缩并发上限，否则逐步放大
+	AdaptiveAIMD = "aimd"
+	// AdaptiveGradient 梯度算法，按最小延迟与当前延迟的比值调整并发上限
+	AdaptiveGradient = "gradient"
+)
+
+// AdaptiveOption 自适应限流的参数
+type AdaptiveOption struct {
+	Algorithm     string        // aimd或gradient，默认aimd
+	InitialLimit  int           // 初始并发上限，默认20
+	MinLimit      int           // 并发上限的下限，默认1
+	MaxLimit      int           // 并发上限的上限，默认1000
+	TargetLatency time.Duration // AIMD的目标延迟，默认100ms
+	BackoffRatio  float64       // AIMD收缩比例，默认0.9
+}
+
+// AdaptiveLimiter 根据处理延迟自动调整并发上限的限流器
+type AdaptiveLimiter struct {
+	option AdaptiveOption
+	states *keyedStates
+}
+
+type adaptiveState struct {
+	limit    float64
+	inFlight int
+	minRTT   time.Duration
+}
+
+// NewAdaptiveLimiter 创建自适应限流器
+func NewAdaptiveLimiter(option AdaptiveOption) *AdaptiveLimiter {
+	if option.Algorithm == "" {
+		option.Algorithm = AdaptiveAIMD
+	}
+	if option.MinLimit <= 0 {
+		option.MinLimit = 1
+	}
+	if option.MaxLimit <= 0 {
+		option.MaxLimit = 1000
+	}
+	if option.InitialLimit <= 0 {
+		option.InitialLimit = 20
+	}
+	if option.InitialLimit < option.MinLimit {
+		option.InitialLimit = option.MinLimit
+	}
+	if option.InitialLimit > option.MaxLimit {
+		option.InitialLimit = option.MaxLimit
+	}
+	if option.TargetLatency <= 0 {
+		option.TargetLatency = 100 * time.Millisecond
+	}
+	if option.BackoffRatio <= 0 || option.BackoffRatio >= 1 {
+		option.BackoffRatio = 0.9
+	}
+
+	states := newKeyedStates(time.Minute, func() interface{} {
+		return &adaptiveState{limit: float64(option.InitialLimit)}
+	})
+	states.inUse = func(value interface{}) bool {
+		return value.(*adaptiveState).inFlight > 0
+	}
+
+	return &AdaptiveLimiter{
+		option: option,
+		states: states,
+	}
+}
+
+// Acquire 实现Limiter
+func (limiter *AdaptiveLimiter) Acquire(key string) (func(time.Duration), bool) {
+	limiter.states.mutex.Lock()
+	defer limiter.states.mutex.Unlock()
+
+	state := limiter.states.get(key, time.Now()).(*adaptiveState)
+	if float64(state.inFlight) >= math.Floor(state.limit) {
+		return nil, false
+	}
+	state.inFlight++
+
+	return func(latency time.Duration) {
+		limiter.states.mutex.Lock()
+		defer limiter.states.mutex.Unlock()
+		state.inFlight--
+		if latency >= 0 {
+			limiter.update(state, latency)
+		}
+	}, true
+}
+
+// Limit 返回key当前的并发上限
+func (limiter *AdaptiveLimiter) Limit(key string) int {
+	limiter.states.mutex.Lock()
+	defer limiter.states.mutex.Unlock()
+
+	state, exist := limiter.states.states[key]
+	if !exist {
+		return limiter.option.InitialLimit
+	}
+	return int(state.value.(*adaptiveState).limit)
+}
+
+// update 根据延迟调整并发上限，调用时必须持有锁，latency不能为CanceledLatency
+func (limiter *AdaptiveLimiter) update(state *adaptiveState, latency time.Duration) {
+	option := limiter.option
+	switch option.Algorithm {
+	case AdaptiveGradient:
+		if state.minRTT == 0 || latency < state.minRTT {
+			state.minRTT = latency
+		}
+		if latency <= 0 {
+			return
+		}
+		gradient := math.Max(0.5, math.Min(1, float64(state.minRTT)/float64(latency)))
+		state.limit = state.limit*gradient + math.Sqrt(state.limit)
+	default:
+		if latency > option.TargetLatency {
+			state.limit = state.limit * option.BackoffRatio
+		} else if float64(state.inFlight+1) >= state.limit/2 {
+			// 仅在并发上限被较充分使用时放大，避免空闲时上限无限增长
+			state.limit += 1 / state.limit
+		}
+	}
+
+	state.limit = math.Max(float64(option.MinLimit), math.Min(float64(option.MaxLimit), state.limit))
+}
@@ -0,0 +1,21 @@
+package wrap
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// localize 使用mcode和Accept-Language中的语言渲染返回给调用方的错误信息，日志中仍然使用原始的错误信息
+func (wrapper *Wrapper) localize(httpCtx *gin.Context, cerr code.Error, mcode string) code.Error {
+	if wrapper.messages == nil {
+		return cerr
+	}
+
+	httpCtx.Writer.Header().Add("Vary", "Accept-Language")
+	message, locale, ok := wrapper.messages.Message(mcode, code.ParamsOf(cerr), code.ParseAcceptLanguage(httpCtx.GetHeader("Accept-Language"))...)
+	if !ok {
+		return cerr
+	}
+	httpCtx.Header("Content-Language", locale)
+	return code.WithMessage(cerr, message)
+}
@@ -0,0 +1,67 @@
+package wrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestWrapLocalizedMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logs bytes.Buffer
+	wrapper := New(&Option{
+		Prefix:    "TEST",
+		LogWriter: &logs,
+		Messages: code.NewCatalog("en").
+			Add("zh-CN", "USER_NOT_FOUND", "用户{id}不存在").
+			Add("en", "USER_NOT_FOUND", "User {id} not found").
+			Add("zh", "TEST_1001", "余额不足"),
+	})
+	r := gin.New()
+	wrapper.Get(r, "/user", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, code.WithParam(code.NewMcode("USER_NOT_FOUND", "user not found"), "id", c.Query("id"))
+	})
+	wrapper.Get(r, "/balance", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, code.New(1001, "balance not enough")
+	})
+	wrapper.Get(r, "/other", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, code.NewMcode("OTHER", "other failed")
+	})
+
+	tests := []struct {
+		path     string
+		language string
+		want     string
+		locale   string
+	}{
+		{path: "/user?id=1", language: "zh-CN,zh;q=0.9,en;q=0.8", want: "用户1不存在", locale: "zh-CN"},
+		{path: "/user?id=1", language: "fr", want: "User 1 not found", locale: "en"},
+		{path: "/balance", language: "zh-TW", want: "余额不足", locale: "zh"},
+		{path: "/other", language: "zh-CN", want: "other failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.language, func(t *testing.T) {
+			logs.Reset()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept-Language", tt.language)
+			r.ServeHTTP(w, req)
+
+			var rsp Response
+			json.Unmarshal(w.Body.Bytes(), &rsp)
+			if rsp.Message != tt.want || w.Header().Get("Content-Language") != tt.locale {
+				t.Errorf("message = %q, Content-Language = %q", rsp.Message, w.Header().Get("Content-Language"))
+			}
+			if tt.locale != "" && strings.Contains(logs.String(), tt.want) {
+				t.Errorf("log should keep the canonical message, got %s", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// DefaultOpenAPIPath 接口文档的默认地址
+const DefaultOpenAPIPath = "/openapi.json"
+
+// OpenAPIInfo 接口文档的基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIDocument OpenAPI 3的文档，只包含生成时用到的部分
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIComponents 文档中可复用的结构
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas"`
+}
+
+// OpenAPIOperation 单个接口
+type OpenAPIOperation struct {
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	// Mcodes 接口可能返回的所有错误码
+	Mcodes []string `json:"x-mcodes,omitempty"`
+}
+
+// OpenAPIParameter 路径参数，查询参数或请求头
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody 请求的消息体
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse 接口的返回
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType 消息体的结构
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema JSON Schema的子集
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	AllOf                []*OpenAPISchema          `json:"allOf,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+}
+
+const (
+	schemaResponse      = "Response"
+	schemaErrorResponse = "ErrorResponse"
+	schemaFieldError    = "FieldError"
+	jsonContentType     = "application/json"
+)
+
+// OpenAPI 根据注册的接口生成OpenAPI 3文档
+// 使用wrap.Route,wrap.Typed或wrap.Types声明了请求和返回结构的接口会生成参数和返回的结构，
+// 所有的返回都使用统一的{result,mcode,message,data,timestamp}结构
+func (wrapper *Wrapper) OpenAPI(info OpenAPIInfo) *OpenAPIDocument {
+	wrapper.routesMutex.Lock()
+	routes := make([]*route, len(wrapper.routes))
+	copy(routes, wrapper.routes)
+	wrapper.routesMutex.Unlock()
+
+	builder := newSchemaBuilder()
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: builder.schemas,
+		},
+	}
+	builder.reserve(schemaResponse, envelopeSchema(true))
+	builder.reserve(schemaErrorResponse, envelopeSchema(false))
+	builder.schemaOf(reflect.TypeOf(FieldError{}))
+
+	for _, r := range routes {
+		if r.hidden {
+			continue
+		}
+		path := openAPIPath(r.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(r.method)] = wrapper.operation(builder, r)
+	}
+
+	return doc
+}
+
+// ServeOpenAPI 在srv上注册接口文档，path为空时使用/openapi.json
+// 文档在每次请求时生成，之后注册的接口也会出现在文档中
+func (wrapper *Wrapper) ServeOpenAPI(srv HttpServer, path string, info OpenAPIInfo) {
+	if path == "" {
+		path = DefaultOpenAPIPath
+	}
+	srv.Handle(http.MethodGet, path, func(httpCtx *gin.Context) {
+		httpCtx.JSON(http.StatusOK, wrapper.OpenAPI(info))
+	})
+}
+
+// envelopeSchema 统一的返回结构
+func envelopeSchema(success bool) *OpenAPISchema {
+	schema := &OpenAPISchema{
+		Type: "object",
+		Properties: map[string]*OpenAPISchema{
+			"result":     {Type: "boolean"},
+			"timestamp":  {Type: "integer", Format: "int64", Description: "milliseconds since epoch"},
+			"request_id": {Type: "string", Description: "same as the X-Request-Id response header"},
+		},
+		Required: []string{"result", "timestamp"},
+	}
+	if success {
+		schema.Properties["data"] = &OpenAPISchema{}
+		return schema
+	}
+
+	schema.Properties["mcode"] = &OpenAPISchema{Type: "string"}
+	schema.Properties["message"] = &OpenAPISchema{Type: "string"}
+	schema.Properties["errors"] = &OpenAPISchema{
+		Type:  "array",
+		Items: &OpenAPISchema{Ref: componentRef(schemaFieldError)},
+	}
+	schema.Required = append(schema.Required, "mcode")
+
+	return schema
+}
+
+func componentRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+var ginParamRegexp = regexp.MustCompile(`[:*]([^/]+)`)
+
+// openAPIPath 将gin的路径格式转换为OpenAPI的格式，`/user/:id` -> `/user/{id}`
+func openAPIPath(path string) string {
+	return ginParamRegexp.ReplaceAllString(path, "{$1}")
+}
+
+func (wrapper *Wrapper) operation(builder *schemaBuilder, r *route) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		Summary:     r.summary,
+		Description: r.description,
+		Tags:        r.tags,
+		Responses:   map[string]*OpenAPIResponse{},
+	}
+
+	// 参数
+	declared := map[string]bool{}
+	if r.reqType != nil {
+		for _, param := range builder.parameters(r.reqType) {
+			declared[param.In+":"+param.Name] = true
+			op.Parameters = append(op.Parameters, param)
+		}
+		if body := builder.bodySchema(r.reqType); body != nil && r.method != http.MethodGet && r.method != http.MethodHead {
+			op.RequestBody = &OpenAPIRequestBody{
+				Content: map[string]*OpenAPIMediaType{jsonContentType: {Schema: body}},
+			}
+		}
+	}
+	for _, match := range ginParamRegexp.FindAllStringSubmatch(r.path, -1) {
+		if declared["path:"+match[1]] {
+			continue
+		}
+		op.Parameters = append(op.Parameters, &OpenAPIParameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   &OpenAPISchema{Type: "string"},
+		})
+	}
+	sort.SliceStable(op.Parameters, func(i, j int) bool {
+		return parameterOrder[op.Parameters[i].In] < parameterOrder[op.Parameters[j].In]
+	})
+
+	// 成功的返回
+	success := &OpenAPISchema{Ref: componentRef(schemaResponse)}
+	if r.respType != nil {
+		success = &OpenAPISchema{
+			AllOf: []*OpenAPISchema{
+				success,
+				{Type: "object", Properties: map[string]*OpenAPISchema{"data": builder.schemaOf(r.respType)}},
+			},
+		}
+	}
+	op.Responses["200"] = &OpenAPIResponse{
+		Description: "OK",
+		Content:     map[string]*OpenAPIMediaType{jsonContentType: {Schema: success}},
+	}
+
+	// 错误的返回，按映射后的HTTP状态码分组
+	op.Mcodes = append(op.Mcodes, r.mcodes...)
+	if r.reqType != nil {
+		op.Mcodes = append(op.Mcodes, McodeBindFailed, McodeValidateFailed)
+	}
+	op.Mcodes = append(op.Mcodes, McodeAdmissionDenied)
+	op.Mcodes = uniqueStrings(op.Mcodes)
+
+	byStatus := map[int][]string{}
+	for _, mcode := range op.Mcodes {
+		status := wrapper.statusMapping.Status(code.NewMcode(mcode, ""), mcode, false)
+		byStatus[status] = append(byStatus[status], mcode)
+	}
+	for status, mcodes := range byStatus {
+		if status == http.StatusOK {
+			op.Responses["200"].Description = "OK, result=false with mcode in " + strings.Join(mcodes, ",")
+			continue
+		}
+		op.Responses[strconv.Itoa(status)] = &OpenAPIResponse{
+			Description: http.StatusText(status),
+			Content: map[string]*OpenAPIMediaType{jsonContentType: {Schema: &OpenAPISchema{
+				AllOf: []*OpenAPISchema{
+					{Ref: componentRef(schemaErrorResponse)},
+					{Type: "object", Properties: map[string]*OpenAPISchema{"mcode": {Type: "string", Enum: mcodes}}},
+				},
+			}}},
+		}
+	}
+
+	return op
+}
+
+var parameterOrder = map[string]int{"path": 0, "query": 1, "header": 2}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		unique = append(unique, value)
+	}
+	return unique
+}
+
+// schemaBuilder 通过反射生成结构的Schema，具名的结构放到components中
+type schemaBuilder struct {
+	schemas map[string]*OpenAPISchema
+	types   map[string]reflect.Type
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{
+		schemas: map[string]*OpenAPISchema{},
+		types:   map[string]reflect.Type{},
+	}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage{})
+	parameterTags = []string{TagPath, TagQuery, TagHeader}
+)
+
+// reservedSchema 占用components中的名称，避免与业务结构重名
+type reservedSchema struct{}
+
+func (builder *schemaBuilder) reserve(name string, schema *OpenAPISchema) {
+	builder.schemas[name] = schema
+	builder.types[name] = reflect.TypeOf(reservedSchema{})
+}
+
+// schemaOf 类型对应的Schema
+func (builder *schemaBuilder) schemaOf(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &OpenAPISchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: builder.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: builder.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return builder.structSchema(t, false)
+		}
+		name := builder.componentName(t)
+		if _, exist := builder.schemas[name]; !exist {
+			// 先占位，避免自引用的结构无限递归
+			builder.schemas[name] = &OpenAPISchema{}
+			*builder.schemas[name] = *builder.structSchema(t, false)
+		}
+		return &OpenAPISchema{Ref: componentRef(name)}
+	}
+
+	return &OpenAPISchema{}
+}
+
+// componentName 结构在components中的名称，不同包的同名结构会加上包名
+func (builder *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if exist, ok := builder.types[name]; ok && exist != t {
+		pkg := t.PkgPath()
+		name = strings.ReplaceAll(pkg[strings.LastIndex(pkg, "/")+1:], ".", "_") + "_" + name
+	}
+	builder.types[name] = t
+	return name
+}
+
+// structSchema 结构的Schema，body为true时跳过路径参数，查询参数和请求头字段
+func (builder *schemaBuilder) structSchema(t reflect.Type, body bool) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	builder.addFields(schema, t, body)
+	return schema
+}
+
+func (builder *schemaBuilder) addFields(schema *OpenAPISchema, t reflect.Type, body bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		if body && isParameterField(field) {
+			continue
+		}
+
+		jsonTag := field.Tag.Get(TagBody)
+		name := strings.Split(jsonTag, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			builder.addFields(schema, fieldType, body)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldSchema := builder.schemaOf(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			if fieldSchema.Ref != "" {
+				fieldSchema = &OpenAPISchema{AllOf: []*OpenAPISchema{fieldSchema}}
+			}
+			fieldSchema.Description = description
+		}
+		schema.Properties[name] = fieldSchema
+		if isRequiredField(field) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// bodySchema 请求消息体的Schema，没有消息体字段时返回nil
+func (builder *schemaBuilder) bodySchema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return builder.schemaOf(t)
+	}
+
+	schema := builder.structSchema(t, true)
+	if len(schema.Properties) == 0 {
+		return nil
+	}
+	return schema
+}
+
+// parameters 请求结构中的路径参数，查询参数和请求头
+func (builder *schemaBuilder) parameters(t reflect.Type) []*OpenAPIParameter {
+	params := []*OpenAPIParameter{}
+	visited := map[reflect.Type]bool{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || visited[t] {
+			return
+		}
+		visited[t] = true
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			declared := false
+			for _, tag := range parameterTags {
+				name := strings.Split(field.Tag.Get(tag), ",")[0]
+				if name == "" || name == "-" {
+					continue
+				}
+				declared = true
+				params = append(params, &OpenAPIParameter{
+					Name:        name,
+					In:          tag,
+					Description: field.Tag.Get("description"),
+					Required:    tag == TagPath || isRequiredField(field),
+					Schema:      builder.schemaOf(field.Type),
+				})
+			}
+			if !declared && field.Tag.Get(TagBody) == "" {
+				walk(field.Type)
+			}
+		}
+	}
+	walk(t)
+
+	return params
+}
+
+func isParameterField(field reflect.StructField) bool {
+	if field.Tag.Get(TagBody) != "" {
+		return false
+	}
+	for _, tag := range parameterTags {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+func isRequiredField(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
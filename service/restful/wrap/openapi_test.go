@@ -0,0 +1,125 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/user", want: "/user"},
+		{path: "/user/:id", want: "/user/{id}"},
+		{path: "/user/:id/order/:orderId", want: "/user/{id}/order/{orderId}"},
+		{path: "/static/*filepath", want: "/static/{filepath}"},
+	}
+	for _, tt := range tests {
+		if got := openAPIPath(tt.path); got != tt.want {
+			t.Errorf("openAPIPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestWrapper_OpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{
+		Prefix:        "TEST",
+		StatusMapping: NewStatusMapping().Mcode("USER_NOT_FOUND", http.StatusNotFound),
+	})
+	r := gin.New()
+	v1 := r.Group("/v1")
+	Route(wrapper, "PUT", v1, "/user/:id", func(ctx context.Context, req *updateUserRequest) (*updateUserResponse, code.Error) {
+		return nil, nil
+	}, Summary("Update user"), Tags("user"), Mcodes("USER_NOT_FOUND", "USER_LOCKED"))
+	wrapper.Get(v1, "/order/:id", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	})
+	wrapper.Get(v1, "/internal", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return nil, nil
+	}, Hidden())
+	wrapper.ServeOpenAPI(r, "", OpenAPIInfo{Title: "test", Version: "1.0.0"})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", DefaultOpenAPIPath, nil)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d", DefaultOpenAPIPath, w.Code)
+	}
+	var doc OpenAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("bad document %v", err)
+	}
+
+	if _, exist := doc.Paths["/v1/internal"]; exist {
+		t.Errorf("hidden route should not be documented")
+	}
+	order := doc.Paths["/v1/order/{id}"]["get"]
+	if order == nil || len(order.Parameters) != 1 || order.Parameters[0].Name != "id" || order.Parameters[0].In != "path" {
+		t.Errorf("untyped route parameters = %+v", order)
+	}
+
+	op := doc.Paths["/v1/user/{id}"]["put"]
+	if op == nil {
+		t.Fatalf("route not documented,paths=%v", doc.Paths)
+	}
+	if op.Summary != "Update user" || !reflect.DeepEqual(op.Tags, []string{"user"}) {
+		t.Errorf("summary = %q,tags = %v", op.Summary, op.Tags)
+	}
+
+	params := map[string]string{}
+	for _, param := range op.Parameters {
+		params[param.In+":"+param.Name] = param.Schema.Type
+	}
+	wantParams := map[string]string{"path:id": "integer", "query:force": "boolean", "header:X-Service-Name": "string"}
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("parameters = %v, want %v", params, wantParams)
+	}
+
+	body := op.RequestBody.Content[jsonContentType].Schema
+	if len(body.Properties) != 2 || body.Properties["name"].Type != "string" || !reflect.DeepEqual(body.Required, []string{"name"}) {
+		t.Errorf("request body = %+v", body)
+	}
+
+	data := op.Responses["200"].Content[jsonContentType].Schema.AllOf[1].Properties["data"]
+	if data.Ref != componentRef("updateUserResponse") || doc.Components.Schemas["updateUserResponse"] == nil {
+		t.Errorf("response data = %+v", data)
+	}
+
+	wantMcodes := []string{"USER_NOT_FOUND", "USER_LOCKED", McodeBindFailed, McodeValidateFailed, McodeAdmissionDenied}
+	if !reflect.DeepEqual(op.Mcodes, wantMcodes) {
+		t.Errorf("mcodes = %v, want %v", op.Mcodes, wantMcodes)
+	}
+	notFound := op.Responses["404"]
+	if notFound == nil || !reflect.DeepEqual(notFound.Content[jsonContentType].Schema.AllOf[1].Properties["mcode"].Enum, []string{"USER_NOT_FOUND"}) {
+		t.Errorf("404 response = %+v", notFound)
+	}
+	if op.Responses["429"] == nil {
+		t.Errorf("429 response missing,responses=%v", op.Responses)
+	}
+}
+
+type treeNode struct {
+	Name     string      `json:"name"`
+	Children []*treeNode `json:"children"`
+}
+
+func TestSchemaBuilderRecursive(t *testing.T) {
+	builder := newSchemaBuilder()
+	schema := builder.schemaOf(reflect.TypeOf(&treeNode{}))
+	if schema.Ref != componentRef("treeNode") {
+		t.Fatalf("schemaOf() = %+v", schema)
+	}
+	children := builder.schemas["treeNode"].Properties["children"]
+	if children.Type != "array" || children.Items.Ref != componentRef("treeNode") {
+		t.Errorf("children = %+v", children)
+	}
+}
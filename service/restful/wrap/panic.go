@@ -0,0 +1,311 @@
+package wrap
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+)
+
+// MonitorCodePanic 业务函数panic时上报到监控的错误码，按接口统计panic的次数
+const MonitorCodePanic = "PANIC"
+
+// DefaultPanicDedupeWindow 默认相同堆栈的panic在该时间内只上报一次
+const DefaultPanicDedupeWindow = time.Minute
+
+// DefaultSensitiveHeaders 上报panic时脱敏的请求头
+var DefaultSensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Signature",
+}
+
+// DefaultSensitiveQuery 上报panic时脱敏的查询参数，不区分大小写
+var DefaultSensitiveQuery = []string{
+	"token",
+	"access_token",
+	"refresh_token",
+	"api_key",
+	"apikey",
+	"password",
+	"secret",
+	"signature",
+	"sign",
+}
+
+const redacted = "[REDACTED]"
+
+// PanicReport 一次panic的信息
+type PanicReport struct {
+	Time        time.Time   `json:"time"`
+	Service     string      `json:"service"`
+	Method      string      `json:"method"`
+	Route       string      `json:"route"` // 注册路径，比如/user/:id
+	Path        string      `json:"path"`
+	Query       string      `json:"query,omitempty"` // 敏感的查询参数已经脱敏
+	Header      http.Header `json:"header"`          // 敏感的请求头已经脱敏
+	ClientIP    string      `json:"client_ip"`
+	TracingId   string      `json:"tracing_id"`
+	RequestId   string      `json:"request_id"`
+	Error       string      `json:"error"` // panic的值
+	Stack       string      `json:"stack"`
+	Fingerprint string      `json:"fingerprint"` // 堆栈的指纹，相同位置的panic指纹相同
+	Suppressed  int         `json:"suppressed"`  // 上次上报之后被去重的相同panic的次数
+}
+
+// PanicReporter 上报panic，比如发送到告警系统，在请求的协程中同步调用，耗时的上报应当异步执行
+type PanicReporter interface {
+	ReportPanic(report *PanicReport)
+}
+
+// PanicReporterFunc 使用函数实现PanicReporter
+type PanicReporterFunc func(report *PanicReport)
+
+// ReportPanic 实现PanicReporter
+func (f PanicReporterFunc) ReportPanic(report *PanicReport) {
+	f(report)
+}
+
+// PanicOption panic上报的配置
+type PanicOption struct {
+	// Reporters 上报panic，相同堆栈的panic在DedupeWindow内只上报一次
+	Reporters []PanicReporter
+	// DedupeWindow 去重的时间窗口，默认1m，<0时不去重
+	DedupeWindow time.Duration
+	// DumpDir 崩溃信息的输出目录，每次上报写入一个JSON文件，为空时不写入
+	DumpDir string
+	// SensitiveHeaders 脱敏的请求头，默认DefaultSensitiveHeaders
+	SensitiveHeaders []string
+	// SensitiveQuery 脱敏的查询参数，默认DefaultSensitiveQuery
+	SensitiveQuery []string
+}
+
+// panicCapture 处理业务函数的panic：脱敏，去重，计数，上报和写入崩溃信息
+type panicCapture struct {
+	service   string
+	reporters []PanicReporter
+	window    time.Duration
+	dumpDir   string
+	sensitive map[string]bool
+	query     map[string]bool // 脱敏的查询参数，小写
+
+	mutex  sync.Mutex
+	seen   map[string]*panicSeen
+	counts map[string]int64 // 每个接口的panic次数，key为`METHOD ROUTE`
+}
+
+type panicSeen struct {
+	reported   time.Time
+	suppressed int
+}
+
+func newPanicCapture(service string, option *PanicOption) (*panicCapture, error) {
+	if option == nil {
+		option = &PanicOption{}
+	}
+	capture := &panicCapture{
+		service:   service,
+		reporters: option.Reporters,
+		window:    option.DedupeWindow,
+		dumpDir:   option.DumpDir,
+		sensitive: make(map[string]bool),
+		query:     make(map[string]bool),
+		seen:      make(map[string]*panicSeen),
+		counts:    make(map[string]int64),
+	}
+	if capture.window == 0 {
+		capture.window = DefaultPanicDedupeWindow
+	}
+	sensitive := option.SensitiveHeaders
+	if len(sensitive) == 0 {
+		sensitive = DefaultSensitiveHeaders
+	}
+	for _, header := range sensitive {
+		capture.sensitive[http.CanonicalHeaderKey(header)] = true
+	}
+	query := option.SensitiveQuery
+	if len(query) == 0 {
+		query = DefaultSensitiveQuery
+	}
+	for _, name := range query {
+		capture.query[strings.ToLower(name)] = true
+	}
+	if capture.dumpDir != "" {
+		if err := os.MkdirAll(capture.dumpDir, 0755); err != nil {
+			return nil, fmt.Errorf("create panic dump dir failed,%v", err)
+		}
+	}
+
+	return capture, nil
+}
+
+// capture 记录一次panic，被去重时reported为false
+func (capture *panicCapture) capture(httpCtx *gin.Context, registPath string, serviceCtx context.Context, value interface{}, stack []byte) (report *PanicReport, reported bool) {
+	request := httpCtx.Request
+	report = &PanicReport{
+		Time:        time.Now(),
+		Service:     capture.service,
+		Method:      request.Method,
+		Route:       registPath,
+		Path:        request.URL.Path,
+		Query:       capture.scrubQuery(request.URL.RawQuery),
+		Header:      capture.scrub(request.Header),
+		ClientIP:    httpCtx.ClientIP(),
+		TracingId:   serviceCtx.TracingId(),
+		RequestId:   serviceCtx.RequestId(),
+		Error:       fmt.Sprint(value),
+		Stack:       string(stack),
+		Fingerprint: stackFingerprint(stack),
+	}
+
+	report.Suppressed = capture.dedupe(report)
+	if report.Suppressed < 0 {
+		return report, false
+	}
+
+	for _, reporter := range capture.reporters {
+		capture.report(reporter, report)
+	}
+	if capture.dumpDir != "" {
+		if err := capture.dump(report); err != nil {
+			serviceCtx.WithError(err).Warn("Write panic dump failed")
+		}
+	}
+
+	return report, true
+}
+
+// dedupe 计数并去重，被去重时返回-1，否则返回上次上报之后被去重的次数
+func (capture *panicCapture) dedupe(report *PanicReport) int {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	capture.counts[report.Method+" "+report.Route]++
+	if capture.window < 0 {
+		return 0
+	}
+
+	seen, exist := capture.seen[report.Fingerprint]
+	if exist && report.Time.Sub(seen.reported) < capture.window {
+		seen.suppressed++
+		return -1
+	}
+	if !exist {
+		// 清理过期的记录，避免不同位置的panic不断累积
+		for fingerprint, s := range capture.seen {
+			if report.Time.Sub(s.reported) >= capture.window {
+				delete(capture.seen, fingerprint)
+			}
+		}
+		seen = &panicSeen{}
+		capture.seen[report.Fingerprint] = seen
+	}
+	suppressed := seen.suppressed
+	seen.reported, seen.suppressed = report.Time, 0
+	return suppressed
+}
+
+// report 调用上报，上报本身的panic不影响请求的返回
+func (capture *panicCapture) report(reporter PanicReporter, report *PanicReport) {
+	defer func() {
+		recover()
+	}()
+	reporter.ReportPanic(report)
+}
+
+// dump 写入崩溃信息，文件名为panic-时间-指纹.json
+func (capture *panicCapture) dump(report *PanicReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("panic-%s-%s.json", report.Time.Format("20060102T150405.000"), report.Fingerprint[:8])
+	return ioutil.WriteFile(filepath.Join(capture.dumpDir, name), b, 0644)
+}
+
+// scrub 复制请求头并替换敏感的值
+func (capture *panicCapture) scrub(header http.Header) http.Header {
+	scrubbed := make(http.Header, len(header))
+	for key, values := range header {
+		if capture.sensitive[http.CanonicalHeaderKey(key)] {
+			scrubbed[key] = []string{redacted}
+			continue
+		}
+		scrubbed[key] = append([]string(nil), values...)
+	}
+	return scrubbed
+}
+
+// scrubQuery 替换敏感的查询参数的值，保留原有的顺序和编码
+func (capture *panicCapture) scrubQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		rawName := param
+		if index := strings.IndexByte(param, '='); index >= 0 {
+			rawName = param[:index]
+		}
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if capture.query[strings.ToLower(name)] {
+			params[i] = rawName + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// snapshot 每个接口的panic次数
+func (capture *panicCapture) snapshot() map[string]int64 {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	counts := make(map[string]int64, len(capture.counts))
+	for route, count := range capture.counts {
+		counts[route] = count
+	}
+	return counts
+}
+
+// PanicCounts 进程启动以来每个接口的panic次数，key为`METHOD ROUTE`
+func (wrapper *Wrapper) PanicCounts() map[string]int64 {
+	return wrapper.panics.snapshot()
+}
+
+// stackFingerprint 计算堆栈的指纹，忽略协程编号，参数和指令偏移，只保留函数和文件行号
+func stackFingerprint(stack []byte) string {
+	h := sha1.New()
+	for _, line := range strings.Split(string(stack), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		if index := strings.Index(line, " in goroutine "); index > 0 {
+			line = line[:index]
+		} else if index := strings.LastIndex(line, " +0x"); index > 0 {
+			line = line[:index]
+		} else if index := strings.LastIndex(line, "("); index > 0 {
+			line = line[:index]
+		}
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
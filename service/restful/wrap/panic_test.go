@@ -0,0 +1,126 @@
+package wrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestPanicCapture(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	var reports []*PanicReport
+	logs := &bytes.Buffer{}
+	wrapper := New(&Option{
+		Prefix:        "TEST",
+		LogWriter:     logs,
+		StatusMapping: NewStatusMapping(),
+		Panic: &PanicOption{
+			Reporters: []PanicReporter{
+				PanicReporterFunc(func(report *PanicReport) { reports = append(reports, report) }),
+				PanicReporterFunc(func(report *PanicReport) { panic("reporter failed") }),
+			},
+			DumpDir: dir,
+		},
+	})
+	r := gin.New()
+	wrapper.Get(r, "/orders/:id", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		var m map[string]int
+		m[c.Param("id")] = 1
+		return nil, nil
+	})
+	wrapper.Get(r, "/users/:id", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		panic("user " + c.Param("id"))
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Trace", "abc")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for _, path := range []string{"/orders/1?Access_Token=abc&page=2", "/orders/2", "/orders/3", "/users/1"} {
+		if w := get(path); w.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s = %d, want 500", path, w.Code)
+		}
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("reported %d panics, want 2 after dedupe", len(reports))
+	}
+	report := reports[0]
+	if report.Route != "/orders/:id" || report.Path != "/orders/1" || report.RequestId == "" ||
+		!strings.Contains(report.Stack, "panic_test.go") || !strings.Contains(report.Error, "nil map") {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Header.Get("Authorization") != redacted || report.Header.Get("X-Trace") != "abc" {
+		t.Errorf("header = %v", report.Header)
+	}
+	if report.Query != "Access_Token="+redacted+"&page=2" {
+		t.Errorf("query = %s", report.Query)
+	}
+	if reports[1].Fingerprint == report.Fingerprint {
+		t.Errorf("different panics should have different fingerprints")
+	}
+
+	counts := wrapper.PanicCounts()
+	if counts["GET /orders/:id"] != 3 || counts["GET /users/:id"] != 1 {
+		t.Errorf("PanicCounts() = %v", counts)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "panic-*.json"))
+	if len(files) != 2 {
+		t.Fatalf("dump files = %v, want 2", files)
+	}
+	b, _ := ioutil.ReadFile(files[0])
+	var dumped PanicReport
+	if err := json.Unmarshal(b, &dumped); err != nil || dumped.Fingerprint == "" || dumped.Header.Get("Authorization") != redacted {
+		t.Errorf("dump = %s, %v", b, err)
+	}
+
+	if n := strings.Count(logs.String(), "stack="); n != 2 {
+		t.Errorf("stack logged %d times, want 2", n)
+	}
+}
+
+func TestPanicDumpFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := filepath.Join(t.TempDir(), "dump")
+	logs := &bytes.Buffer{}
+	wrapper := New(&Option{Prefix: "TEST", LogWriter: logs, Panic: &PanicOption{DumpDir: dir}})
+	r := gin.New()
+	wrapper.Get(r, "/", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		panic("failed")
+	})
+
+	// 目录被删除之后写入失败
+	os.RemoveAll(dir)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(logs.String(), "Write panic dump failed") {
+		t.Errorf("dump error should be logged, logs = %s", logs.String())
+	}
+}
+
+func TestStackFingerprint(t *testing.T) {
+	a := []byte("goroutine 7 [running]:\nmain.f(0xc000010000, 0x1)\n\t/src/main.go:10 +0x1d\ncreated by main.main in goroutine 1\n\t/src/main.go:20 +0x25\n")
+	b := []byte("goroutine 9 [running]:\nmain.f(0xc000020000, 0x2)\n\t/src/main.go:10 +0x1d\ncreated by main.main in goroutine 3\n\t/src/main.go:20 +0x25\n")
+	c := []byte("goroutine 9 [running]:\nmain.f(0xc000020000, 0x2)\n\t/src/main.go:11 +0x1d\n")
+	if stackFingerprint(a) != stackFingerprint(b) {
+		t.Errorf("stacks differ only in goroutine and arguments should have the same fingerprint")
+	}
+	if stackFingerprint(a) == stackFingerprint(c) {
+		t.Errorf("stacks at different lines should have different fingerprints")
+	}
+}
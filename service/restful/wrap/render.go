@@ -0,0 +1,211 @@
+package wrap
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// MIMEProtobuf 客户端在Accept中携带时，返回的data为proto.Message的接口使用protobuf编码
+const MIMEProtobuf = "application/x-protobuf"
+
+// MIMEProblemJSON RFC 7807的错误格式
+const MIMEProblemJSON = "application/problem+json"
+
+// McodeRenderFailed 返回无法编码
+const McodeRenderFailed = "RENDER_FAILED"
+
+// ResponseRenderer 将业务函数的结果写入HTTP返回
+type ResponseRenderer interface {
+	// Success 写入成功的返回，data可能为nil
+	Success(httpCtx *gin.Context, data interface{}, requestId string)
+	// Error 写入错误的返回，status为StatusMapping计算的状态码
+	Error(httpCtx *gin.Context, status int, cerr code.Error, mcode, requestId string)
+}
+
+// EnvelopeRenderer 默认的返回格式：{result,mcode,message,timestamp,request_id,data}，HTTP状态码由StatusMapping决定
+type EnvelopeRenderer struct{}
+
+func (EnvelopeRenderer) Success(httpCtx *gin.Context, data interface{}, requestId string) {
+	resp := map[string]interface{}{
+		"result":     true,
+		"timestamp":  time.Now().UnixNano() / int64(time.Millisecond),
+		"request_id": requestId,
+	}
+	if data != nil {
+		resp["data"] = data
+	}
+	httpCtx.JSON(http.StatusOK, resp)
+}
+
+func (EnvelopeRenderer) Error(httpCtx *gin.Context, status int, cerr code.Error, mcode, requestId string) {
+	httpCtx.JSON(status, errorResponse(cerr, mcode, requestId))
+}
+
+// RawRenderer 成功时直接返回data，没有data时返回204，错误时返回{mcode,message,request_id,errors,details}
+// 调用方只能通过状态码区分成功和失败，因此错误的状态码小于400时使用DefaultStatus
+type RawRenderer struct {
+	// DefaultStatus 错误的默认状态码，默认400
+	DefaultStatus int
+}
+
+func (renderer RawRenderer) Success(httpCtx *gin.Context, data interface{}, requestId string) {
+	if data == nil {
+		httpCtx.Status(http.StatusNoContent)
+		httpCtx.Writer.WriteHeaderNow()
+		return
+	}
+	httpCtx.JSON(http.StatusOK, data)
+}
+
+func (renderer RawRenderer) Error(httpCtx *gin.Context, status int, cerr code.Error, mcode, requestId string) {
+	resp := map[string]interface{}{
+		"mcode":      mcode,
+		"message":    cerr.Message(),
+		"request_id": requestId,
+	}
+	if fieldErrs := fieldErrorsOf(cerr); len(fieldErrs) != 0 {
+		resp["errors"] = fieldErrs
+	}
+	if details := code.DetailsOf(cerr); len(details) != 0 {
+		resp["details"] = details
+	}
+	httpCtx.JSON(errorStatus(status, renderer.DefaultStatus), resp)
+}
+
+// ProblemRenderer 错误使用RFC 7807的application/problem+json，成功时与RawRenderer相同直接返回data
+//
+//	{"type":"https://errors.example.com/USER_NOT_FOUND","title":"Not Found","status":404,
+//	 "detail":"user 1 not found","instance":"/v1/user/1","mcode":"USER_NOT_FOUND","request_id":"..."}
+type ProblemRenderer struct {
+	// TypeBase 问题类型的前缀，type为TypeBase+mcode，为空时type为about:blank
+	TypeBase string
+	// DefaultStatus 错误的默认状态码，StatusMapping返回的状态码小于400时使用，默认400
+	DefaultStatus int
+}
+
+func (renderer ProblemRenderer) Success(httpCtx *gin.Context, data interface{}, requestId string) {
+	RawRenderer{}.Success(httpCtx, data, requestId)
+}
+
+func (renderer ProblemRenderer) Error(httpCtx *gin.Context, status int, cerr code.Error, mcode, requestId string) {
+	status = errorStatus(status, renderer.DefaultStatus)
+	problemType := "about:blank"
+	if renderer.TypeBase != "" {
+		problemType = renderer.TypeBase + mcode
+	}
+	problem := map[string]interface{}{
+		"type":       problemType,
+		"title":      http.StatusText(status),
+		"status":     status,
+		"detail":     cerr.Message(),
+		"instance":   httpCtx.Request.URL.Path,
+		"mcode":      mcode,
+		"request_id": requestId,
+	}
+	if fieldErrs := fieldErrorsOf(cerr); len(fieldErrs) != 0 {
+		problem["errors"] = fieldErrs
+	}
+	if details := code.DetailsOf(cerr); len(details) != 0 {
+		problem["details"] = details
+	}
+	b, err := json.Marshal(problem)
+	if err != nil {
+		httpCtx.Error(err)
+		return
+	}
+	httpCtx.Data(status, MIMEProblemJSON+"; charset=utf-8", b)
+}
+
+// ProtobufRenderer data为proto.Message时使用protobuf编码返回data，其他返回使用Fallback
+// 错误使用google.protobuf.Struct编码，字段与默认的返回格式相同
+// 客户端的Accept中包含application/x-protobuf时，Wrapper自动使用该渲染
+type ProtobufRenderer struct {
+	Fallback ResponseRenderer
+}
+
+func (renderer ProtobufRenderer) Success(httpCtx *gin.Context, data interface{}, requestId string) {
+	message, ok := data.(proto.Message)
+	if !ok {
+		renderer.Fallback.Success(httpCtx, data, requestId)
+		return
+	}
+	b, err := proto.Marshal(message)
+	if err != nil {
+		httpCtx.Error(err)
+		renderer.Fallback.Error(httpCtx, http.StatusInternalServerError, code.NewMcodef(McodeRenderFailed, "marshal protobuf failed,%v", err), McodeRenderFailed, requestId)
+		return
+	}
+	httpCtx.Data(http.StatusOK, MIMEProtobuf, b)
+}
+
+func (renderer ProtobufRenderer) Error(httpCtx *gin.Context, status int, cerr code.Error, mcode, requestId string) {
+	resp := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"result":     {Kind: &structpb.Value_BoolValue{BoolValue: false}},
+		"mcode":      {Kind: &structpb.Value_StringValue{StringValue: mcode}},
+		"message":    {Kind: &structpb.Value_StringValue{StringValue: cerr.Message()}},
+		"timestamp":  {Kind: &structpb.Value_NumberValue{NumberValue: float64(time.Now().UnixNano() / int64(time.Millisecond))}},
+		"request_id": {Kind: &structpb.Value_StringValue{StringValue: requestId}},
+	}}
+	b, err := proto.Marshal(resp)
+	if err != nil {
+		renderer.Fallback.Error(httpCtx, status, cerr, mcode, requestId)
+		return
+	}
+	httpCtx.Data(status, MIMEProtobuf, b)
+}
+
+// Renderer 接口使用指定的返回格式，优先于Option.Renderer
+//
+//	wrapper.Get(r, "/raw/user/:id", getUser, wrap.Renderer(wrap.RawRenderer{}))
+func Renderer(renderer ResponseRenderer) RouteOption {
+	return func(r *route) {
+		r.renderer = renderer
+	}
+}
+
+// rendererOf 选择请求使用的返回格式：接口的配置优先，客户端接受protobuf时使用ProtobufRenderer
+func (wrapper *Wrapper) rendererOf(httpCtx *gin.Context, r *route) ResponseRenderer {
+	renderer := wrapper.renderer
+	if r.renderer != nil {
+		renderer = r.renderer
+	}
+	if acceptsProtobuf(httpCtx.Request) {
+		return ProtobufRenderer{Fallback: renderer}
+	}
+	return renderer
+}
+
+// acceptsProtobuf Accept中包含application/x-protobuf，并且没有被q=0排除
+func acceptsProtobuf(request *http.Request) bool {
+	accept := request.Header.Get("Accept")
+	if !strings.Contains(accept, MIMEProtobuf) {
+		return false
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != MIMEProtobuf {
+			continue
+		}
+		return params["q"] != "0" && params["q"] != "0.0"
+	}
+	return false
+}
+
+// errorStatus 错误的状态码小于400时使用defaultStatus
+func errorStatus(status, defaultStatus int) int {
+	if status >= http.StatusBadRequest {
+		return status
+	}
+	if defaultStatus == 0 {
+		return http.StatusBadRequest
+	}
+	return defaultStatus
+}
@@ -0,0 +1,169 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+	"github.com/lworkltd/kits/service/version"
+)
+
+func TestRenderer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{
+		Prefix:        "TEST",
+		StatusMapping: NewStatusMapping().Mcode("USER_NOT_FOUND", http.StatusNotFound),
+	})
+	r := gin.New()
+
+	getUser := func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		if c.Query("id") == "" {
+			return nil, code.NewMcode("USER_NOT_FOUND", "user not found")
+		}
+		if c.Query("id") == "nil" {
+			return nil, nil
+		}
+		return map[string]string{"id": c.Query("id")}, nil
+	}
+	wrapper.Get(r, "/envelope", getUser)
+	wrapper.Get(r, "/raw", getUser, Renderer(RawRenderer{}))
+	wrapper.Get(r, "/problem", getUser, Renderer(ProblemRenderer{TypeBase: "https://errors.example.com/"}))
+	wrapper.Get(r, "/business", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return nil, code.New(1001, "balance not enough")
+	}, Renderer(ProblemRenderer{}))
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		body        map[string]interface{}
+	}{
+		{
+			name:        "envelope success",
+			path:        "/envelope?id=1",
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body:        map[string]interface{}{"result": true, "data": map[string]interface{}{"id": "1"}},
+		},
+		{
+			name:        "envelope error",
+			path:        "/envelope",
+			status:      http.StatusNotFound,
+			contentType: "application/json; charset=utf-8",
+			body:        map[string]interface{}{"result": false, "mcode": "USER_NOT_FOUND"},
+		},
+		{
+			name:        "raw success",
+			path:        "/raw?id=1",
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body:        map[string]interface{}{"id": "1"},
+		},
+		{
+			name:   "raw no content",
+			path:   "/raw?id=nil",
+			status: http.StatusNoContent,
+		},
+		{
+			name:        "raw error",
+			path:        "/raw",
+			status:      http.StatusNotFound,
+			contentType: "application/json; charset=utf-8",
+			body:        map[string]interface{}{"mcode": "USER_NOT_FOUND", "message": "user not found"},
+		},
+		{
+			name:        "problem",
+			path:        "/problem",
+			status:      http.StatusNotFound,
+			contentType: "application/problem+json; charset=utf-8",
+			body: map[string]interface{}{
+				"type":     "https://errors.example.com/USER_NOT_FOUND",
+				"title":    "Not Found",
+				"status":   float64(http.StatusNotFound),
+				"detail":   "user not found",
+				"instance": "/problem",
+			},
+		},
+		{
+			name:        "problem default status",
+			path:        "/business",
+			status:      http.StatusBadRequest,
+			contentType: "application/problem+json; charset=utf-8",
+			body:        map[string]interface{}{"type": "about:blank", "mcode": "TEST_1001"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType {
+				t.Fatalf("status = %d, content type = %q, body %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			if tt.body == nil {
+				if w.Body.Len() != 0 {
+					t.Errorf("body = %s, want empty", w.Body.String())
+				}
+				return
+			}
+			got := map[string]interface{}{}
+			json.Unmarshal(w.Body.Bytes(), &got)
+			for k, v := range tt.body {
+				if b1, _ := json.Marshal(got[k]); string(b1) != mustMarshal(v) {
+					t.Errorf("%s = %s, want %s", k, b1, mustMarshal(v))
+				}
+			}
+		})
+	}
+}
+
+func TestRendererProtobuf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", Renderer: RawRenderer{}})
+	r := gin.New()
+	wrapper.Get(r, "/version", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		if c.Query("fail") != "" {
+			return nil, code.NewMcode("VERSION_UNKNOWN", "unknown")
+		}
+		return &version.VersionResponse{Name: "kits", Version: "1.0"}, nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/version", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/x-protobuf")
+	r.ServeHTTP(w, req)
+	got := &version.VersionResponse{}
+	if w.Header().Get("Content-Type") != MIMEProtobuf || proto.Unmarshal(w.Body.Bytes(), got) != nil || got.Version != "1.0" {
+		t.Errorf("protobuf success = %s %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/version?fail=1", nil)
+	req.Header.Set("Accept", MIMEProtobuf)
+	r.ServeHTTP(w, req)
+	errStruct := &structpb.Struct{}
+	if err := proto.Unmarshal(w.Body.Bytes(), errStruct); err != nil || errStruct.Fields["mcode"].GetStringValue() != "VERSION_UNKNOWN" {
+		t.Errorf("protobuf error = %v %v", errStruct, err)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/version", nil)
+	req.Header.Set("Accept", "application/x-protobuf;q=0, application/json")
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("q=0 should fall back to json, got %s", w.Header().Get("Content-Type"))
+	}
+}
+
+func mustMarshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -1,10 +1,13 @@
 package wrap
 
 type Response struct {
-	Result  bool        `json:"result"`
-	Mcode   string      `json:"mcode,omitempty"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
+	Result    bool                   `json:"result"`
+	Mcode     string                 `json:"mcode,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Data      interface{}            `json:"data,omitempty"`
+	Errors    []FieldError           `json:"errors,omitempty"`     // 参数校验失败时每个字段的错误
+	Details   map[string]interface{} `json:"details,omitempty"`    // 错误的附加信息
+	RequestId string                 `json:"request_id,omitempty"` // 请求ID，与返回头X-Request-Id相同
 }
 
 type HijackedResponse struct {
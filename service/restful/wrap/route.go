@@ -0,0 +1,146 @@
+package wrap
+
+import (
+	"reflect"
+
+	"github.com/lworkltd/kits/service/auth"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// route 注册的接口信息，用于文档生成和接口级别的配置
+type route struct {
+	method      string
+	path        string // 完整的注册路径，gin的格式，比如`/v1/user/:id`
+	summary     string
+	description string
+	tags        []string
+	mcodes      []string     // 接口声明的错误码
+	reqType     reflect.Type // 请求结构，可能为nil
+	respType    reflect.Type // 返回的data结构，可能为nil
+	hidden      bool         // 不出现在文档中
+
+	idempotency *idempotency     // 幂等，nil时不启用
+	cache       *responseCache   // 返回缓存，nil时不启用
+	renderer    ResponseRenderer // 返回格式，nil时使用Wrapper的配置
+
+	authenticator auth.Authenticator // 认证方式，nil时使用Wrapper的配置
+	anonymous     bool               // 允许匿名访问
+	scopes        []string           // 要求的全部scope
+	roles         []string           // 要求的任意role
+
+	maxBodySize int64 // 请求消息体的最大长度，0时使用Wrapper的配置
+}
+
+// RouteOption 接口级别的选项，在注册接口时传入
+//
+//	wrapper.Get(r, "/user/:id", getUser, wrap.Summary("Get user"), wrap.Mcodes("USER_NOT_FOUND"))
+type RouteOption func(*route)
+
+// Summary 接口的简要说明
+func Summary(summary string) RouteOption {
+	return func(r *route) {
+		r.summary = summary
+	}
+}
+
+// Description 接口的详细说明
+func Description(description string) RouteOption {
+	return func(r *route) {
+		r.description = description
+	}
+}
+
+// Tags 接口的分组
+func Tags(tags ...string) RouteOption {
+	return func(r *route) {
+		r.tags = append(r.tags, tags...)
+	}
+}
+
+// Mcodes 声明接口可能返回的错误码
+func Mcodes(mcodes ...string) RouteOption {
+	return func(r *route) {
+		r.mcodes = append(r.mcodes, mcodes...)
+	}
+}
+
+// Errors 声明接口可能返回的错误，与Mcodes相同，使用code.Define的声明
+//
+//	wrapper.Get(r, "/user/:id", getUser, wrap.Errors(ErrUserNotFound, ErrUserDisabled))
+func Errors(defs ...*code.Definition) RouteOption {
+	return func(r *route) {
+		for _, def := range defs {
+			r.mcodes = append(r.mcodes, def.Mcode)
+		}
+	}
+}
+
+// Hidden 接口不出现在文档中
+func Hidden() RouteOption {
+	return func(r *route) {
+		r.hidden = true
+	}
+}
+
+// Types 声明接口的请求结构和返回的data结构，参数为对应类型的值，可以为nil
+//
+//	wrap.Types(UpdateUserRequest{}, User{})
+func Types(req, resp interface{}) RouteOption {
+	return func(r *route) {
+		if req != nil {
+			r.reqType = reflect.TypeOf(req)
+		}
+		if resp != nil {
+			r.respType = reflect.TypeOf(resp)
+		}
+	}
+}
+
+// Typed 使用类型参数声明接口的请求结构和返回的data结构
+func Typed[Req any, Resp any]() RouteOption {
+	return func(r *route) {
+		r.reqType = reflect.TypeOf((*Req)(nil)).Elem()
+		r.respType = reflect.TypeOf((*Resp)(nil)).Elem()
+	}
+}
+
+// Route 使用强类型的业务函数注册接口，等同于
+//
+//	wrapper.Handle(method, srv, path, wrap.Handle(f), append(opts, wrap.Typed[Req, Resp]())...)
+func Route[Req any, Resp any](wrapper *Wrapper, method string, srv HttpServer, path string,
+	f func(ctx context.Context, req *Req) (*Resp, code.Error), opts ...RouteOption) {
+	wrapper.Handle(method, srv, path, Handle(f), append([]RouteOption{Typed[Req, Resp]()}, opts...)...)
+}
+
+// newRoute 创建接口信息
+func newRoute(method, path string, opts []RouteOption) *route {
+	r := &route{
+		method: method,
+		path:   path,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Routes 返回所有注册的接口，格式为`METHOD PATH`
+func (wrapper *Wrapper) Routes() []string {
+	wrapper.routesMutex.Lock()
+	defer wrapper.routesMutex.Unlock()
+
+	routes := make([]string, 0, len(wrapper.routes))
+	for _, r := range wrapper.routes {
+		routes = append(routes, r.method+" "+r.path)
+	}
+
+	return routes
+}
+
+func (wrapper *Wrapper) addRoute(r *route) {
+	wrapper.routesMutex.Lock()
+	defer wrapper.routesMutex.Unlock()
+	wrapper.routes = append(wrapper.routes, r)
+}
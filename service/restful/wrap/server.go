@@ -0,0 +1,366 @@
+package wrap
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/health"
+	"github.com/lworkltd/kits/service/profile"
+	"github.com/lworkltd/kits/service/version"
+	"github.com/sirupsen/logrus"
+)
+
+// 服务器默认的配置
+const (
+	DefaultPprofPathPrefix = "/debug/pprof"
+	DefaultVersionPath     = "/version"
+	DefaultHealthPath      = "/health"
+	DefaultShutdownTimeout = 15 * time.Second
+)
+
+// ServerOption 服务器的配置
+type ServerOption struct {
+	// Host 监听地址，比如":8080"
+	Host string
+	// PathPrefix 业务接口的前缀，Router()返回该前缀的路由组
+	PathPrefix string
+
+	// TLSCertFile,TLSKeyFile 同时配置时启用HTTPS
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// PprofEnabled 启用pprof，路径前缀默认/debug/pprof
+	PprofEnabled    bool
+	PprofPathPrefix string
+
+	// VersionPath 版本接口，默认/version，"-"表示不注册
+	VersionPath string
+	// HealthPath 健康检查接口，默认/health，同时注册{HealthPath}/live和{HealthPath}/ready，"-"表示不注册
+	HealthPath string
+	// Health 健康检查的注册中心，默认使用health.Default()
+	Health *health.Registry
+
+	// ShutdownTimeout 优雅退出时等待进行中请求的最长时间，默认15s
+	ShutdownTimeout time.Duration
+	// DrainDelay 就绪检查返回503之后，停止监听之前的等待时间，默认不等待
+	// 应大于负载均衡和服务发现摘除实例的时间，期间仍然正常处理新的请求；服务已经异常停止时不等待
+	DrainDelay time.Duration
+	// Signals 触发优雅退出的信号，默认SIGTERM和SIGINT
+	Signals []os.Signal
+
+	// Engine 使用已经创建好的gin.Engine，默认gin.New()并使用gin.Recovery()
+	Engine *gin.Engine
+	// ReadHeaderTimeout 读取请求头的超时，默认10s
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout 空闲连接的超时，默认120s
+	IdleTimeout time.Duration
+}
+
+// Server 持有gin.Engine的HTTP服务器，负责监听，内置接口和优雅退出
+//
+//	server := wrap.NewServerWithProfile(wrapper, &cfg.Service)
+//	wrapper.Get(server.Router(), "/user/:id", getUser)
+//	if err := server.Run(); err != nil {
+//		logrus.WithError(err).Fatal("server exit")
+//	}
+type Server struct {
+	wrapper *Wrapper
+	option  ServerOption
+	engine  *gin.Engine
+	router  *gin.RouterGroup
+	server  *http.Server
+
+	inFlight int64
+	draining int32
+
+	mutex    sync.Mutex
+	listener net.Listener
+	serveErr chan error
+	stopped  chan struct{} // 停止处理请求时关闭，比如监听的连接异常
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// NewServer 创建服务器
+func NewServer(wrapper *Wrapper, option *ServerOption) *Server {
+	opt := *option
+	if opt.PprofPathPrefix == "" {
+		opt.PprofPathPrefix = DefaultPprofPathPrefix
+	}
+	if opt.VersionPath == "" {
+		opt.VersionPath = DefaultVersionPath
+	}
+	if opt.HealthPath == "" {
+		opt.HealthPath = DefaultHealthPath
+	}
+	if opt.Health == nil {
+		opt.Health = health.Default()
+	}
+	if opt.ShutdownTimeout <= 0 {
+		opt.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if len(opt.Signals) == 0 {
+		opt.Signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+	if opt.ReadHeaderTimeout <= 0 {
+		opt.ReadHeaderTimeout = 10 * time.Second
+	}
+	if opt.IdleTimeout <= 0 {
+		opt.IdleTimeout = 120 * time.Second
+	}
+
+	engine := opt.Engine
+	if engine == nil {
+		engine = gin.New()
+		engine.Use(gin.Recovery())
+	}
+
+	s := &Server{
+		wrapper: wrapper,
+		option:  opt,
+		engine:  engine,
+	}
+	engine.Use(s.track)
+	s.router = engine.Group(strings.TrimRight(opt.PathPrefix, "/"))
+
+	if opt.PprofEnabled {
+		s.mountPprof(strings.TrimRight(opt.PprofPathPrefix, "/"))
+	}
+	if opt.VersionPath != "-" {
+		engine.GET(opt.VersionPath, func(httpCtx *gin.Context) {
+			httpCtx.JSON(http.StatusOK, version.GetVersionInfo())
+		})
+	}
+	if opt.HealthPath != "-" {
+		healthPath := strings.TrimRight(opt.HealthPath, "/")
+		engine.GET(healthPath, gin.WrapF(opt.Health.ReadyHandler()))
+		engine.GET(healthPath+"/ready", gin.WrapF(opt.Health.ReadyHandler()))
+		engine.GET(healthPath+"/live", gin.WrapF(opt.Health.LiveHandler()))
+	}
+
+	s.server = &http.Server{
+		Handler:           engine,
+		ReadHeaderTimeout: opt.ReadHeaderTimeout,
+		IdleTimeout:       opt.IdleTimeout,
+	}
+
+	return s
+}
+
+// NewServerWithProfile 使用服务配置创建服务器
+func NewServerWithProfile(wrapper *Wrapper, cfg *profile.Service) (*Server, error) {
+	shutdownTimeout := DefaultShutdownTimeout
+	if cfg.ShutdownTimeout != "" {
+		var err error
+		shutdownTimeout, err = time.ParseDuration(cfg.ShutdownTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("bad shutdown_timeout %s,%v", cfg.ShutdownTimeout, err)
+		}
+	}
+	var drainDelay time.Duration
+	if cfg.DrainDelay != "" {
+		var err error
+		drainDelay, err = time.ParseDuration(cfg.DrainDelay)
+		if err != nil {
+			return nil, fmt.Errorf("bad drain_delay %s,%v", cfg.DrainDelay, err)
+		}
+	}
+
+	return NewServer(wrapper, &ServerOption{
+		Host:            cfg.Host,
+		PathPrefix:      cfg.PathPrefix,
+		TLSCertFile:     cfg.TLSCertFile,
+		TLSKeyFile:      cfg.TLSKeyFile,
+		PprofEnabled:    cfg.PprofEnabled,
+		PprofPathPrefix: cfg.PprofPathPrefix,
+		ShutdownTimeout: shutdownTimeout,
+		DrainDelay:      drainDelay,
+	}), nil
+}
+
+// Engine 服务器使用的gin.Engine
+func (s *Server) Engine() *gin.Engine {
+	return s.engine
+}
+
+// Router 业务接口的路由组，前缀为PathPrefix
+func (s *Server) Router() *gin.RouterGroup {
+	return s.router
+}
+
+// Wrapper 服务器使用的Wrapper
+func (s *Server) Wrapper() *Wrapper {
+	return s.wrapper
+}
+
+// InFlight 正在处理的请求数
+func (s *Server) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// Draining 是否正在优雅退出
+func (s *Server) Draining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+// Addr 实际监听的地址，未启动时返回配置的地址
+func (s *Server) Addr() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.option.Host
+}
+
+// track 统计正在处理的请求
+func (s *Server) track(httpCtx *gin.Context) {
+	atomic.AddInt64(&s.inFlight, 1)
+	defer atomic.AddInt64(&s.inFlight, -1)
+	httpCtx.Next()
+}
+
+func (s *Server) mountPprof(prefix string) {
+	group := s.engine.Group(prefix)
+	group.GET("/", gin.WrapF(pprof.Index))
+	group.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	group.GET("/profile", gin.WrapF(pprof.Profile))
+	group.GET("/symbol", gin.WrapF(pprof.Symbol))
+	group.POST("/symbol", gin.WrapF(pprof.Symbol))
+	group.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		group.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
+
+// Start 开始监听并在后台处理请求，监听失败时返回错误
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.option.Host)
+	if err != nil {
+		return fmt.Errorf("listen %s failed,%v", s.option.Host, err)
+	}
+
+	s.mutex.Lock()
+	s.listener = listener
+	s.serveErr = make(chan error, 1)
+	s.stopped = make(chan struct{})
+	stopped := s.stopped
+	s.mutex.Unlock()
+
+	tls := s.option.TLSCertFile != "" && s.option.TLSKeyFile != ""
+	go func() {
+		var err error
+		if tls {
+			err = s.server.ServeTLS(listener, s.option.TLSCertFile, s.option.TLSKeyFile)
+		} else {
+			err = s.server.Serve(listener)
+		}
+		close(stopped)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		s.serveErr <- err
+	}()
+
+	s.logger().WithFields(logrus.Fields{
+		"addr": listener.Addr().String(),
+		"tls":  tls,
+	}).Info("HTTP server started")
+
+	return nil
+}
+
+// Shutdown 优雅退出：停止接受新的请求，等待进行中的请求完成，超过ctx的期限后强制关闭连接
+// 只有第一次调用生效，之后的调用等待第一次完成并返回相同的结果
+func (s *Server) Shutdown(ctx stdcontext.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown(ctx stdcontext.Context) error {
+	atomic.StoreInt32(&s.draining, 1)
+	// 就绪检查返回503，使负载均衡和服务发现尽快摘除本实例
+	s.option.Health.SetDraining(true)
+	s.logger().WithField("in_flight", s.InFlight()).Info("HTTP server shutting down")
+
+	// 等待摘除实例，期间仍然接受新的请求；未启动或已经停止处理请求时不需要等待
+	s.mutex.Lock()
+	stopped := s.stopped
+	s.mutex.Unlock()
+	if s.option.DrainDelay > 0 && stopped != nil {
+		timer := time.NewTimer(s.option.DrainDelay)
+		select {
+		case <-timer.C:
+		case <-stopped:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.server.Close()
+		err = fmt.Errorf("shutdown before all requests done,in flight %d,%v", s.InFlight(), err)
+	}
+
+	s.mutex.Lock()
+	serveErr := s.serveErr
+	s.mutex.Unlock()
+	if serveErr != nil {
+		if e := <-serveErr; e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Run 启动服务器并阻塞，收到退出信号后等待DrainDelay，然后在ShutdownTimeout内优雅退出
+func (s *Server) Run() error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, s.option.Signals...)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		s.logger().WithField("signal", sig.String()).Info("HTTP server received signal")
+	case err := <-s.serveErr:
+		// 服务异常退出，Shutdown不需要再等待
+		s.serveErr <- err
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), s.option.DrainDelay+s.option.ShutdownTimeout)
+	defer cancel()
+
+	return s.Shutdown(ctx)
+}
+
+func (s *Server) logger() logrus.FieldLogger {
+	if s.wrapper != nil {
+		return s.wrapper.Logger()
+	}
+	return logrus.StandardLogger()
+}
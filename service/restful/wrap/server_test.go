@@ -0,0 +1,180 @@
+package wrap
+
+import (
+	stdcontext "context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/health"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestServerBuiltinRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(New(&Option{Prefix: "TEST", LogWriter: io.Discard}), &ServerOption{
+		PathPrefix:   "/v1",
+		PprofEnabled: true,
+		Health:       health.NewRegistry(nil),
+	})
+	server.Wrapper().Get(server.Router(), "/ping", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return "pong", nil
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{path: "/v1/ping", status: http.StatusOK, body: "pong"},
+		{path: DefaultVersionPath, status: http.StatusOK, body: "golang"},
+		{path: DefaultHealthPath, status: http.StatusOK, body: "UP"},
+		{path: DefaultHealthPath + "/live", status: http.StatusOK, body: "UP"},
+		{path: DefaultHealthPath + "/ready", status: http.StatusOK, body: "UP"},
+		{path: DefaultPprofPathPrefix + "/", status: http.StatusOK, body: "goroutine"},
+		{path: DefaultPprofPathPrefix + "/goroutine?debug=1", status: http.StatusOK, body: "goroutine profile"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		server.Engine().ServeHTTP(w, req)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("GET %s = %d %s, want %d with %q", tt.path, w.Code, w.Body.String(), tt.status, tt.body)
+		}
+	}
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(New(&Option{Prefix: "TEST", LogWriter: io.Discard}), &ServerOption{Host: "127.0.0.1:0", Health: health.NewRegistry(nil)})
+	started := make(chan struct{})
+	server.Wrapper().Get(server.Router(), "/slow", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return "done", nil
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		rsp, err := http.Get("http://" + server.Addr() + "/slow")
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer rsp.Body.Close()
+		b, _ := io.ReadAll(rsp.Body)
+		result <- string(b)
+	}()
+
+	<-started
+	if server.InFlight() != 1 {
+		t.Errorf("InFlight() = %d, want 1", server.InFlight())
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("second Shutdown() error = %v", err)
+	}
+	if body := <-result; !strings.Contains(body, "done") {
+		t.Errorf("in flight request = %s", body)
+	}
+	if !server.Draining() || server.InFlight() != 0 {
+		t.Errorf("Draining() = %v,InFlight() = %d", server.Draining(), server.InFlight())
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", DefaultHealthPath+"/ready", nil)
+	server.Engine().ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ready status while draining = %d, want 503", w.Code)
+	}
+}
+
+func TestServerDrainDelay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := health.NewRegistry(nil)
+	server := NewServer(New(&Option{Prefix: "TEST", LogWriter: io.Discard}), &ServerOption{
+		Host:       "127.0.0.1:0",
+		Health:     registry,
+		DrainDelay: 200 * time.Millisecond,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	addr := server.Addr()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(stdcontext.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// 摘除期间就绪检查返回503，但仍然接受新的请求
+	rsp, err := http.Get("http://" + addr + DefaultHealthPath + "/ready")
+	if err != nil {
+		t.Fatalf("request during drain delay failed,%v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("ready status during drain delay = %d, want 503", rsp.StatusCode)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestServerDrainDelayAfterServeFailed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(New(&Option{Prefix: "TEST", LogWriter: io.Discard}), &ServerOption{
+		Host:       "127.0.0.1:0",
+		Health:     health.NewRegistry(nil),
+		DrainDelay: 10 * time.Second,
+	})
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// 监听的连接被关闭，Serve异常退出
+	server.listener.Close()
+
+	begin := time.Now()
+	if err := server.Shutdown(stdcontext.Background()); err == nil {
+		t.Errorf("Shutdown() should return the serve error")
+	}
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("Shutdown() waited %v after serve failed", elapsed)
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(New(&Option{Prefix: "TEST", LogWriter: io.Discard}), &ServerOption{Host: "127.0.0.1:0", Health: health.NewRegistry(nil)})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server.Engine().GET("/block", func(httpCtx *gin.Context) {
+		close(started)
+		<-release
+	})
+	defer close(release)
+	if err := server.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go http.Get("http://" + server.Addr() + "/block")
+	<-started
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err == nil {
+		t.Errorf("Shutdown() should fail when requests outlive the deadline")
+	}
+}
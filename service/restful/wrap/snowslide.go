@@ -7,7 +7,8 @@ import (
 	"github.com/lworkltd/kits/service/restful/code"
 )
 
-// SnowSlide 抑制过载
+// SnowSlide 抑制过载，固定一秒窗口，整个进程共享一个限制
+// Deprecated: Wrapper已使用Admission进行准入控制，请使用SlidingWindowLimiter或TokenBucketLimiter
 type SnowSlide struct {
 	curTime  int64
 	mutex    sync.Mutex
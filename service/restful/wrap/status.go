@@ -0,0 +1,95 @@
+package wrap
+
+import (
+	"net/http"
+
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+// CodeRange 错误码区间[From,To]对应的HTTP状态码
+type CodeRange struct {
+	From   int
+	To     int
+	Status int
+}
+
+// StatusMapping 错误返回时HTTP状态码的映射，返回的JSON结构保持不变
+// 匹配顺序为：Panic -> Mcodes -> code.Definition的Status -> Ranges -> Default
+type StatusMapping struct {
+	// Mcodes 按mcode映射，比如"SNOWSLIDE_DENIED":429
+	Mcodes map[string]int
+	// Ranges 按错误码区间映射，先匹配到的优先
+	Ranges []CodeRange
+	// Panic 业务函数发生非code.Error的panic时的状态码，默认500
+	Panic int
+	// Default 未匹配到的错误的状态码，默认200
+	Default int
+}
+
+// NewStatusMapping 创建一个包含常用映射的StatusMapping
+// 准入控制拒绝返回429，幂等冲突返回409，未认证返回401，没有权限返回403，请求过大返回413，panic返回500，其他错误仍然返回200
+func NewStatusMapping() *StatusMapping {
+	return &StatusMapping{
+		Mcodes: map[string]int{
+			McodeUnauthenticated:        http.StatusUnauthorized,
+			McodeForbidden:              http.StatusForbidden,
+			McodeAdmissionDenied:        http.StatusTooManyRequests,
+			McodeIdempotencyConflict:    http.StatusConflict,
+			McodeIdempotencyKeyReused:   http.StatusUnprocessableEntity,
+			McodeIdempotencyKeyMissing:  http.StatusBadRequest,
+			McodeIdempotencyUnavailable: http.StatusServiceUnavailable,
+			McodeRequestTooLarge:        http.StatusRequestEntityTooLarge,
+		},
+		Panic:   http.StatusInternalServerError,
+		Default: http.StatusOK,
+	}
+}
+
+// Mcode 设置mcode对应的状态码
+func (mapping *StatusMapping) Mcode(mcode string, status int) *StatusMapping {
+	if mapping.Mcodes == nil {
+		mapping.Mcodes = make(map[string]int, 4)
+	}
+	mapping.Mcodes[mcode] = status
+	return mapping
+}
+
+// Range 设置错误码区间[from,to]对应的状态码
+func (mapping *StatusMapping) Range(from, to int, status int) *StatusMapping {
+	mapping.Ranges = append(mapping.Ranges, CodeRange{From: from, To: to, Status: status})
+	return mapping
+}
+
+// Status 计算错误对应的HTTP状态码，mapping为nil时总是返回200
+func (mapping *StatusMapping) Status(cerr code.Error, mcode string, panicked bool) int {
+	if mapping == nil || cerr == nil {
+		return http.StatusOK
+	}
+
+	if panicked {
+		if mapping.Panic != 0 {
+			return mapping.Panic
+		}
+		return http.StatusInternalServerError
+	}
+
+	if status, exist := mapping.Mcodes[mcode]; exist {
+		return status
+	}
+
+	if def := code.DefinitionOf(cerr); def != nil && def.Status != 0 {
+		return def.Status
+	}
+
+	for _, r := range mapping.Ranges {
+		if cerr.Code() >= r.From && cerr.Code() <= r.To {
+			return r.Status
+		}
+	}
+
+	if mapping.Default != 0 {
+		return mapping.Default
+	}
+
+	return http.StatusOK
+}
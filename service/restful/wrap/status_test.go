@@ -0,0 +1,86 @@
+package wrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestStatusMapping_Status(t *testing.T) {
+	mapping := NewStatusMapping().
+		Mcode("USER_NOT_FOUND", http.StatusNotFound).
+		Range(400000, 499999, http.StatusBadRequest).
+		Range(500000, 599999, http.StatusServiceUnavailable)
+	conflict := code.NewRegistry("STATUS_TEST").Define(code.Definition{Code: 400002, Message: "conflict", Status: http.StatusConflict})
+
+	tests := []struct {
+		name     string
+		mapping  *StatusMapping
+		cerr     code.Error
+		mcode    string
+		panicked bool
+		want     int
+	}{
+		{name: "nil mapping", cerr: code.New(400001, "bad"), mcode: "P_400001", want: http.StatusOK},
+		{name: "no error", mapping: mapping, want: http.StatusOK},
+		{name: "mcode", mapping: mapping, cerr: code.NewMcode("USER_NOT_FOUND", "not found"), mcode: "USER_NOT_FOUND", want: http.StatusNotFound},
+		{name: "denied", mapping: mapping, cerr: code.NewMcode(McodeAdmissionDenied, "denied"), mcode: McodeAdmissionDenied, want: http.StatusTooManyRequests},
+		{name: "definition", mapping: mapping, cerr: conflict.New(), mcode: conflict.Mcode, want: http.StatusConflict},
+		{name: "range", mapping: mapping, cerr: code.New(400001, "bad"), mcode: "P_400001", want: http.StatusBadRequest},
+		{name: "second range", mapping: mapping, cerr: code.New(500001, "busy"), mcode: "P_500001", want: http.StatusServiceUnavailable},
+		{name: "default", mapping: mapping, cerr: code.New(1, "business"), mcode: "P_1", want: http.StatusOK},
+		{name: "panic", mapping: mapping, cerr: code.New(100000000, "internal"), mcode: "P_100000000", panicked: true, want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.Status(tt.cerr, tt.mcode, tt.panicked); got != tt.want {
+				t.Errorf("StatusMapping.Status() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapStatusMapping(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{
+		Prefix:        "TEST",
+		StatusMapping: NewStatusMapping().Range(400000, 499999, http.StatusBadRequest),
+	})
+	r := gin.New()
+	wrapper.Get(r, "/panic", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		panic("boom")
+	})
+	wrapper.Get(r, "/bad", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return nil, code.New(400001, "bad request")
+	})
+	wrapper.Get(r, "/ok", func(context.Context, *gin.Context) (interface{}, code.Error) {
+		return "ok", nil
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		result bool
+	}{
+		{path: "/panic", status: http.StatusInternalServerError},
+		{path: "/bad", status: http.StatusBadRequest},
+		{path: "/ok", status: http.StatusOK, result: true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("GET %s status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+		var rsp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &rsp); err != nil || rsp.Result != tt.result {
+			t.Errorf("GET %s envelope changed,body=%s", tt.path, w.Body.String())
+		}
+	}
+}
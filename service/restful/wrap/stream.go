@@ -0,0 +1,250 @@
+package wrap
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/restful/code"
+	"github.com/sirupsen/logrus"
+)
+
+// McodeStreamFailed 流式返回的过程中出现了非code.Error的错误
+const McodeStreamFailed = "STREAM_FAILED"
+
+// StreamKind 流式返回的类型
+type StreamKind string
+
+const (
+	StreamSSE      StreamKind = "sse"      // text/event-stream
+	StreamNDJSON   StreamKind = "ndjson"   // 每行一个JSON
+	StreamDownload StreamKind = "download" // 分块传输的文件下载
+)
+
+// StreamFunc 写入流式返回，返回nil或者客户端断开时正常结束
+type StreamFunc func(w *StreamWriter) error
+
+// StreamResponse 业务函数返回的流式结果，Wrapper在释放准入控制之后写入，不再封装返回结构
+// 请求仍然会记录日志，访问日志和监控，耗时为整个流的时长
+//
+//	func watch(srvContext context.Context, httpCtx *gin.Context) (interface{}, code.Error) {
+//		return wrap.SSE(func(w *wrap.StreamWriter) error {
+//			for {
+//				select {
+//				case <-w.Context().Done():
+//					return nil
+//				case event := <-events:
+//					if err := w.Event("update", event); err != nil {
+//						return err
+//					}
+//				}
+//			}
+//		}), nil
+//	}
+type StreamResponse struct {
+	kind        StreamKind
+	contentType string
+	filename    string
+	fn          StreamFunc
+
+	writer *StreamWriter
+}
+
+// SSE 返回Server-Sent Events
+func SSE(fn StreamFunc) *StreamResponse {
+	return &StreamResponse{kind: StreamSSE, contentType: "text/event-stream", fn: fn}
+}
+
+// NDJSON 返回每行一个JSON的流，使用StreamWriter.Encode写入
+func NDJSON(fn StreamFunc) *StreamResponse {
+	return &StreamResponse{kind: StreamNDJSON, contentType: "application/x-ndjson", fn: fn}
+}
+
+// Download 返回分块传输的下载，contentType为空时使用application/octet-stream，filename不为空时作为附件下载
+func Download(contentType, filename string, fn StreamFunc) *StreamResponse {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &StreamResponse{kind: StreamDownload, contentType: contentType, filename: filename, fn: fn}
+}
+
+// DownloadReader 将reader的内容作为下载返回，reader实现io.Closer时在结束后关闭
+func DownloadReader(contentType, filename string, reader io.Reader) *StreamResponse {
+	return Download(contentType, filename, func(w *StreamWriter) error {
+		if closer, ok := reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		_, err := io.Copy(w, reader)
+		return err
+	})
+}
+
+// Kind 流式返回的类型
+func (stream *StreamResponse) Kind() StreamKind {
+	return stream.kind
+}
+
+// serve 写入返回头并执行fn，客户端断开不视为错误
+func (stream *StreamResponse) serve(httpCtx *gin.Context) code.Error {
+	header := httpCtx.Writer.Header()
+	header.Set("Content-Type", stream.contentType)
+	header.Del("Content-Length")
+	switch stream.kind {
+	case StreamSSE:
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		// 避免nginx缓冲事件
+		header.Set("X-Accel-Buffering", "no")
+	case StreamNDJSON:
+		header.Set("Cache-Control", "no-cache")
+	case StreamDownload:
+		if stream.filename != "" {
+			header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stream.filename}))
+		}
+	}
+	httpCtx.Status(http.StatusOK)
+	httpCtx.Writer.WriteHeaderNow()
+	httpCtx.Writer.Flush()
+
+	stream.writer = &StreamWriter{
+		ctx:    httpCtx.Request.Context(),
+		writer: httpCtx.Writer,
+	}
+	err := stream.fn(stream.writer)
+	if stream.writer.ctx.Err() != nil {
+		stream.writer.disconnected = true
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	if cerr, ok := err.(code.Error); ok {
+		return cerr
+	}
+
+	return code.NewMcodef(McodeStreamFailed, "stream failed,%v", err)
+}
+
+// logFields 流式返回的日志字段
+func (stream *StreamResponse) logFields() logrus.Fields {
+	fields := logrus.Fields{"stream": stream.kind}
+	if stream.writer != nil {
+		fields["bytes"] = stream.writer.bytes
+		fields["messages"] = stream.writer.messages
+		fields["disconnected"] = stream.writer.disconnected
+	}
+	return fields
+}
+
+// ErrStreamClosed 客户端已经断开
+var ErrStreamClosed = errors.New("stream closed by client")
+
+// StreamWriter 流式返回的写入，不支持并发调用
+type StreamWriter struct {
+	ctx    stdcontext.Context
+	writer gin.ResponseWriter
+
+	bytes        int64
+	messages     int64
+	disconnected bool
+}
+
+// Context 客户端断开时被取消
+func (w *StreamWriter) Context() stdcontext.Context {
+	return w.ctx
+}
+
+// Write 写入原始的数据，不会立即发送，需要时调用Flush
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if w.ctx.Err() != nil {
+		return 0, ErrStreamClosed
+	}
+	n, err := w.writer.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush 立即发送已经写入的数据
+func (w *StreamWriter) Flush() {
+	w.writer.Flush()
+}
+
+// Event 发送一个SSE事件，name为空时使用默认的message事件，data为string或[]byte时原样发送，否则序列化为JSON
+func (w *StreamWriter) Event(name string, data interface{}) error {
+	return w.EventWithId("", name, data)
+}
+
+// EventWithId 发送一个带有id的SSE事件，客户端重连时会通过Last-Event-ID带回最后收到的id
+func (w *StreamWriter) EventWithId(id, name string, data interface{}) error {
+	var payload string
+	switch d := data.(type) {
+	case string:
+		payload = d
+	case []byte:
+		payload = string(d)
+	default:
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(b)
+	}
+
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", sanitizeEventField(id))
+	}
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", sanitizeEventField(name))
+	}
+	for _, line := range strings.Split(payload, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", strings.TrimSuffix(line, "\r"))
+	}
+	b.WriteByte('\n')
+
+	return w.send(b.String())
+}
+
+// Comment 发送SSE注释，通常用于保持连接
+func (w *StreamWriter) Comment(text string) error {
+	return w.send(": " + sanitizeEventField(text) + "\n\n")
+}
+
+// Encode 写入一行JSON并立即发送，用于NDJSON
+func (w *StreamWriter) Encode(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.send(string(b) + "\n")
+}
+
+// Messages 已经发送的事件或JSON的数量
+func (w *StreamWriter) Messages() int64 {
+	return w.messages
+}
+
+// Bytes 已经写入的字节数
+func (w *StreamWriter) Bytes() int64 {
+	return w.bytes
+}
+
+func (w *StreamWriter) send(s string) error {
+	if _, err := io.WriteString(w, s); err != nil {
+		return err
+	}
+	w.messages++
+	w.Flush()
+	return nil
+}
+
+// sanitizeEventField 去掉换行，避免注入额外的字段
+func sanitizeEventField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,183 @@
+package wrap
+
+import (
+	"bufio"
+	"bytes"
+	stdcontext "context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/restful/code"
+)
+
+func TestStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: &buf})
+	r := gin.New()
+
+	wrapper.Get(r, "/sse", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return SSE(func(w *StreamWriter) error {
+			w.Comment("hello")
+			w.EventWithId("1", "update", map[string]int{"n": 1})
+			return w.Event("", "line1\nline2")
+		}), nil
+	})
+	wrapper.Get(r, "/ndjson", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return NDJSON(func(w *StreamWriter) error {
+			for i := 0; i < 3; i++ {
+				if err := w.Encode(map[string]int{"i": i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}), nil
+	})
+	wrapper.Get(r, "/download", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return DownloadReader("text/csv", "report.csv", strings.NewReader("a,b\n1,2\n")), nil
+	})
+	wrapper.Get(r, "/fail", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return NDJSON(func(w *StreamWriter) error {
+			w.Encode("partial")
+			return errors.New("upstream closed")
+		}), nil
+	})
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		header      string
+		body        string
+		log         string
+	}{
+		{
+			name:        "sse",
+			path:        "/sse",
+			contentType: "text/event-stream",
+			body:        ": hello\n\nid: 1\nevent: update\ndata: {\"n\":1}\n\ndata: line1\ndata: line2\n\n",
+			log:         `"messages":3`,
+		},
+		{
+			name:        "ndjson",
+			path:        "/ndjson",
+			contentType: "application/x-ndjson",
+			body:        "{\"i\":0}\n{\"i\":1}\n{\"i\":2}\n",
+			log:         `"stream":"ndjson"`,
+		},
+		{
+			name:        "download",
+			path:        "/download",
+			contentType: "text/csv",
+			header:      `attachment; filename=report.csv`,
+			body:        "a,b\n1,2\n",
+			log:         `"bytes":8`,
+		},
+		{
+			name:        "failed after started",
+			path:        "/fail",
+			contentType: "application/x-ndjson",
+			body:        "\"partial\"\n",
+			log:         McodeStreamFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+			}
+			if tt.header != "" && w.Header().Get("Content-Disposition") != tt.header {
+				t.Errorf("Content-Disposition = %s, want %s", w.Header().Get("Content-Disposition"), tt.header)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+			if !strings.Contains(buf.String(), tt.log) {
+				t.Errorf("log = %s, want %s", buf.String(), tt.log)
+			}
+		})
+	}
+}
+
+// lockedBuffer 日志在服务端的goroutine中写入
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestStreamClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	buf := &lockedBuffer{}
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: buf})
+	r := gin.New()
+
+	done := make(chan struct{})
+	wrapper.Get(r, "/events", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return SSE(func(w *StreamWriter) error {
+			defer close(done)
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-w.Context().Done():
+					return w.Context().Err()
+				case <-ticker.C:
+					if err := w.Event("tick", "1"); err != nil {
+						return err
+					}
+				}
+			}
+		}), nil
+	})
+
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	req, _ := http.NewRequest("GET", server.URL+"/events", nil)
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("request failed,%v", err)
+	}
+	line, _ := bufio.NewReader(rsp.Body).ReadString('\n')
+	if line != "event: tick\n" {
+		t.Errorf("first line = %q", line)
+	}
+	cancel()
+	rsp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stream not cancelled after client disconnected")
+	}
+	// 日志在流结束之后写入
+	time.Sleep(50 * time.Millisecond)
+	if log := buf.String(); !strings.Contains(log, `"disconnected":true`) || strings.Contains(log, "HTTP request failed") {
+		t.Errorf("log = %s", log)
+	}
+}
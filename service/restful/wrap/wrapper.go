@@ -7,7 +7,6 @@ import (
 
 	"sync"
 
-	"net/http"
 	"runtime/debug"
 	"time"
 
@@ -15,10 +14,13 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lworkltd/kits/service/auth"
 	"github.com/lworkltd/kits/service/context"
 	"github.com/lworkltd/kits/service/monitor"
+	"github.com/lworkltd/kits/service/profile"
 	"github.com/lworkltd/kits/service/restful/code"
 	logutils "github.com/lworkltd/kits/utils/log"
+	"github.com/opentracing/opentracing-go/ext"
 	"github.com/sirupsen/logrus"
 )
 
@@ -42,11 +44,37 @@ type Wrapper struct {
 	// 服务名称
 	serviceName string
 	// 服务ID
-	serviceId        string
-	serviceLogLevel  logrus.Level
-	serviceLogWriter io.Writer
+	serviceId string
+	// 所有请求共用的日志，每个请求使用携带Tracing Id的Entry
+	logger *logrus.Logger
 
-	snowSlide *SnowSlide
+	admission *Admission
+
+	statusMapping *StatusMapping
+
+	accessLog *AccessLogger
+
+	// 默认的返回格式
+	renderer ResponseRenderer
+
+	// 默认的认证方式，nil时不认证
+	authenticator auth.Authenticator
+
+	cors            *cors
+	preflights      map[string]bool // 已经注册了预检接口的路径
+	securityHeaders *SecurityHeaders
+	maxBodySize     int64
+	compression     *CompressionOption
+
+	// panic的上报和计数
+	panics *panicCapture
+
+	// 按语言的错误信息
+	messages *code.Catalog
+
+	// 注册的接口，用于生成接口文档
+	routes      []*route
+	routesMutex sync.Mutex
 
 	logFn func(entry *logrus.Entry, level logrus.Level, msg string)
 }
@@ -56,55 +84,132 @@ type Option struct {
 	Mode        string
 	LogLevel    string
 	LogFilePath string
-
-	// SnowSlideLimit 过载保护数，<=0 时，不受限，大于0时，限制秒内最大请求数
+	// LogFormat 日志格式，json或text，默认text，通常来自profile.Logger.Format
+	LogFormat string
+	// LogTimeFormat 日志的时间格式，默认01-02 15:04:05.999
+	LogTimeFormat string
+	// LogWriter 日志输出，优先于LogFilePath
+	LogWriter io.Writer
+	// Logger 使用已经配置好的日志，设置后LogLevel,LogFilePath,LogFormat等日志配置不再生效，会添加TracingLogHook
+	Logger *logrus.Logger
+
+	// SnowSlideLimit 过载保护数，<=0 时使用DefaultSnowSlideLimit，限制任意一秒内整个进程的最大请求数
+	// 设置了Admission或AdmissionRules时不再生效
 	SnowSlideLimit int32
+
+	// Admission 准入控制，优先于AdmissionRules
+	Admission *Admission
+	// AdmissionRules 准入控制的配置，通常来自profile.Service.Admission
+	AdmissionRules []profile.AdmissionRule
+
+	// StatusMapping 错误返回时的HTTP状态码映射，nil时总是返回200
+	// 可以使用NewStatusMapping()获得默认的映射：准入控制拒绝返回429，panic返回500
+	StatusMapping *StatusMapping
+
+	// AccessLog 访问日志，nil时不记录，可以使用NewAccessLoggerWithProfile根据服务配置创建
+	AccessLog *AccessLogger
+
+	// Renderer 返回格式，默认EnvelopeRenderer，可以使用wrap.Renderer为单个接口指定
+	Renderer ResponseRenderer
+
+	// Authenticator 认证方式，设置后所有接口都需要认证，可以使用wrap.Anonymous允许匿名访问
+	Authenticator auth.Authenticator
+
+	// CORS 跨域策略，nil时不处理跨域请求
+	CORS *CORSPolicy
+	// SecurityHeaders 所有返回都附带的安全头部，可以使用DefaultSecurityHeaders()
+	SecurityHeaders *SecurityHeaders
+	// MaxBodySize 请求消息体的最大长度，<=0时不限制，可以使用wrap.MaxBodySize为单个接口指定
+	MaxBodySize int64
+	// Compression 返回压缩，nil时不压缩
+	Compression *CompressionOption
+	// HTTP 以上四项的配置，通常来自profile.Service.HTTP，只填充未设置的项
+	HTTP *profile.HTTP
+
+	// Panic 业务函数panic时的上报，去重和崩溃信息，nil时只记录日志和计数
+	Panic *PanicOption
+
+	// Messages 按语言的错误信息，根据请求的Accept-Language替换返回的message，nil时不替换
+	Messages *code.Catalog
 }
 
 // New 创建一个新的wrapper
 func New(option *Option) *Wrapper {
-	// 设置日志输出IO流，若未配置使用os.Stderr
-	logWriter := os.Stderr
-	if "" != option.LogFilePath {
-		file, err := os.OpenFile(option.LogFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
-		if nil != err {
-			panic(fmt.Errorf("Open log file failed, err:%w, log file path:%v", err, option.LogFilePath))
-		} else {
-			logWriter = file
+	logger := option.Logger
+	if logger == nil {
+		var err error
+		logger, err = newLogger(option)
+		if err != nil {
+			panic(err)
 		}
 	}
-
-	// 设置日志等级，若未配置，使用logrus.InfoLevel
-	logLevel := logrus.InfoLevel
-	if option.LogLevel != "" {
-		logLevelParse, err := logrus.ParseLevel(option.LogLevel)
+	// Context的日志作为Span的事件
+	logutils.AddTracingLogHook(logger)
+
+	// 初始化准入控制，未配置时使用过载保护
+	admission := option.Admission
+	if admission == nil && len(option.AdmissionRules) != 0 {
+		var err error
+		admission, err = NewAdmissionWithProfile(option.Prefix, option.AdmissionRules)
 		if err != nil {
-			panic(fmt.Errorf("cannot parse logger level %s", option.LogLevel))
-		} else {
-			logLevel = logLevelParse
+			panic(fmt.Errorf("cannot create admission,%v", err))
+		}
+	}
+	if admission == nil {
+		if option.SnowSlideLimit <= 0 {
+			option.SnowSlideLimit = DefaultSnowSlideLimit
 		}
+		admission = NewAdmission(option.Prefix, &AdmissionRule{
+			Name:    "snowslide",
+			Key:     KeyGlobal,
+			Limiter: NewSlidingWindowLimiter(int(option.SnowSlideLimit), time.Second),
+		})
 	}
 
-	//  初始化过载保护
-	var snowSlide *SnowSlide
-	if option.SnowSlideLimit <= 0 {
-		option.SnowSlideLimit = DefaultSnowSlideLimit
+	if option.HTTP != nil {
+		if err := applyHTTPProfile(option, option.HTTP); err != nil {
+			panic(fmt.Errorf("cannot apply http profile,%v", err))
+		}
 	}
-	snowSlide = &SnowSlide{
-		LimitCnt: option.SnowSlideLimit,
-		Service:  option.Prefix,
+	var corsPolicy *cors
+	if option.CORS != nil {
+		var err error
+		if corsPolicy, err = newCORS(option.CORS); err != nil {
+			panic(err)
+		}
+	}
+
+	panics, err := newPanicCapture(option.Prefix, option.Panic)
+	if err != nil {
+		panic(err)
+	}
+
+	renderer := option.Renderer
+	if renderer == nil {
+		renderer = EnvelopeRenderer{}
 	}
 
 	w := &Wrapper{
-		mcodePrefix:      option.Prefix,
-		serviceLogLevel:  logLevel,
-		serviceLogWriter: logWriter,
+		mcodePrefix: option.Prefix,
+		logger:      logger,
 		pool: sync.Pool{
 			New: func() interface{} {
 				return new(Response)
 			},
 		},
-		snowSlide: snowSlide,
+		admission:     admission,
+		statusMapping: option.StatusMapping,
+		accessLog:     option.AccessLog,
+		renderer:      renderer,
+		authenticator: option.Authenticator,
+
+		cors:            corsPolicy,
+		preflights:      make(map[string]bool),
+		securityHeaders: option.SecurityHeaders,
+		maxBodySize:     option.MaxBodySize,
+		compression:     option.Compression,
+		panics:          panics,
+		messages:        option.Messages,
 		logFn: func(entry *logrus.Entry, level logrus.Level, msg string) {
 			entry.Log(level, msg)
 		},
@@ -120,8 +225,8 @@ type HttpServer interface {
 	Handle(string, string, ...gin.HandlerFunc) gin.IRoutes
 }
 
-// 上报处理请求结果到Monitor，registPath为注册路径
-func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTime time.Time, registPath string) {
+// 上报处理请求结果到Monitor，registPath为注册路径，extra为附加的维度
+func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTime time.Time, registPath string, extra map[string]string) {
 	if nil == httpCtx || false == monitor.EnableReportMonitor() {
 		return
 	}
@@ -141,6 +246,7 @@ func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTim
 		succCountReport.TName = monitor.GetCurrentServerName()
 		succCountReport.TIP = monitor.GetCurrentServerIP()
 		succCountReport.Infc = infc
+		succCountReport.Extra = extra
 		monitor.ReportReqSuccess(&succCountReport)
 
 		var succAvgTimeReport monitor.ReqSuccessAvgTimeDimension
@@ -149,6 +255,7 @@ func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTim
 		succAvgTimeReport.TName = monitor.GetCurrentServerName()
 		succAvgTimeReport.TIP = monitor.GetCurrentServerIP()
 		succAvgTimeReport.Infc = infc
+		succAvgTimeReport.Extra = extra
 		monitor.ReportSuccessAvgTime(&succAvgTimeReport, (timeNow.UnixNano()-beginTime.UnixNano())/1e3) //耗时单位为微秒
 	} else { //处理失败
 		var failedCountReport monitor.ReqFailedCountDimension
@@ -157,6 +264,7 @@ func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTim
 		failedCountReport.TIP = monitor.GetCurrentServerIP()
 		failedCountReport.Code = err.Mcode()
 		failedCountReport.Infc = infc
+		failedCountReport.Extra = extra
 		monitor.ReportReqFailed(&failedCountReport)
 
 		var failedAvgTimeReport monitor.ReqFailedAvgTimeDimension
@@ -165,56 +273,132 @@ func reportProcessResultToMonitor(err code.Error, httpCtx *gin.Context, beginTim
 		failedAvgTimeReport.TName = monitor.GetCurrentServerName()
 		failedAvgTimeReport.TIP = monitor.GetCurrentServerIP()
 		failedAvgTimeReport.Infc = infc
+		failedAvgTimeReport.Extra = extra
 		monitor.ReportFailedAvgTime(&failedAvgTimeReport, (timeNow.UnixNano()-beginTime.UnixNano())/1e3) //耗时单位为微秒
 	}
 }
 
+// tagServerSpan 设置服务端Span的路由，状态码和错误，认证的调用方作为peer.service
+func tagServerSpan(serviceCtx context.Context, httpCtx *gin.Context, registPath, mcode string, cerr code.Error) {
+	serviceCtx.SetTag(context.SpanTagHTTPRoute, registPath)
+	serviceCtx.SetTag(string(ext.HTTPStatusCode), uint16(httpCtx.Writer.Status()))
+	if principal := context.PrincipalFromContext(serviceCtx); principal != nil {
+		serviceCtx.SetTag(string(ext.PeerService), principal.Subject)
+	}
+	if cerr != nil {
+		serviceCtx.SetError(cerr)
+		serviceCtx.SetTag(context.SpanTagMcode, mcode)
+	}
+}
+
+// errorResponse 错误返回的结构，参数校验失败时附带每个字段的错误，错误的原因不返回给调用方
+func errorResponse(cerr code.Error, mcode, requestId string) map[string]interface{} {
+	resp := map[string]interface{}{
+		"result":     false,
+		"mcode":      mcode,
+		"message":    cerr.Message(),
+		"timestamp":  time.Now().UnixNano() / int64(time.Millisecond),
+		"request_id": requestId,
+	}
+	if fieldErrs := fieldErrorsOf(cerr); len(fieldErrs) != 0 {
+		resp["errors"] = fieldErrs
+	}
+	if details := code.DetailsOf(cerr); len(details) != 0 {
+		resp["details"] = details
+	}
+
+	return resp
+}
+
 // Wrap 为gin的回调接口增加了固定的返回值，当程序收到处理结果的时候会将返回值封装一层再发送到网络, registPath为注册路径
 func (wrapper *Wrapper) Wrap(f WrappedFunc, registPath string) gin.HandlerFunc {
+	return wrapper.wrap(f, &route{path: registPath})
+}
+
+// wrap 与Wrap相同，r中包含接口级别的选项
+func (wrapper *Wrapper) wrap(f WrappedFunc, r *route) gin.HandlerFunc {
+	registPath := r.path
 	return func(httpCtx *gin.Context) {
 		Prefix := wrapper.mcodePrefix // 错误码前缀
-		logger := logrus.New()
-		// 设置日志输出IO流
-		logger.Out = wrapper.serviceLogWriter
-		// 设置日志等级
-		logger.Level = wrapper.serviceLogLevel
-
-		// 设置日志格式,让附加的TAG放在最前面
-		formatter := &logutils.TextFormatter{
-			TimestampFormat: "01-02 15:04:05.999",
-		}
-		logger.Formatter = formatter
-		// 附加服务ID
-		logger.Hooks.Add(logutils.NewServiceTagHook(wrapper.serviceName, wrapper.serviceId, wrapper.mode))
-		// 附加日志文件行号
-		logger.Hooks.Add(logutils.NewFileLineHook(log.Lshortfile))
-		// 附加Tracing TAG
-		logger.Hooks.Add(logutils.NewTracingLogHook())
-		serviceCtx := context.FromHttpRequest(httpCtx.Request, logger)
+		// 使用共用的日志，Tracing Id在上下文创建之后写入
+		logEntry := logrus.NewEntry(wrapper.logger)
+		serviceCtx := context.FromHttpRequest(httpCtx.Request, logEntry)
 		defer serviceCtx.Finish()
-
-		// 附加Tracing Id
-		tracingHeader := http.Header{}
-		serviceCtx.Inject(tracingHeader)
-		logger.Hooks.Add(logutils.NewTracingTagHook(serviceCtx.TracingId()))
+		logEntry.Data[logutils.TracingTag] = serviceCtx.TracingId()
+		logEntry.Data[logutils.RequestIdTag] = serviceCtx.RequestId()
+		for k, v := range context.BaggageLogFields(serviceCtx) {
+			logEntry.Data[k] = v
+		}
+		httpCtx.Header(context.RequestIdHeader, serviceCtx.RequestId())
+		if wrapper.securityHeaders != nil {
+			wrapper.securityHeaders.apply(httpCtx)
+		}
+		if wrapper.cors != nil {
+			wrapper.cors.apply(httpCtx)
+		}
 
 		since := time.Now()
 		var (
-			data interface{}
-			cerr code.Error
+			data     interface{}
+			cerr     code.Error
+			mcode    string
+			panicked bool
 		)
+
+		// Span的结果在返回写入之后，Finish之前设置
+		defer func() {
+			tagServerSpan(serviceCtx, httpCtx, registPath, mcode, cerr)
+		}()
+
+		// 访问日志在返回写入之后记录
+		if wrapper.accessLog != nil {
+			body := &countingBody{ReadCloser: httpCtx.Request.Body}
+			if httpCtx.Request.Body != nil {
+				httpCtx.Request.Body = body
+			}
+			defer func() {
+				wrapper.logAccess(httpCtx, registPath, mcode, since, body.n, serviceCtx)
+			}()
+		}
+
+		// 压缩在访问日志之前结束，访问日志记录压缩后的长度
+		if wrapper.compression != nil {
+			if writer := wrapper.compression.newWriter(httpCtx); writer != nil {
+				httpCtx.Writer = writer
+				defer writer.close()
+			}
+		}
+
+		// 幂等的结果在返回写入之后保存
+		var idem *idempotentCall
+		defer func() {
+			if idem != nil {
+				idem.finish(httpCtx, data, cerr, panicked)
+			}
+		}()
+
 		defer func() {
 			// 拦截业务层的异常
 			if r := recover(); r != nil {
-				fmt.Println(r)
 				if codeErr, ok := r.(code.Error); ok {
 					cerr = codeErr
+					reportProcessResultToMonitor(cerr, httpCtx, since, registPath, context.BaggageMonitorTags(serviceCtx))
 				} else {
+					panicked = true
 					cerr = code.New(100000000, "Service internal error")
-					serviceCtx.WithFields(logrus.Fields{
-						"error": r,
-						"stack": string(debug.Stack()),
-					}).Errorln("Panic")
+					report, reported := wrapper.panics.capture(httpCtx, registPath, serviceCtx, r, debug.Stack())
+					fields := logrus.Fields{
+						"error":       r,
+						"fingerprint": report.Fingerprint,
+					}
+					// 相同的堆栈在去重窗口内只记录一次
+					if reported {
+						fields["stack"] = report.Stack
+						fields["suppressed"] = report.Suppressed
+					}
+					serviceCtx.WithFields(fields).Errorln("Panic")
+					// panic时不会执行到函数最后的上报，按接口统计panic的次数
+					reportProcessResultToMonitor(code.NewMcode(MonitorCodePanic, "panic"), httpCtx, since, registPath, context.BaggageMonitorTags(serviceCtx))
 				}
 			}
 
@@ -225,32 +409,28 @@ func (wrapper *Wrapper) Wrap(f WrappedFunc, registPath string) gin.HandlerFunc {
 				"delay":  time.Since(since),
 			})
 
+			stream, streaming := data.(*StreamResponse)
+			if streaming {
+				l = l.WithFields(stream.logFields())
+			}
+
 			// 错误的返回
 			if cerr != nil {
-				if cerr.Mcode() != "" {
-					httpCtx.JSON(http.StatusOK, map[string]interface{}{
-						"result":    false,
-						"mcode":     cerr.Mcode(),
-						"message":   cerr.Message(),
-						"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
-					})
-
-					l = l.WithFields(logrus.Fields{
-						"mcode": cerr.Mcode(),
-					})
-				} else {
-					mcode := fmt.Sprintf("%s_%d", Prefix, cerr.Code())
-					httpCtx.JSON(http.StatusOK, map[string]interface{}{
-						"result":    false,
-						"mcode":     mcode,
-						"message":   cerr.Message(),
-						"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
-					})
-
-					l = l.WithFields(logrus.Fields{
-						"mcode": mcode,
-					})
+				mcode = cerr.Mcode()
+				if mcode == "" {
+					mcode = fmt.Sprintf("%s_%d", Prefix, cerr.Code())
+				}
+				// 流式返回已经开始时无法再写入错误的返回
+				if !streaming || !httpCtx.Writer.Written() {
+					status := wrapper.statusMapping.Status(cerr, mcode, panicked)
+					wrapper.rendererOf(httpCtx, r).Error(httpCtx, status, wrapper.localize(httpCtx, cerr, mcode), mcode, serviceCtx.RequestId())
 				}
+
+				l = l.WithFields(logrus.Fields{
+					"mcode": mcode,
+				})
+			} else if streaming {
+				// 流式返回已经写入，只记录日志
 			} else {
 				if data != nil {
 					switch data.(type) {
@@ -261,14 +441,7 @@ func (wrapper *Wrapper) Wrap(f WrappedFunc, registPath string) gin.HandlerFunc {
 					return
 				}
 
-				resp := map[string]interface{}{
-					"result":    true,
-					"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
-				}
-				if data != nil {
-					resp["data"] = data
-				}
-				httpCtx.JSON(http.StatusOK, resp)
+				wrapper.rendererOf(httpCtx, r).Success(httpCtx, data, serviceCtx.RequestId())
 			}
 
 			var level logrus.Level
@@ -278,9 +451,29 @@ func (wrapper *Wrapper) Wrap(f WrappedFunc, registPath string) gin.HandlerFunc {
 				l = l.WithFields(logrus.Fields{
 					"message": cerr.Message(),
 				})
+				// 错误的原因，附加信息和堆栈只记录在日志中
+				if chain := code.CauseChain(cerr); len(chain) != 0 {
+					l = l.WithField("cause", strings.Join(chain, " <- "))
+				}
+				if details := code.DetailsOf(cerr); len(details) != 0 {
+					l = l.WithField("details", details)
+				}
+				if stack := code.StackOf(cerr); stack != "" {
+					l = l.WithField("error_stack", stack)
+				}
+				if class := code.ClassOf(cerr); class != code.ClassUnknown {
+					l = l.WithFields(logrus.Fields{
+						"error_class": class,
+						"retryable":   code.IsRetryable(cerr),
+					})
+				}
 				msg = "HTTP request failed"
 				level = logrus.ErrorLevel
 			} else {
+				// 启用访问日志后，成功的请求只记录在访问日志中
+				if wrapper.accessLog != nil {
+					return
+				}
 				msg = "HTTP request done"
 				level = logrus.InfoLevel
 			}
@@ -288,51 +481,199 @@ func (wrapper *Wrapper) Wrap(f WrappedFunc, registPath string) gin.HandlerFunc {
 			wrapper.logFn(l, level, msg)
 		}()
 
-		// 过载保护
-		if wrapper.snowSlide != nil {
-			cerr = wrapper.snowSlide.Check()
-			if cerr == nil {
+		// 准入控制
+		release, cerr := wrapper.admission.Acquire(httpCtx, registPath)
+		if cerr == nil {
+			func() {
+				defer func() { release(time.Since(since)) }()
+				// 请求消息体的长度限制，需要在认证读取消息体之前
+				if cerr = wrapper.limitBody(httpCtx, r); cerr != nil {
+					return
+				}
+				// 认证，通过的调用方放在serviceCtx中
+				principal, authErr := wrapper.authenticate(httpCtx, r)
+				if principal != nil {
+					serviceCtx = context.WithPrincipal(serviceCtx, principal)
+					logEntry.Data["principal"] = principal.Subject
+				}
+				if authErr != nil {
+					cerr = authErr
+					return
+				}
+				// 幂等，重复的请求直接返回第一次的结果
+				if r.idempotency != nil {
+					if idem, cerr = r.idempotency.begin(serviceCtx, httpCtx, r); cerr != nil {
+						return
+					}
+					if idem.replayed {
+						data = Hijacked
+						return
+					}
+				}
+				// 缓存，命中时不执行业务函数
+				if r.cache != nil {
+					data, cerr = r.cache.do(serviceCtx, httpCtx, f)
+					return
+				}
 				data, cerr = f(serviceCtx, httpCtx)
-			}
-		} else {
-			data, cerr = f(serviceCtx, httpCtx)
+			}()
+		}
+
+		// 流式返回在释放准入控制之后写入，避免长连接一直占用并发
+		if stream, ok := data.(*StreamResponse); ok && cerr == nil {
+			cerr = stream.serve(httpCtx)
 		}
 
-		reportProcessResultToMonitor(cerr, httpCtx, since, registPath)
+		reportProcessResultToMonitor(cerr, httpCtx, since, registPath, context.BaggageMonitorTags(serviceCtx))
 	}
 }
 
-func (wrapper *Wrapper) Handle(method string, srv HttpServer, path string, f WrappedFunc) {
-	registPath := srv.(*gin.RouterGroup).BasePath() + path
-	srv.Handle(method, path, wrapper.Wrap(f, registPath))
+// logAccess 记录访问日志，成功的请求按比例采样
+func (wrapper *Wrapper) logAccess(httpCtx *gin.Context, registPath, mcode string, since time.Time, bytesIn int64, serviceCtx context.Context) {
+	if mcode == "" && !wrapper.accessLog.Sampled() {
+		return
+	}
+
+	bytesOut := httpCtx.Writer.Size()
+	if bytesOut < 0 {
+		bytesOut = 0
+	}
+	request := httpCtx.Request
+	wrapper.accessLog.Log(&AccessRecord{
+		Time:      since,
+		Method:    request.Method,
+		Proto:     request.Proto,
+		Path:      request.URL.Path,
+		Query:     request.URL.RawQuery,
+		Route:     registPath,
+		Status:    httpCtx.Writer.Status(),
+		Mcode:     mcode,
+		Latency:   time.Since(since),
+		BytesIn:   bytesIn,
+		BytesOut:  bytesOut,
+		ClientIP:  wrapper.accessLog.ClientIP(request),
+		UserAgent: request.UserAgent(),
+		Referer:   request.Referer(),
+		TraceId:   serviceCtx.TracingId(),
+		RequestId: serviceCtx.RequestId(),
+	})
+}
+
+// Handle 注册接口，opts为接口级别的选项，比如文档说明和声明的错误码
+func (wrapper *Wrapper) Handle(method string, srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	r := newRoute(method, registPath(srv, path), opts)
+	wrapper.checkAuth(r)
+	if wrapper.bodyLimitOf(r) > 0 {
+		r.mcodes = append(r.mcodes, McodeRequestTooLarge)
+	}
+	wrapper.addRoute(r)
+	srv.Handle(method, path, wrapper.wrap(f, r))
+	wrapper.registerPreflight(srv, method, path, r.path)
+}
+
+// registPath 计算接口的完整注册路径，srv可以是*gin.Engine或者*gin.RouterGroup
+func registPath(srv HttpServer, path string) string {
+	group, ok := srv.(interface{ BasePath() string })
+	if !ok {
+		return path
+	}
+	basePath := strings.TrimRight(group.BasePath(), "/")
+	if path == "" {
+		return basePath
+	}
+
+	return basePath + path
+}
+
+func (wrapper *Wrapper) Get(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("GET", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Get(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("GET", srv, path, f)
+func (wrapper *Wrapper) Patch(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("PATCH", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Patch(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("PATCH", srv, path, f)
+func (wrapper *Wrapper) Post(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("POST", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Post(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("POST", srv, path, f)
+func (wrapper *Wrapper) Put(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("PUT", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Put(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("PUT", srv, path, f)
+func (wrapper *Wrapper) Options(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("OPTIONS", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Options(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("OPTIONS", srv, path, f)
+func (wrapper *Wrapper) Head(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("HEAD", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Head(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("HEAD", srv, path, f)
+func (wrapper *Wrapper) Delete(srv HttpServer, path string, f WrappedFunc, opts ...RouteOption) {
+	wrapper.Handle("DELETE", srv, path, f, opts...)
 }
 
-func (wrapper *Wrapper) Delete(srv HttpServer, path string, f WrappedFunc) {
-	wrapper.Handle("DELETE", srv, path, f)
+// Logger 返回所有请求共用的日志
+func (wrapper *Wrapper) Logger() *logrus.Logger {
+	return wrapper.logger
+}
+
+// newLogger 根据配置创建所有请求共用的日志
+func newLogger(option *Option) (*logrus.Logger, error) {
+	// 设置日志输出IO流，若未配置使用os.Stderr
+	var logWriter io.Writer = os.Stderr
+	if option.LogWriter != nil {
+		logWriter = option.LogWriter
+	} else if "" != option.LogFilePath {
+		file, err := os.OpenFile(option.LogFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0660)
+		if nil != err {
+			return nil, fmt.Errorf("Open log file failed, err:%w, log file path:%v", err, option.LogFilePath)
+		}
+		logWriter = file
+	}
+
+	// 设置日志等级，若未配置，使用logrus.InfoLevel
+	logLevel := logrus.InfoLevel
+	if option.LogLevel != "" {
+		logLevelParse, err := logrus.ParseLevel(option.LogLevel)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse logger level %s", option.LogLevel)
+		}
+		logLevel = logLevelParse
+	}
+
+	timeFormat := option.LogTimeFormat
+	if timeFormat == "" {
+		timeFormat = "01-02 15:04:05.999"
+	}
+
+	// 设置日志格式,文本格式让附加的TAG放在最前面
+	var formatter logrus.Formatter
+	switch option.LogFormat {
+	case "text", "":
+		formatter = &logutils.TextFormatter{
+			TimestampFormat: timeFormat,
+		}
+	case "json":
+		formatter = &logutils.JSONFormatter{
+			TimestampFormat: timeFormat,
+		}
+	default:
+		return nil, fmt.Errorf("unsupport logrus formatter type %s", option.LogFormat)
+	}
+
+	logger := logrus.New()
+	logger.Out = logWriter
+	logger.Level = logLevel
+	logger.Formatter = formatter
+	// 附加服务ID
+	logger.Hooks.Add(logutils.NewServiceTagHook("", "", option.Mode))
+	// 附加日志文件行号
+	logger.Hooks.Add(logutils.NewFileLineHook(log.Lshortfile))
+	// 附加Tracing日志
+	logger.Hooks.Add(logutils.NewTracingLogHook())
+
+	return logger, nil
 }
 
 func (wrapper *Wrapper) SetLogger(logFn func(entry *logrus.Entry, level logrus.Level, msg string)) {
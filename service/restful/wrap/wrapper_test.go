@@ -1,11 +1,22 @@
 package wrap
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lworkltd/kits/service/context"
 	"github.com/lworkltd/kits/service/restful/code"
+	logutils "github.com/lworkltd/kits/utils/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 )
 
 func TestServer(t *testing.T) {
@@ -56,3 +67,183 @@ func TestServer(t *testing.T) {
 	wrapper.Head(v2, "/bar", bar)
 	wrapper.Delete(v2, "/bar", bar)
 }
+
+func TestWrapLogFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	wrapper := New(&Option{
+		Prefix:    "TEST",
+		LogFormat: "json",
+		LogWriter: &buf,
+	})
+	r := gin.New()
+	wrapper.Get(r, "/foo", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		srvContext.Infof("handle foo")
+		return "foo", nil
+	})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/foo", nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("want 4 log lines,got %d:%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("log line is not json,%s", line)
+		}
+		if tracing, _ := fields[logutils.TracingTag].(string); len(tracing) != 32 {
+			t.Errorf("log line without tracing tag,%s", line)
+		}
+		if fields[logutils.FilelineTag] == "" {
+			t.Errorf("log line without fileline,%s", line)
+		}
+	}
+
+	if _, err := newLogger(&Option{LogFormat: "xml"}); err == nil {
+		t.Errorf("newLogger() with unknown format should fail")
+	}
+}
+
+func TestWrapRequestId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: &buf})
+	r := gin.New()
+	wrapper.Get(r, "/foo", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		return srvContext.RequestId(), nil
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{name: "accept", incoming: "req-from-gateway"},
+		{name: "generate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/foo", nil)
+			if tt.incoming != "" {
+				req.Header.Set(context.RequestIdHeader, tt.incoming)
+			}
+			r.ServeHTTP(w, req)
+
+			requestId := w.Header().Get(context.RequestIdHeader)
+			if requestId == "" || tt.incoming != "" && requestId != tt.incoming {
+				t.Fatalf("response header request id = %q, incoming %q", requestId, tt.incoming)
+			}
+			var rsp Response
+			json.Unmarshal(w.Body.Bytes(), &rsp)
+			if rsp.RequestId != requestId || rsp.Data != requestId {
+				t.Errorf("envelope = %s, want request id %s", w.Body.String(), requestId)
+			}
+			if !strings.Contains(buf.String(), `"`+logutils.RequestIdTag+`":"`+requestId+`"`) {
+				t.Errorf("log = %s, want request id %s", buf.String(), requestId)
+			}
+		})
+	}
+}
+
+func TestWrapErrorDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: &buf})
+	r := gin.New()
+	wrapper.Get(r, "/transfer", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		cause := errors.New("dial tcp 10.0.0.1:3306: connection refused")
+		cerr := code.WrapMcode("TRANSFER_FAILED", cause, "transfer failed")
+		cerr = code.WithDetail(cerr, "retry_after", 3)
+		cerr = code.WithViolations(cerr, code.FieldViolation{Field: "amount", Rule: "max", Param: "100", Message: "too large"})
+		cerr = code.WithClass(cerr, code.ClassTransient)
+		return nil, code.WithStack(cerr)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/transfer", nil)
+	r.ServeHTTP(w, req)
+
+	var rsp Response
+	json.Unmarshal(w.Body.Bytes(), &rsp)
+	if rsp.Mcode != "TRANSFER_FAILED" || rsp.Details["retry_after"] != float64(3) || len(rsp.Errors) != 1 || rsp.Errors[0].Field != "amount" {
+		t.Errorf("response = %s", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "10.0.0.1") {
+		t.Errorf("cause should not be returned, got %s", w.Body.String())
+	}
+
+	var fields map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &fields)
+	if fields["cause"] != "dial tcp 10.0.0.1:3306: connection refused" || fields["details"] == nil ||
+		fields["error_class"] != "transient" || fields["retryable"] != true ||
+		!strings.Contains(fmt.Sprint(fields["error_stack"]), "TestWrapErrorDetails") {
+		t.Errorf("log = %s", buf.String())
+	}
+}
+
+func TestWrapTraceId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: &buf})
+	r := gin.New()
+	var traceId string
+	wrapper.Get(r, "/trace", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		traceId = srvContext.TracingId()
+		return nil, code.NewMcode("TRACE", "trace")
+	})
+
+	req, _ := http.NewRequest("GET", "/trace", nil)
+	req.Header.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var fields map[string]interface{}
+	json.Unmarshal(buf.Bytes(), &fields)
+	if traceId != "80f198ee56343ba864fe8b2a57d3eff7" || fields[logutils.TracingTag] != traceId {
+		t.Errorf("trace id = %s, log = %s", traceId, buf.String())
+	}
+}
+
+func TestWrapSpan(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	gin.SetMode(gin.TestMode)
+	wrapper := New(&Option{Prefix: "TEST", LogFormat: "json", LogWriter: ioutil.Discard})
+	r := gin.New()
+	wrapper.Get(r, "/users/:id", func(srvContext context.Context, c *gin.Context) (interface{}, code.Error) {
+		srvContext.Warn("user not found")
+		return nil, code.NewMcode("USER_NOT_FOUND", "user not found")
+	})
+
+	req, _ := http.NewRequest("GET", "/users/1", nil)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("finished spans = %d, want 1", len(spans))
+	}
+	tags := spans[0].Tags()
+	want := map[string]interface{}{
+		"http.method":      "GET",
+		"http.route":       "/users/:id",
+		"http.status_code": uint16(http.StatusOK),
+		"mcode":            "USER_NOT_FOUND",
+		"error":            true,
+		"error.message":    "user not found",
+	}
+	for k, v := range want {
+		if tags[k] != v {
+			t.Errorf("tag %s = %v, want %v", k, tags[k], v)
+		}
+	}
+	if len(spans[0].Logs()) == 0 {
+		t.Errorf("span logs is empty, want the context logs")
+	}
+}
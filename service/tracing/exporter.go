@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/lworkltd/kits/service/profile"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// DefaultOTLPEndpoint 本机OpenTelemetry Collector的OTLP/HTTP地址
+const DefaultOTLPEndpoint = "http://127.0.0.1:4318/v1/traces"
+
+// exportTimeout 上报请求的超时
+const exportTimeout = 10 * time.Second
+
+// NewOTLPExporter 使用OTLP/HTTP(protobuf编码)发送到OpenTelemetry Collector，endpoint为空时使用DefaultOTLPEndpoint
+//
+// endpoint为http时不使用TLS
+func NewOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	if endpoint == "" {
+		endpoint = DefaultOTLPEndpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("bad otlp endpoint %s", endpoint)
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithTimeout(exportTimeout),
+	}
+	if u.Path != "" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme != "https" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	if len(headers) != 0 {
+		options = append(options, otlptracehttp.WithHeaders(headers))
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
+
+// NewZipkinExporter 使用Zipkin v2的JSON格式发送，url比如http://127.0.0.1:9411/api/v2/spans
+func NewZipkinExporter(url string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	client := &http.Client{Timeout: exportTimeout}
+	if len(headers) != 0 {
+		client.Transport = &headerTransport{headers: headers, base: http.DefaultTransport}
+	}
+	return zipkin.New(url, zipkin.WithClient(client))
+}
+
+// headerTransport 为上报请求附加头部，比如认证信息
+type headerTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (transport *headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	for k, v := range transport.headers {
+		request.Header.Set(k, v)
+	}
+	return transport.base.RoundTrip(request)
+}
+
+// NewWriterExporter 每个Span写入一行JSON，用于本地调试，比如os.Stdout
+func NewWriterExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// NewFileExporter 每个Span追加一行JSON到文件，Shutdown时关闭文件
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open tracing file failed,%v", err)
+	}
+	exporter, err := NewWriterExporter(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileExporter{SpanExporter: exporter, file: file}, nil
+}
+
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (exporter *fileExporter) Shutdown(ctx context.Context) error {
+	err := exporter.SpanExporter.Shutdown(ctx)
+	if closeErr := exporter.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func exporterWithProfile(cfg *profile.Tracing) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "", "otlp":
+		return NewOTLPExporter(cfg.Endpoint, cfg.Headers)
+	case "zipkin":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("endpoint is required by zipkin exporter")
+		}
+		return NewZipkinExporter(cfg.Endpoint, cfg.Headers)
+	case "stdout":
+		return NewWriterExporter(os.Stdout)
+	case "file":
+		if cfg.File == "" {
+			return nil, fmt.Errorf("file is required by file exporter")
+		}
+		return NewFileExporter(cfg.File)
+	}
+	return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+}
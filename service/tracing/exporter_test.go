@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lworkltd/kits/service/profile"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// exportSpan 使用exporter上报一个client的Span
+func exportSpan(t *testing.T, exporter sdktrace.SpanExporter) {
+	provider, err := NewProvider(&Option{ServiceName: "order", Exporter: exporter})
+	if err != nil {
+		t.Fatalf("NewProvider() error = %v", err)
+	}
+	sp := provider.Tracer().StartSpan("GET /orders/:id", ext.SpanKindRPCClient)
+	ext.PeerService.Set(sp, "user")
+	ext.HTTPStatusCode.Set(sp, 500)
+	sp.Finish()
+	if err := provider.Shutdown(); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		path   string
+		header http.Header
+		body   []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, header = r.URL.Path, r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(server.URL+"/v1/traces", map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatalf("NewOTLPExporter() error = %v", err)
+	}
+	exportSpan(t, exporter)
+	if path != "/v1/traces" || header.Get("Authorization") != "Bearer token" || header.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("request %s, header = %v", path, header)
+	}
+	if !strings.Contains(string(body), "GET /orders/:id") || !strings.Contains(string(body), "order") {
+		t.Errorf("body = %q", body)
+	}
+
+	if _, err := NewOTLPExporter("127.0.0.1:4318", nil); err == nil {
+		t.Errorf("NewOTLPExporter() without scheme should fail")
+	}
+}
+
+func TestZipkinExporter(t *testing.T) {
+	var (
+		header http.Header
+		body   []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	exporter, err := NewZipkinExporter(server.URL+"/api/v2/spans", map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatalf("NewZipkinExporter() error = %v", err)
+	}
+	exportSpan(t, exporter)
+	if header.Get("Authorization") != "Bearer token" {
+		t.Errorf("header = %v", header)
+	}
+	var spans []struct {
+		Name          string `json:"name"`
+		Kind          string `json:"kind"`
+		LocalEndpoint struct {
+			ServiceName string `json:"serviceName"`
+		} `json:"localEndpoint"`
+		Tags map[string]string `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &spans); err != nil || len(spans) != 1 {
+		t.Fatalf("body = %s", body)
+	}
+	s := spans[0]
+	if s.Kind != "CLIENT" || s.LocalEndpoint.ServiceName != "order" || s.Tags["peer.service"] != "user" || s.Tags["http.status_code"] != "500" {
+		t.Errorf("span = %+v", s)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("NewFileExporter() error = %v", err)
+	}
+	exportSpan(t, exporter)
+	if err := exporter.Shutdown(context.Background()); err == nil {
+		t.Errorf("file should be closed by Shutdown()")
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	var data struct{ Name string }
+	if err := json.Unmarshal(b, &data); err != nil || data.Name != "GET /orders/:id" {
+		t.Errorf("file = %s", b)
+	}
+}
+
+func TestInitWithProfile(t *testing.T) {
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+
+	tests := []struct {
+		name    string
+		cfg     profile.Tracing
+		wantErr bool
+	}{
+		{name: "otlp", cfg: profile.Tracing{Enabled: true, Exporter: "otlp", Sampler: "ratio", SampleRatio: 0.1, ParentBased: true}},
+		{name: "file", cfg: profile.Tracing{Enabled: true, Exporter: "file", File: filepath.Join(t.TempDir(), "spans.json"), Sampler: "rate_limit", SampleRate: 10}},
+		{name: "zipkin without endpoint", cfg: profile.Tracing{Enabled: true, Exporter: "zipkin"}, wantErr: true},
+		{name: "unknown exporter", cfg: profile.Tracing{Enabled: true, Exporter: "jaeger"}, wantErr: true},
+		{name: "bad ratio", cfg: profile.Tracing{Enabled: true, Sampler: "ratio", SampleRatio: 2}, wantErr: true},
+		{name: "unknown propagator", cfg: profile.Tracing{Enabled: true, Propagators: []string{"jaeger"}}, wantErr: true},
+		{name: "bad flush interval", cfg: profile.Tracing{Enabled: true, FlushInterval: "5"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := InitWithProfile(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitWithProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if provider != nil {
+				if opentracing.GlobalTracer() != provider.Tracer() {
+					t.Errorf("global tracer is not set")
+				}
+				provider.Shutdown()
+			}
+		})
+	}
+
+	if provider, err := InitWithProfile(&profile.Tracing{}); provider != nil || err != nil {
+		t.Errorf("disabled InitWithProfile() = %v, %v", provider, err)
+	}
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	servicecontext "github.com/lworkltd/kits/service/context"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextPropagator 使用service/context的传递格式，由SetPropagators决定注入的头部
+//
+// 解析时依次尝试traceparent,b3和X-B3-*，与FromHttpRequest一致
+type contextPropagator struct{}
+
+func (contextPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	header := http.Header{}
+	servicecontext.InjectSpanContext(servicecontext.SpanContext{
+		TraceId:    sc.TraceID().String(),
+		SpanId:     sc.SpanID().String(),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+	}, header)
+	for k := range header {
+		carrier.Set(k, header.Get(k))
+	}
+}
+
+func (contextPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	header := http.Header{}
+	for _, k := range carrier.Keys() {
+		header.Set(k, carrier.Get(k))
+	}
+	sc, ok := servicecontext.ExtractSpanContext(header)
+	if !ok {
+		return ctx
+	}
+
+	// B3的64位Trace Id左侧补0
+	traceId, err := trace.TraceIDFromHex(strings.Repeat("0", 32-len(sc.TraceId)) + sc.TraceId)
+	if err != nil {
+		return ctx
+	}
+	spanId, err := trace.SpanIDFromHex(sc.SpanId)
+	if err != nil {
+		return ctx
+	}
+	config := trace.SpanContextConfig{
+		TraceID: traceId,
+		SpanID:  spanId,
+		Remote:  true,
+	}
+	if sc.Sampled {
+		config.TraceFlags = trace.FlagsSampled
+	}
+	if state, err := trace.ParseTraceState(sc.TraceState); err == nil {
+		config.TraceState = state
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(config))
+}
+
+func (contextPropagator) Fields() []string {
+	return []string{
+		servicecontext.TraceparentHeader,
+		servicecontext.TracestateHeader,
+		servicecontext.B3Header,
+		servicecontext.TraceIdHeader,
+		servicecontext.SpanIdHeader,
+		servicecontext.ParentSpanIdHeader,
+		servicecontext.SampledHeader,
+		servicecontext.FlagsHeader,
+	}
+}
+
+var _ propagation.TextMapPropagator = contextPropagator{}
@@ -0,0 +1,191 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	servicecontext "github.com/lworkltd/kits/service/context"
+	"github.com/lworkltd/kits/service/profile"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	otelbridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName OpenTelemetry中Tracer的名称
+const instrumentationName = "github.com/lworkltd/kits/service/tracing"
+
+// 批量上报的默认配置
+const (
+	DefaultBatchSize     = 512
+	DefaultQueueSize     = 2048
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// Option 调用链的配置
+type Option struct {
+	// ServiceName 上报的服务名，即资源的service.name
+	ServiceName string
+	// Exporter 上报结束的Span，必须设置
+	Exporter sdktrace.SpanExporter
+	// Sampler 采样，默认sdktrace.ParentBased(sdktrace.AlwaysSample())
+	Sampler sdktrace.Sampler
+	// BatchSize 每次上报的最大Span数，默认512
+	BatchSize int
+	// QueueSize 等待上报的最大Span数，超过时丢弃，默认2048
+	QueueSize int
+	// FlushInterval 上报的间隔，默认5s
+	FlushInterval time.Duration
+}
+
+// Provider 封装OpenTelemetry SDK的TracerProvider，Tracer()是OpenTracing的桥接
+//
+// 桥接使用service/context的传递格式，日志中的Tracing Id可以直接在Tracing后端中查询
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	bridge   *otelbridge.BridgeTracer
+	wrapper  *otelbridge.WrapperTracerProvider
+}
+
+// NewProvider 创建Provider，结束的Span由SDK在后台批量上报
+func NewProvider(option *Option) (*Provider, error) {
+	if option.Exporter == nil {
+		return nil, fmt.Errorf("tracing exporter is required")
+	}
+	sampler := option.Sampler
+	if sampler == nil {
+		sampler = sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+	batchSize := option.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	queueSize := option.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	if batchSize > queueSize {
+		batchSize = queueSize
+	}
+	flushInterval := option.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(option.Exporter,
+			sdktrace.WithMaxExportBatchSize(batchSize),
+			sdktrace.WithMaxQueueSize(queueSize),
+			sdktrace.WithBatchTimeout(flushInterval),
+		),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(option.ServiceName))),
+	)
+	bridge, wrapper := otelbridge.NewTracerPair(tp.Tracer(instrumentationName))
+	bridge.SetTextMapPropagator(contextPropagator{})
+	bridge.SetWarningHandler(func(message string) {
+		logrus.WithField("service", option.ServiceName).Warn(strings.TrimSpace(message))
+	})
+	return &Provider{provider: tp, bridge: bridge, wrapper: wrapper}, nil
+}
+
+// Tracer 返回OpenTracing的Tracer，现有的opentracing调用不需要修改
+func (provider *Provider) Tracer() opentracing.Tracer {
+	return provider.bridge
+}
+
+// TracerProvider 返回OpenTelemetry的TracerProvider，直接使用OpenTelemetry API创建的Span与OpenTracing的Span在同一个调用链中
+func (provider *Provider) TracerProvider() trace.TracerProvider {
+	return provider.wrapper
+}
+
+// Flush 立即上报队列中的Span并等待上报完成
+func (provider *Provider) Flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := provider.provider.ForceFlush(ctx); err != nil {
+		logrus.WithError(err).Warn("Flush tracing spans failed")
+	}
+}
+
+// Shutdown 上报剩余的Span并关闭Exporter，进程退出之前调用
+func (provider *Provider) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	return provider.provider.Shutdown(ctx)
+}
+
+// Init 创建Provider并设置为OpenTracing和OpenTelemetry的全局Tracer
+func Init(option *Option) (*Provider, error) {
+	provider, err := NewProvider(option)
+	if err != nil {
+		return nil, err
+	}
+	opentracing.SetGlobalTracer(provider.Tracer())
+	otel.SetTracerProvider(provider.TracerProvider())
+	otel.SetTextMapPropagator(contextPropagator{})
+	return provider, nil
+}
+
+// InitWithProfile 使用profile.Tracing初始化，未启用时返回nil
+func InitWithProfile(cfg *profile.Tracing) (*Provider, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var propagators []servicecontext.Propagator
+	for _, name := range cfg.Propagators {
+		propagator, err := servicecontext.PropagatorByName(name)
+		if err != nil {
+			return nil, err
+		}
+		propagators = append(propagators, propagator)
+	}
+
+	sampler, err := samplerWithProfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var flushInterval time.Duration
+	if cfg.FlushInterval != "" {
+		if flushInterval, err = time.ParseDuration(cfg.FlushInterval); err != nil {
+			return nil, fmt.Errorf("flush_interval %s is not a golang duration", cfg.FlushInterval)
+		}
+	}
+	exporter, err := exporterWithProfile(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(propagators) != 0 {
+		servicecontext.SetPropagators(propagators...)
+	}
+	return Init(&Option{
+		ServiceName:   cfg.ServiceName,
+		Exporter:      exporter,
+		Sampler:       sampler,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: flushInterval,
+	})
+}
+
+// InitWithZipkinProfile 使用profile.Zipkin的地址初始化，采样所有的调用链
+func InitWithZipkinProfile(serviceName string, cfg *profile.Zipkin) (*Provider, error) {
+	if cfg.Url == "" {
+		return nil, fmt.Errorf("zipkin url is empty")
+	}
+	exporter, err := NewZipkinExporter(cfg.Url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Init(&Option{
+		ServiceName: serviceName,
+		Exporter:    exporter,
+	})
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lworkltd/kits/service/profile"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RateLimitingSampler 每秒最多采样perSecond个调用链，OpenTelemetry的SDK中没有内置
+//
+// 通常与sdktrace.ParentBased一起使用，只对没有上游的调用链限速
+func RateLimitingSampler(perSecond float64) sdktrace.Sampler {
+	limiter := &rateLimiter{
+		rate:   perSecond,
+		burst:  perSecond,
+		tokens: perSecond,
+		last:   time.Now(),
+	}
+	if limiter.burst < 1 {
+		limiter.burst, limiter.tokens = 1, 1
+	}
+	return &rateLimitingSampler{perSecond: perSecond, limiter: limiter}
+}
+
+type rateLimitingSampler struct {
+	perSecond float64
+	limiter   *rateLimiter
+}
+
+func (sampler *rateLimitingSampler) ShouldSample(params sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if sampler.limiter.allow(time.Now()) {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(params.ParentContext).TraceState(),
+	}
+}
+
+func (sampler *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", sampler.perSecond)
+}
+
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (limiter *rateLimiter) allow(now time.Time) bool {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	if elapsed := now.Sub(limiter.last); elapsed > 0 {
+		limiter.tokens += elapsed.Seconds() * limiter.rate
+		if limiter.tokens > limiter.burst {
+			limiter.tokens = limiter.burst
+		}
+		limiter.last = now
+	}
+	if limiter.tokens < 1 {
+		return false
+	}
+	limiter.tokens--
+	return true
+}
+
+// samplerWithProfile 使用SDK的采样，parent_based时有上游的调用链使用上游的采样决定
+func samplerWithProfile(cfg *profile.Tracing) (sdktrace.Sampler, error) {
+	var sampler sdktrace.Sampler
+	switch cfg.Sampler {
+	case "", "always":
+		sampler = sdktrace.AlwaysSample()
+	case "never":
+		sampler = sdktrace.NeverSample()
+	case "ratio":
+		if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+			return nil, fmt.Errorf("sample_ratio %v is not between 0 and 1", cfg.SampleRatio)
+		}
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	case "rate_limit":
+		if cfg.SampleRate <= 0 {
+			return nil, fmt.Errorf("sample_rate is required by rate_limit sampler")
+		}
+		sampler = RateLimitingSampler(cfg.SampleRate)
+	default:
+		return nil, fmt.Errorf("unknown sampler %q", cfg.Sampler)
+	}
+	if cfg.ParentBased {
+		sampler = sdktrace.ParentBased(sampler)
+	}
+	return sampler, nil
+}
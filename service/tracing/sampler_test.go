@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lworkltd/kits/service/profile"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRateLimitingSampler(t *testing.T) {
+	sampler := RateLimitingSampler(2)
+	var decisions []sdktrace.SamplingDecision
+	for i := 0; i < 3; i++ {
+		decisions = append(decisions, sampler.ShouldSample(sdktrace.SamplingParameters{}).Decision)
+	}
+	want := []sdktrace.SamplingDecision{sdktrace.RecordAndSample, sdktrace.RecordAndSample, sdktrace.Drop}
+	for i := range want {
+		if decisions[i] != want[i] {
+			t.Errorf("ShouldSample() = %v, want %v", decisions, want)
+			break
+		}
+	}
+	if sampler.Description() != "RateLimitingSampler{2}" {
+		t.Errorf("Description() = %s", sampler.Description())
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := &rateLimiter{rate: 2, burst: 2, tokens: 2, last: now}
+	got := []bool{limiter.allow(now), limiter.allow(now), limiter.allow(now), limiter.allow(now.Add(500 * time.Millisecond))}
+	want := []bool{true, true, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("allow() = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestSamplerWithProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     profile.Tracing
+		want    string
+		wantErr bool
+	}{
+		{name: "always", cfg: profile.Tracing{}, want: "AlwaysOnSampler"},
+		{name: "ratio", cfg: profile.Tracing{Sampler: "ratio", SampleRatio: 0.5}, want: "TraceIDRatioBased{0.5}"},
+		{name: "parent based", cfg: profile.Tracing{Sampler: "never", ParentBased: true}, want: "ParentBased{root:AlwaysOffSampler"},
+		{name: "rate limit", cfg: profile.Tracing{Sampler: "rate_limit", SampleRate: 10}, want: "RateLimitingSampler{10}"},
+		{name: "bad ratio", cfg: profile.Tracing{Sampler: "ratio", SampleRatio: 2}, wantErr: true},
+		{name: "rate limit without rate", cfg: profile.Tracing{Sampler: "rate_limit"}, wantErr: true},
+		{name: "unknown", cfg: profile.Tracing{Sampler: "jaeger"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler, err := samplerWithProfile(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("samplerWithProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !strings.HasPrefix(sampler.Description(), tt.want) {
+				t.Errorf("samplerWithProfile() = %s, want %s", sampler.Description(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	servicecontext "github.com/lworkltd/kits/service/context"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracerWithContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := Init(&Option{ServiceName: "order", Exporter: exporter})
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	defer opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	defer provider.Shutdown()
+
+	request, _ := http.NewRequest("GET", "/orders", nil)
+	request.Header.Set(servicecontext.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := servicecontext.FromHttpRequest(request, nil)
+	sub := ctx.SubContext("db")
+	opentracing.SpanFromContext(sub).LogKV("event", "query", "rows", 3)
+	sub.SetError(errors.New("db busy"))
+	sub.Finish()
+	ctx.Finish()
+	provider.Flush()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	db, server := spans[0], spans[1]
+	if server.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.Parent.SpanID().String() != "00f067aa0ba902b7" ||
+		!server.Parent.IsRemote() || server.SpanKind != trace.SpanKindServer || server.Name != "http:/orders" {
+		t.Errorf("server span = %+v", server)
+	}
+	if service, ok := server.Resource.Set().Value("service.name"); !ok || service.AsString() != "order" {
+		t.Errorf("service.name = %v", service)
+	}
+	if ctx.TracingId() != server.SpanContext.TraceID().String() || ctx.SpanId() != server.SpanContext.SpanID().String() {
+		t.Errorf("context ids %s/%s differ from span %s", ctx.TracingId(), ctx.SpanId(), server.SpanContext.SpanID())
+	}
+	if db.Parent.SpanID() != server.SpanContext.SpanID() || sub.SpanId() != db.SpanContext.SpanID().String() ||
+		len(db.Events) != 1 || db.Status.Code != codes.Error {
+		t.Errorf("db span = %+v", db)
+	}
+
+	header := http.Header{}
+	sub.Inject(header)
+	if header.Get(servicecontext.TraceparentHeader) != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+db.SpanContext.SpanID().String()+"-01" {
+		t.Errorf("Inject() = %v", header)
+	}
+}
+
+func TestTracerSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, _ := NewProvider(&Option{Exporter: exporter, Sampler: sdktrace.ParentBased(sdktrace.NeverSample())})
+	defer provider.Shutdown()
+	tracer := provider.Tracer()
+
+	root := tracer.StartSpan("root")
+	child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()))
+	child.Finish()
+	root.Finish()
+
+	header := http.Header{}
+	if err := tracer.Inject(child.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {
+		t.Fatalf("Inject() error = %v", err)
+	}
+	if header.Get(servicecontext.SampledHeader) != "0" {
+		t.Errorf("unsampled span should be propagated, got %v", header)
+	}
+
+	header = http.Header{}
+	header.Set(servicecontext.TraceIdHeader, "463ac35c9f6413ad")
+	header.Set(servicecontext.SpanIdHeader, "a2fb4a1d1a96d312")
+	header.Set(servicecontext.SampledHeader, "1")
+	remote, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header))
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	server := tracer.StartSpan("server", ext.RPCServerOption(remote))
+	server.Finish()
+	provider.Flush()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "server" || spans[0].SpanContext.TraceID().String() != "0000000000000000463ac35c9f6413ad" {
+		t.Errorf("exported spans = %+v, want only the sampled remote child", spans)
+	}
+	if _, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(http.Header{})); err != opentracing.ErrSpanContextNotFound {
+		t.Errorf("Extract() without trace error = %v", err)
+	}
+}
+
+func TestProviderShutdown(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider, _ := NewProvider(&Option{Exporter: exporter, BatchSize: 1, QueueSize: 1})
+	tracer := provider.Tracer()
+
+	tracer.StartSpan("exported").Finish()
+	provider.Flush()
+	if spans := exporter.GetSpans(); len(spans) != 1 || spans[0].Name != "exported" {
+		t.Errorf("exported spans = %+v", spans)
+	}
+	if err := provider.Shutdown(); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	tracer.StartSpan("after shutdown").Finish()
+	provider.Flush()
+	if spans := exporter.GetSpans(); len(spans) != 0 {
+		t.Errorf("exported spans after Shutdown() = %+v", spans)
+	}
+	if _, err := NewProvider(&Option{}); err == nil {
+		t.Errorf("NewProvider() without exporter should fail")
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/lworkltd/kits/helper/consul"
 	"github.com/lworkltd/kits/service/discovery"
 	"github.com/lworkltd/kits/service/profile"
 	"github.com/sirupsen/logrus"
@@ -59,7 +58,8 @@ func RegisterServerWithProfile(checkUrl string, cfg *profile.Service) error {
 	if "" != checkUrl {
 		checkUrl = makeCheckUrl(cfg.ReportIp, port, checkUrl)
 	}
-	return discovery.Register(&consul.RegisterOption{
+	return discovery.Register(&discovery.Registration{
+		Protocol:      discovery.ProtocolHttp,
 		Ip:            cfg.ReportIp,
 		Port:          port,
 		CheckUrl:      checkUrl,
@@ -113,8 +113,8 @@ func RegisterGrpcServerWithProfile(serverOfHealthCheck string, cfg *profile.Serv
 	// Health format is `server[/serverOfHealthCheck]`
 	checkUrl := fmt.Sprintf("%s:%d/%s", cfg.ReportIp, port, serverOfHealthCheck)
 
-	return discovery.Register(&consul.RegisterOption{
-		ServerType:    consul.ServerTypeGrpc,
+	return discovery.Register(&discovery.Registration{
+		Protocol:      discovery.ProtocolGrpc,
 		Ip:            cfg.ReportIp,
 		Port:          port,
 		CheckUrl:      checkUrl,
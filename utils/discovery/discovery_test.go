@@ -3,7 +3,6 @@ package discovery
 import (
 	"testing"
 
-	"github.com/lworkltd/kits/helper/consul"
 	"github.com/lworkltd/kits/service/discovery"
 	"github.com/lworkltd/kits/service/profile"
 )
@@ -11,7 +10,7 @@ import (
 func init() {
 	discovery.Init(&discovery.Option{
 		SearchFunc:   func(string) ([]string, []string, error) { return nil, nil, nil },
-		RegisterFunc: func(*consul.RegisterOption) error { return nil },
+		RegisterFunc: func(*discovery.Registration) error { return nil },
 	})
 }
 func TestMakeCheckUrl(t *testing.T) {
@@ -2,15 +2,16 @@ package invoke
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/afex/hystrix-go/hystrix"
@@ -85,6 +86,8 @@ func reportDataToMonitor(error code.Error, rsp *http.Response) {
 
 // ExtractHeader 解析包中的错误码(该封装已经达成共识)
 // 即：{result:true,mcode:"<code>",data:{}}
+//
+// 返回的错误附带分类，调用方可以使用code.ClassOf和code.IsRetryable区分网络失败，熔断，非200和业务拒绝
 func ExtractHeader(name string, invokeErr error, statusCode int, res *Response, out interface{}) code.Error {
 	if statusCode == 0 {
 		// HTTP 调用过程出错
@@ -92,60 +95,72 @@ func ExtractHeader(name string, invokeErr error, statusCode int, res *Response,
 		if ok {
 			// 超时错误
 			if urlErr.Timeout() {
-				return code.NewMcode(MCODE_INVOKE_TIMEOUT, "http timeout")
+				return code.WithClass(code.NewMcode(MCODE_INVOKE_TIMEOUT, "http timeout"), code.ClassTimeout)
 			}
 
-			if netErr, ok := urlErr.Err.(net.Error); ok {
-				if netErr.Timeout() {
-					return code.NewMcode(MCODE_INVOKE_TIMEOUT, "network timeout")
-				}
+			if netErr, ok := urlErr.Err.(net.Error); ok && netErr.Timeout() {
+				return code.WithClass(code.NewMcode(MCODE_INVOKE_TIMEOUT, "network timeout"), code.ClassTimeout)
+			}
 
-				if netOpErr, ok := netErr.(*net.OpError); ok {
-					if netOpErr.Timeout() {
-						return code.NewMcode(MCODE_INVOKE_TIMEOUT, "network operation timeout")
-					}
-
-					if sysCallErr, ok := netOpErr.Err.(*os.SyscallError); ok {
-						if sysCallErr.Syscall == "connectx" {
-							return code.NewMcodef(MCODE_INVOKE_FAILED,
-								"connect failed,addr=%v", netOpErr.Addr.String())
-						}
-						return code.NewMcode(MCODE_INVOKE_FAILED, "invoke failed for net problem")
-					}
+			// 只有连接被拒绝和DNS临时失败可以重试，请求一定没有发出
+			if errors.Is(urlErr.Err, syscall.ECONNREFUSED) {
+				return code.WithClass(code.NewMcodef(MCODE_INVOKE_FAILED, "connect failed,%v", urlErr.Err), code.ClassTransient)
+			}
+			// 连接被重置时请求可能已经被处理，只有幂等的调用才可以由调用方自行重试
+			if errors.Is(urlErr.Err, syscall.ECONNRESET) {
+				return code.WithClass(code.NewMcodef(MCODE_INVOKE_FAILED, "connection reset,%v", urlErr.Err), code.ClassInternal)
+			}
+			var dnsErr *net.DNSError
+			if errors.As(urlErr.Err, &dnsErr) {
+				if dnsErr.IsTemporary {
+					return code.WithClass(code.NewMcodef(MCODE_INVOKE_FAILED, "dns lookup failed,%v", dnsErr), code.ClassTransient)
 				}
+				// 域名不存在，重试也不会成功
+				return code.WithClass(code.NewMcodef(MCODE_INVOKE_FAILED, "dns lookup failed,%v", dnsErr), code.ClassInvalid)
 			}
 
-			return code.NewMcodef(MCODE_INVOKE_FAILED, "invoke error,%v", urlErr)
+			// 其他网络错误，比如TLS握手失败
+			if _, ok := urlErr.Err.(net.Error); ok {
+				return code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, "invoke failed for net problem"), code.ClassInternal)
+			}
+
+			// 请求无法发出，比如不支持的协议，错误的地址
+			return code.WithClass(code.NewMcodef(MCODE_INVOKE_FAILED, "invoke error,%v", urlErr), code.ClassInvalid)
 		}
 
 		// 超时熔断
 		if invokeErr == hystrix.ErrTimeout {
-			return code.NewMcode(MCODE_INVOKE_TIMEOUT, invokeErr.Error())
+			return code.WithClass(code.NewMcode(MCODE_INVOKE_TIMEOUT, invokeErr.Error()), code.ClassTimeout)
 		}
 
 		// 熔断开启
 		if invokeErr == hystrix.ErrCircuitOpen {
-			return code.NewMcode(MCODE_INVOKE_FAILED, invokeErr.Error())
+			return code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, invokeErr.Error()), code.ClassUnavailable)
 		}
 
 		// 过载熔断
 		if invokeErr == hystrix.ErrMaxConcurrency {
-			return code.NewMcode(MCODE_INVOKE_FAILED, invokeErr.Error())
+			return code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, invokeErr.Error()), code.ClassUnavailable)
 		}
 
-		// 其他错误
-		return code.NewMcode(
+		// 其他错误，比如请求无法构造，重试也不会成功
+		return code.WithClass(code.NewMcode(
 			fmt.Sprintf(MCODE_INVOKE_FAILED),
 			invokeErr.Error(),
-		)
+		), code.ClassInternal)
 	}
 
 	// 返回状态出错
 	if statusCode != http.StatusOK {
-		return code.NewMcode(
+		class := code.ClassOfStatus(statusCode)
+		// 服务端开启了状态码映射时，错误仍然以标准结构返回
+		if res != nil && !res.Result && res.Code != "" {
+			return code.WithClass(code.NewMcode(res.Code, res.Message), class)
+		}
+		return code.WithClass(code.NewMcode(
 			MCODE_INVOKE_FAILED,
 			fmt.Sprintf("http status: %d", statusCode),
-		)
+		), class)
 	}
 
 	// 处理结果出错
@@ -154,7 +169,7 @@ func ExtractHeader(name string, invokeErr error, statusCode int, res *Response,
 		if mcode == "" {
 			mcode = MCODE_INVOKE_FAILED
 		}
-		return code.NewMcode(mcode, res.Message)
+		return code.WithClass(code.NewMcode(mcode, res.Message), code.ClassBusiness)
 	}
 
 	// 无需解析结果
@@ -164,10 +179,10 @@ func ExtractHeader(name string, invokeErr error, statusCode int, res *Response,
 
 	err := json.Unmarshal(res.Data, out)
 	if err != nil {
-		return code.NewMcode(
+		return code.WithClass(code.NewMcode(
 			MCODE_INVOKE_FAILED,
 			"parse return json payload failed",
-		)
+		), code.ClassInternal)
 	}
 
 	return nil
@@ -189,24 +204,31 @@ func ExtractHttpResponse(name string, invokeErr error, rsp *http.Response, out i
 
 	if statusCode == http.StatusOK {
 		body, err := ioutil.ReadAll(rsp.Body)
+		// 已经返回200，请求已经被处理，重试可能导致重复执行
 		if err != nil {
-			errCode = code.NewMcode(MCODE_INVOKE_FAILED, "read response body failed")
+			errCode = code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, "read response body failed"), code.ClassInternal)
 			reportDataToMonitor(errCode, rsp)
 			return errCode
 		}
 
 		if len(body) == 0 {
-			errCode = code.NewMcode(MCODE_INVOKE_FAILED, "return json body empty")
+			errCode = code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, "return json body empty"), code.ClassInternal)
 			reportDataToMonitor(errCode, rsp)
 			return errCode
 		}
 
 		err = json.Unmarshal(body, &commonResp)
 		if err != nil {
-			errCode = code.NewMcode(MCODE_INVOKE_FAILED, "return json body error")
+			errCode = code.WithClass(code.NewMcode(MCODE_INVOKE_FAILED, "return json body error"), code.ClassInternal)
 			reportDataToMonitor(errCode, rsp)
 			return errCode
 		}
+	} else if statusCode != 0 {
+		// 非200的返回尽量解析标准结构，解析失败时按状态码处理
+		body, err := ioutil.ReadAll(rsp.Body)
+		if err == nil {
+			json.Unmarshal(body, &commonResp)
+		}
 	}
 
 	errCode = ExtractHeader(name, invokeErr, statusCode, &commonResp, out)
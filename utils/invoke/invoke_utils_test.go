@@ -9,9 +9,11 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/afex/hystrix-go/hystrix"
+	"github.com/lworkltd/kits/service/restful/code"
 )
 
 type TestOutput struct {
@@ -27,21 +29,27 @@ func TestExtractHeader(t *testing.T) {
 		out        interface{}
 		want       string
 		wantNumber int
+		wantClass  code.Class
 	}{
 		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true}, out: nil, want: ""},
-		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true}, out: &TestOutput{}, want: MCODE_INVOKE_FAILED},
+		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true}, out: &TestOutput{}, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
 		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true, Data: json.RawMessage(`{"Number":12345}`)}, out: &TestOutput{}, want: "", wantNumber: 12345},
-		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true, Data: json.RawMessage(`{"Number":"12345"}`)}, out: &TestOutput{}, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: nil, statusCode: 404, res: &Response{Result: true}, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Err: &os.SyscallError{}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: &url.Error{}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: false, Code: "SERVICE_ERROR"}, out: nil, want: "SERVICE_ERROR"},
-		{name: "MyService", invokeErr: hystrix.ErrTimeout, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_TIMEOUT},
-		{name: "MyService", invokeErr: hystrix.ErrCircuitOpen, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: hystrix.ErrMaxConcurrency, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED},
-		{name: "MyService", invokeErr: fmt.Errorf("other invoke errors"), statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED},
+		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: true, Data: json.RawMessage(`{"Number":"12345"}`)}, out: &TestOutput{}, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassBusiness},
+		{name: "MyService", invokeErr: nil, statusCode: 404, res: &Response{Result: true}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInvalid},
+		{name: "MyService", invokeErr: nil, statusCode: 429, res: &Response{Result: false, Code: "SNOWSLIDE_DENIED"}, out: nil, want: "SNOWSLIDE_DENIED", wantClass: code.ClassUnavailable},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Op: "dial", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassTransient},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Op: "read", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "svc", IsTemporary: true}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassTransient},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Op: "dial", Err: &net.DNSError{Name: "svc", IsNotFound: true}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInvalid},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{Err: &os.SyscallError{}}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{name: "MyService", invokeErr: &url.Error{Err: &net.OpError{}}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{name: "MyService", invokeErr: &url.Error{}, statusCode: 0, res: nil, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInvalid},
+		{name: "MyService", invokeErr: nil, statusCode: 200, res: &Response{Result: false, Code: "SERVICE_ERROR"}, out: nil, want: "SERVICE_ERROR", wantClass: code.ClassBusiness},
+		{name: "MyService", invokeErr: hystrix.ErrTimeout, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_TIMEOUT, wantClass: code.ClassTimeout},
+		{name: "MyService", invokeErr: hystrix.ErrCircuitOpen, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassUnavailable},
+		{name: "MyService", invokeErr: hystrix.ErrMaxConcurrency, statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassUnavailable},
+		{name: "MyService", invokeErr: fmt.Errorf("other invoke errors"), statusCode: 0, res: &Response{}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -57,6 +65,9 @@ func TestExtractHeader(t *testing.T) {
 			if !reflect.DeepEqual(got.Mcode(), tt.want) {
 				t.Errorf("ExtractHeader() = %v, want %v", got.Mcode(), tt.want)
 			}
+			if class := code.ClassOf(got); class != tt.wantClass || code.IsRetryable(got) != tt.wantClass.Retryable() {
+				t.Errorf("ExtractHeader() class = %v, want %v", class, tt.wantClass)
+			}
 		})
 	}
 }
@@ -96,11 +107,14 @@ func TestExtractHttpResponse(t *testing.T) {
 		rsp       *http.Response
 		out       interface{}
 		want      string
+		wantClass code.Class
 	}{
-		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(`{"mcode":"SERVICE_ERROR"}`)}, out: nil, want: "SERVICE_ERROR"},
-		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(``)}, out: nil, want: MCODE_INVOKE_FAILED},
-		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(`xxx`)}, out: nil, want: MCODE_INVOKE_FAILED},
-		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newErrorReaderCloser()}, out: nil, want: MCODE_INVOKE_FAILED},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(`{"mcode":"SERVICE_ERROR"}`)}, out: nil, want: "SERVICE_ERROR", wantClass: code.ClassBusiness},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(``)}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newStringReadCloser(`xxx`)}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 200, Body: newErrorReaderCloser()}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassInternal},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 500, Body: newStringReadCloser(`{"result":false,"mcode":"SERVICE_PANIC"}`)}, out: nil, want: "SERVICE_PANIC", wantClass: code.ClassInternal},
+		{invokeErr: nil, rsp: &http.Response{StatusCode: 502, Body: newStringReadCloser(`bad gateway`)}, out: nil, want: MCODE_INVOKE_FAILED, wantClass: code.ClassUnavailable},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -112,6 +126,9 @@ func TestExtractHttpResponse(t *testing.T) {
 			if !reflect.DeepEqual(got.Mcode(), tt.want) {
 				t.Errorf("ExtractHeader() = %v, want %v", got.Mcode(), tt.want)
 			}
+			if class := code.ClassOf(got); class != tt.wantClass || code.IsRetryable(got) != tt.wantClass.Retryable() {
+				t.Errorf("ExtractHeader() class = %v, want %v", class, tt.wantClass)
+			}
 		})
 	}
 }
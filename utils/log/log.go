@@ -14,6 +14,7 @@ const (
 	ServiceTag      = "@service"
 	ServiceIdTag    = "@service-id"
 	TracingTag      = "@tracing"
+	RequestIdTag    = "@request-id"
 	EnvTag          = "@env"
 	DirectLoggerTag = "@directLoggerTag"
 	ContextTag      = "@contextTempTag"
@@ -51,6 +52,9 @@ func InitLoggerWithProfile(cfg *profile.Logger) error {
 		logrus.SetOutput(file)
 	}
 
+	// Context的日志需要TracingLogHook移除上下文并写入Span
+	AddTracingLogHook(logrus.StandardLogger())
+
 	// TODO: add hooks
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"runtime"
+	"strings"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/sirupsen/logrus"
@@ -79,17 +80,36 @@ func makeFileLine(buf *[]byte, file string, line int, flag int) {
 	}
 }
 
+// loggingPackages 调用栈中属于日志封装的包，计算行号时跳过
+var loggingPackages = []string{
+	"github.com/sirupsen/logrus.",
+	"github.com/lworkltd/kits/utils/log.",
+	"github.com/lworkltd/kits/service/context.",
+}
+
+func isLoggingFrame(function string) bool {
+	for _, pkg := range loggingPackages {
+		if strings.HasPrefix(function, pkg) {
+			return true
+		}
+	}
+	return false
+}
+
 func (hook *FileLineHook) Fire(entry *logrus.Entry) error {
 	fileineInfo := func() string {
-		skip := 5
-		if _, exist := entry.Data[DirectLoggerTag]; exist {
-			skip = 6
-			delete(entry.Data, DirectLoggerTag)
+		delete(entry.Data, DirectLoggerTag)
+		pcs := make([]uintptr, 16)
+		n := runtime.Callers(3, pcs)
+		frames := runtime.CallersFrames(pcs[:n])
+		for {
+			frame, more := frames.Next()
+			if !isLoggingFrame(frame.Function) || !more {
+				var buf []byte
+				makeFileLine(&buf, frame.File, frame.Line, hook.flag)
+				return string(buf)
+			}
 		}
-		_, file, line, _ := runtime.Caller(skip)
-		var buf []byte
-		makeFileLine(&buf, file, line, hook.flag)
-		return string(buf)
 	}
 	entry.Data[FilelineTag] = fileineInfo()
 
@@ -128,6 +148,16 @@ func NewTracingLogHook() logrus.Hook {
 	return &TracingLogHook{}
 }
 
+// AddTracingLogHook 添加TracingLogHook，Context的日志作为Span的事件，已经添加时不重复添加
+func AddTracingLogHook(logger *logrus.Logger) {
+	for _, hook := range logger.Hooks[logrus.ErrorLevel] {
+		if _, ok := hook.(*TracingLogHook); ok {
+			return
+		}
+	}
+	logger.AddHook(NewTracingLogHook())
+}
+
 func (hook *TracingLogHook) Fire(entry *logrus.Entry) error {
 	ctxValue, exist := entry.Data[ContextTag]
 	if !exist {
@@ -149,10 +179,9 @@ func (hook *TracingLogHook) Fire(entry *logrus.Entry) error {
 		kvs = append(kvs, "message")
 		kvs = append(kvs, entry.Message)
 	}
+	kvs = append(kvs, "level", entry.Level.String())
 
-	if len(kvs) > 0 {
-		sp.LogKV(kvs...)
-	}
+	sp.LogKV(kvs...)
 
 	return nil
 }